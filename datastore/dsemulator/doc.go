@@ -0,0 +1,48 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package dsemulator starts and stops a local datastore emulator for tests,
+// and provides dsiface.Clients connected to it.
+//
+// The emulator is launched with the gcloud command, which must be on PATH
+// with the cloud-datastore-emulator component installed. When either is
+// missing, Start returns ErrNotInstalled and the test helpers skip the test,
+// so the same tests can run wherever the emulator is available and be skipped
+// elsewhere.
+//
+// Starting the emulator takes several seconds, so a package's tests usually
+// share one emulator, resetting its state before each test:
+//
+//    var emulator *dsemulator.Emulator
+//
+//    func TestMain(m *testing.M) {
+//        var err error
+//        emulator, err = dsemulator.Start(context.Background(), "")
+//        if err != nil && err != dsemulator.ErrNotInstalled {
+//            log.Fatal(err)
+//        }
+//        code := m.Run()
+//        if emulator != nil {
+//            emulator.Stop()
+//        }
+//        os.Exit(code)
+//    }
+//
+//    func TestSomething(t *testing.T) {
+//        client := emulator.NewTestClient(t) // skips if emulator is nil
+//        ...
+//    }
+//
+// Note: This package is in alpha. Some backwards-incompatible changes may occur.
+package dsemulator
@@ -0,0 +1,165 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dsemulator
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"cloud.google.com/go/datastore"
+)
+
+// When fakeEnv is set, the test binary acts as gcloud, running a fake
+// emulator that only implements the administrative endpoints. Its Cloud SDK
+// is in the directory named by fakeEnv.
+const fakeEnv = "DSEMULATOR_FAKE_GCLOUD"
+
+func TestMain(m *testing.M) {
+	if root := os.Getenv(fakeEnv); root != "" {
+		if len(os.Args) > 1 && os.Args[1] == "info" {
+			fmt.Println(root)
+			return
+		}
+		runFakeEmulator(os.Args[1:])
+		return
+	}
+	os.Exit(m.Run())
+}
+
+func runFakeEmulator(args []string) {
+	var host string
+	for _, a := range args {
+		if strings.HasPrefix(a, "--host-port=") {
+			host = strings.TrimPrefix(a, "--host-port=")
+		}
+	}
+	var resets int32
+	srv := &http.Server{Addr: host}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "Ok\n")
+	})
+	mux.HandleFunc("/reset", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&resets, 1)
+		fmt.Fprintf(w, "Resetting...\n")
+	})
+	mux.HandleFunc("/shutdown", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "Shutting down...\n")
+		go srv.Close()
+	})
+	srv.Handler = mux
+	srv.ListenAndServe()
+}
+
+// useFakeGCloud makes Start run the test binary in place of gcloud, with the
+// emulator component installed if withEmulator is true.
+func useFakeGCloud(t *testing.T, withEmulator bool) {
+	dir := t.TempDir()
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(exe, filepath.Join(dir, "gcloud")); err != nil {
+		t.Skipf("cannot link test binary: %v", err)
+	}
+	root := t.TempDir()
+	if withEmulator {
+		if err := os.MkdirAll(filepath.Join(root, "platform", "cloud-datastore-emulator"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", dir)
+	t.Setenv(fakeEnv, root)
+}
+
+func TestStartStop(t *testing.T) {
+	useFakeGCloud(t, true)
+	ctx := context.Background()
+	e, err := Start(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.ProjectID != DefaultProjectID {
+		t.Errorf("got project ID %q, want %q", e.ProjectID, DefaultProjectID)
+	}
+	if err := e.Reset(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-e.exited:
+	default:
+		t.Error("emulator process still running after Stop")
+	}
+	if err := e.Stop(); err != nil {
+		t.Errorf("second Stop: %v", err)
+	}
+}
+
+func TestNotInstalled(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	if _, err := Start(context.Background(), ""); err != ErrNotInstalled {
+		t.Errorf("got %v, want ErrNotInstalled", err)
+	}
+	var e *Emulator
+	t.Run("skip", func(t *testing.T) {
+		e.NewTestClient(t)
+		t.Error("NewTestClient did not skip the test")
+	})
+}
+
+func TestComponentNotInstalled(t *testing.T) {
+	useFakeGCloud(t, false)
+	if _, err := Start(context.Background(), ""); err != ErrNotInstalled {
+		t.Errorf("got %v, want ErrNotInstalled", err)
+	}
+	t.Run("skip", func(t *testing.T) {
+		NewTestClient(t)
+		t.Error("NewTestClient did not skip the test")
+	})
+}
+
+// TestEmulator runs against a real emulator, if gcloud is installed.
+func TestEmulator(t *testing.T) {
+	if testing.Short() {
+		t.Skip("emulator tests skipped in short mode")
+	}
+	client := NewTestClient(t)
+	if got := os.Getenv("DATASTORE_EMULATOR_HOST"); got == "" {
+		t.Error("DATASTORE_EMULATOR_HOST is not set")
+	}
+
+	ctx := context.Background()
+	type entity struct{ Payload string }
+	key, err := client.Put(ctx, datastore.IncompleteKey("Test", nil), &entity{Payload: "p"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got entity
+	if err := client.Get(ctx, key, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Payload != "p" {
+		t.Errorf("got %q, want %q", got.Payload, "p")
+	}
+}
@@ -0,0 +1,280 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dsemulator
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"github.com/googleapis/google-cloud-go-testing/datastore/dsiface"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// ErrNotInstalled is returned by Start when the gcloud command is not on
+// PATH, or gcloud does not have the datastore emulator component installed.
+var ErrNotInstalled = errors.New("dsemulator: datastore emulator is not installed")
+
+// DefaultProjectID is the project ID used when Start is given none.
+const DefaultProjectID = "dsemulator-test"
+
+const (
+	startTimeout = time.Minute
+	stopTimeout  = 10 * time.Second
+)
+
+// Emulator is a running datastore emulator.
+type Emulator struct {
+	// Host is the address of the emulator, in the form expected in the
+	// DATASTORE_EMULATOR_HOST environment variable.
+	Host string
+	// ProjectID is the project ID that clients of the emulator use.
+	ProjectID string
+
+	cmd      *exec.Cmd
+	output   lockedBuffer
+	exited   chan struct{} // closed when the process exits
+	stopOnce sync.Once
+}
+
+// lockedBuffer collects the output of the emulator process.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// Start launches an in-memory, strongly consistent emulator on a free local
+// port and waits until it is ready to serve requests, or ctx is done. If
+// projectID is empty, DefaultProjectID is used. The emulator runs until Stop
+// is called.
+func Start(ctx context.Context, projectID string) (*Emulator, error) {
+	gcloud, err := exec.LookPath("gcloud")
+	if err != nil || !emulatorInstalled(ctx, gcloud) {
+		return nil, ErrNotInstalled
+	}
+	if projectID == "" {
+		projectID = DefaultProjectID
+	}
+	host, err := freeAddress()
+	if err != nil {
+		return nil, err
+	}
+	e := &Emulator{
+		Host:      host,
+		ProjectID: projectID,
+		exited:    make(chan struct{}),
+	}
+	e.cmd = exec.Command(gcloud, "beta", "emulators", "datastore", "start",
+		"--host-port="+host,
+		"--project="+projectID,
+		"--no-store-on-disk",
+		"--consistency=1.0")
+	e.cmd.Stdout = &e.output
+	e.cmd.Stderr = &e.output
+	if err := e.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("dsemulator: starting emulator: %v", err)
+	}
+	go func() {
+		e.cmd.Wait()
+		close(e.exited)
+	}()
+	if err := e.waitReady(ctx); err != nil {
+		e.Stop()
+		if strings.Contains(e.output.String(), "requires the installation of components") {
+			// A component the command needs, such as beta, is missing.
+			return nil, ErrNotInstalled
+		}
+		return nil, fmt.Errorf("dsemulator: %v\n%s", err, e.output.String())
+	}
+	return e, nil
+}
+
+// emulatorInstalled reports whether the datastore emulator component is
+// installed in the Cloud SDK of gcloud. It looks for the component's
+// directory rather than running the emulator, since gcloud may offer to
+// install a missing component.
+func emulatorInstalled(ctx context.Context, gcloud string) bool {
+	out, err := exec.CommandContext(ctx, gcloud, "info", "--format=value(installation.sdk_root)").Output()
+	if err != nil {
+		return false
+	}
+	root := strings.TrimSpace(string(out))
+	if root == "" {
+		return false
+	}
+	_, err = os.Stat(filepath.Join(root, "platform", "cloud-datastore-emulator"))
+	return err == nil
+}
+
+// freeAddress returns a local address with a port that is not in use.
+func freeAddress() (string, error) {
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return "", err
+	}
+	defer l.Close()
+	return l.Addr().String(), nil
+}
+
+// waitReady polls the emulator until it responds.
+func (e *Emulator) waitReady(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, startTimeout)
+	defer cancel()
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		req, err := http.NewRequest("GET", "http://"+e.Host+"/", nil)
+		if err != nil {
+			return err
+		}
+		if resp, err := http.DefaultClient.Do(req.WithContext(ctx)); err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+		}
+		select {
+		case <-e.exited:
+			return errors.New("emulator exited before it was ready")
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for emulator: %v", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+// post sends a POST request for path to the emulator.
+func (e *Emulator) post(ctx context.Context, path string) error {
+	req, err := http.NewRequest("POST", "http://"+e.Host+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("dsemulator: %s: %s: %s", path, resp.Status, body)
+	}
+	return nil
+}
+
+// Reset deletes all data in the emulator.
+func (e *Emulator) Reset(ctx context.Context) error {
+	return e.post(ctx, "/reset")
+}
+
+// Stop shuts the emulator down, killing the process if it does not exit
+// promptly. It is safe to call Stop more than once.
+func (e *Emulator) Stop() error {
+	e.stopOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), stopTimeout)
+		defer cancel()
+		e.post(ctx, "/shutdown")
+		select {
+		case <-e.exited:
+			return
+		case <-ctx.Done():
+		}
+		e.cmd.Process.Kill()
+		<-e.exited
+	})
+	return nil
+}
+
+// NewClient returns a client connected to the emulator. It does not depend
+// on the DATASTORE_EMULATOR_HOST environment variable.
+func (e *Emulator) NewClient(ctx context.Context) (dsiface.Client, error) {
+	c, err := datastore.NewClient(ctx, e.ProjectID,
+		option.WithEndpoint("passthrough:///"+e.Host),
+		option.WithoutAuthentication(),
+		option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())))
+	if err != nil {
+		return nil, err
+	}
+	return dsiface.AdaptClient(c), nil
+}
+
+// NewTestClient resets the emulator and returns a client connected to it,
+// which is closed when the test finishes. For the duration of the test, it
+// also sets DATASTORE_EMULATOR_HOST and DATASTORE_PROJECT_ID, so that clients
+// created by the code under test use the emulator; tests that call it must
+// not run in parallel.
+//
+// If e is nil, as it is when Start returned ErrNotInstalled, the test is
+// skipped.
+func (e *Emulator) NewTestClient(t testing.TB) dsiface.Client {
+	t.Helper()
+	if e == nil {
+		t.Skip("datastore emulator is not available")
+	}
+	ctx := context.Background()
+	if err := e.Reset(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DATASTORE_EMULATOR_HOST", e.Host)
+	t.Setenv("DATASTORE_PROJECT_ID", e.ProjectID)
+	client, err := e.NewClient(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// NewTestClient starts an emulator for a single test and returns a client
+// connected to it, as Emulator.NewTestClient does. The emulator is stopped
+// when the test finishes. If the emulator is not installed, the test is
+// skipped.
+func NewTestClient(t testing.TB) dsiface.Client {
+	t.Helper()
+	e, err := Start(context.Background(), "")
+	if err == ErrNotInstalled {
+		t.Skip("datastore emulator is not installed")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { e.Stop() })
+	return e.NewTestClient(t)
+}
@@ -0,0 +1,122 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dsfake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+
+	"cloud.google.com/go/datastore"
+	pb "cloud.google.com/go/datastore/apiv1/datastorepb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxAggregations is the maximum number of aggregations in a query.
+const maxAggregations = 5
+
+// RunAggregationQuery runs the aggregations of aq over the results of its
+// query. Like the service, it returns each aggregate as a *datastorepb.Value:
+// counts are integers, sums are integers unless a summed value is a double or
+// the sum overflows, and averages are doubles, or null if no entity has a
+// numeric value for the property. Aggregations without an alias are named
+// property_1, property_2 and so on.
+func (c *Client) RunAggregationQuery(ctx context.Context, aq *datastore.AggregationQuery) (datastore.AggregationResult, error) {
+	if aq == nil {
+		return nil, errors.New("datastore: aggregation query cannot be nil")
+	}
+	v := reflect.ValueOf(aq).Elem()
+	q, _ := unexported(v, "query").Interface().(*datastore.Query)
+	if q == nil {
+		return nil, errors.New("datastore: aggregation query must include nested query")
+	}
+	aggs, _ := unexported(v, "aggregationQueries").Interface().([]*pb.AggregationQuery_Aggregation)
+	if len(aggs) == 0 {
+		return nil, errors.New("datastore: aggregation query must contain one or more operators (e.g. count)")
+	}
+	if len(aggs) > maxAggregations {
+		return nil, status.Errorf(codes.InvalidArgument, "an aggregation query may have at most %d aggregations", maxAggregations)
+	}
+	res, err := c.runQuery(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	ar := make(datastore.AggregationResult, len(aggs))
+	unnamed := 0
+	for _, a := range aggs {
+		alias := a.Alias
+		if alias == "" {
+			unnamed++
+			alias = fmt.Sprintf("property_%d", unnamed)
+		}
+		if _, ok := ar[alias]; ok {
+			return nil, status.Errorf(codes.InvalidArgument, "duplicate aggregation alias %q", alias)
+		}
+		switch op := a.Operator.(type) {
+		case *pb.AggregationQuery_Aggregation_Count_:
+			ar[alias] = &pb.Value{ValueType: &pb.Value_IntegerValue{IntegerValue: int64(len(res.results))}}
+		case *pb.AggregationQuery_Aggregation_Sum_:
+			ar[alias] = aggregate(res.results, op.Sum.GetProperty().GetName(), false)
+		case *pb.AggregationQuery_Aggregation_Avg_:
+			ar[alias] = aggregate(res.results, op.Avg.GetProperty().GetName(), true)
+		default:
+			return nil, status.Errorf(codes.InvalidArgument, "unsupported aggregation %T", op)
+		}
+	}
+	return ar, nil
+}
+
+// aggregate returns the sum or average of the numeric values of the named
+// property of rs. Other values are ignored.
+func aggregate(rs []result, name string, avg bool) *pb.Value {
+	var (
+		isum     int64
+		fsum     float64
+		n        int
+		overflow bool
+		double   bool
+	)
+	for _, r := range rs {
+		vals, _ := indexedValues(r.props, name)
+		for _, v := range vals {
+			switch v := v.(type) {
+			case int64:
+				if (v > 0 && isum > math.MaxInt64-v) || (v < 0 && isum < math.MinInt64-v) {
+					overflow = true
+				}
+				isum += v
+				fsum += float64(v)
+			case float64:
+				double = true
+				fsum += v
+			default:
+				continue
+			}
+			n++
+		}
+	}
+	switch {
+	case avg && n == 0:
+		return &pb.Value{ValueType: &pb.Value_NullValue{}}
+	case avg:
+		return &pb.Value{ValueType: &pb.Value_DoubleValue{DoubleValue: fsum / float64(n)}}
+	case double || overflow:
+		return &pb.Value{ValueType: &pb.Value_DoubleValue{DoubleValue: fsum}}
+	}
+	return &pb.Value{ValueType: &pb.Value_IntegerValue{IntegerValue: isum}}
+}
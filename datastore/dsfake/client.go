@@ -0,0 +1,486 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dsfake
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"reflect"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"github.com/googleapis/google-cloud-go-testing/datastore/dsiface"
+)
+
+// Client is an in-memory implementation of dsiface.Client. It is safe for
+// concurrent use.
+type Client struct {
+	dsiface.Client
+
+	mu          sync.Mutex
+	now         func() time.Time
+	rand        *rand.Rand
+	consistency *Consistency
+	closed      bool
+	readTime    time.Time // set by WithReadOptions
+	groupLimits *EntityGroupLimits
+
+	seq       int64                // sequence number of the last commit
+	entities  map[string]*entity   // committed entities, by keyString
+	lastWrite map[string]int64     // commit sequence number of the last write, by keyString
+	history   map[string][]version // every committed version, by keyString
+	idPolicy  IDPolicy
+	nextID    int64          // next candidate for SequentialIDs
+	usedIDs   map[int64]bool // IDs that must not be allocated
+
+	writeTokens map[string]*writeTokens // by keyString of entity group root
+
+	// Used only with eventual consistency: the entities visible to queries,
+	// and the committed writes that they do not reflect yet.
+	indexed map[string]*entity
+	pending []*indexUpdate
+}
+
+// An Option configures a Client.
+type Option func(*Client)
+
+// WithClock returns an Option that makes the Client read the current time
+// from now instead of time.Now.
+func WithClock(now func() time.Time) Option {
+	return func(c *Client) {
+		c.now = now
+	}
+}
+
+// NewClient returns an empty Client configured by opts.
+func NewClient(opts ...Option) *Client {
+	c := &Client{
+		now:       time.Now,
+		rand:      rand.New(rand.NewSource(time.Now().UnixNano())),
+		entities:  make(map[string]*entity),
+		lastWrite: make(map[string]int64),
+		history:   make(map[string][]version),
+		indexed:   make(map[string]*entity),
+		nextID:    1,
+		usedIDs:   make(map[int64]bool),
+
+		writeTokens: make(map[string]*writeTokens),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+var errClosed = errors.New("dsfake: client is closed")
+
+// write is a single change to an entity. A write with nil props deletes the
+// entity.
+type write struct {
+	key   *datastore.Key
+	props []datastore.Property
+	op    MutationOp // set for writes made by mutations, to check preconditions
+}
+
+// commitLocked atomically applies writes. c.mu must be held.
+func (c *Client) commitLocked(writes []write) {
+	now := c.now()
+	c.seq++
+	for _, w := range writes {
+		ks := keyString(w.key)
+		c.lastWrite[ks] = c.seq
+		c.recordIDLocked(w.key)
+		var e *entity
+		if w.props != nil {
+			e = &entity{key: cloneKey(w.key), props: w.props}
+			c.entities[ks] = e
+		} else {
+			delete(c.entities, ks)
+		}
+		c.recordVersionLocked(ks, e, now)
+		c.recordIndexUpdateLocked(ks, e, now)
+	}
+}
+
+// completeKeyLocked returns k, or a copy of k with a newly allocated ID if k
+// is incomplete. c.mu must be held.
+func (c *Client) completeKeyLocked(k *datastore.Key) *datastore.Key {
+	if !k.Incomplete() {
+		return k
+	}
+	k = cloneKey(k)
+	k.ID = c.allocateIDLocked()
+	return k
+}
+
+// lookupLocked returns the entity with key k as of time t, or the committed
+// entity if t is zero, or nil. c.mu must be held.
+func (c *Client) lookupLocked(k *datastore.Key, t time.Time) *entity {
+	if !t.IsZero() {
+		return c.entityAtLocked(keyString(k), t)
+	}
+	return c.entities[keyString(k)]
+}
+
+func (c *Client) checkLocked(ctx context.Context) error {
+	if c.closed {
+		return errClosed
+	}
+	return ctx.Err()
+}
+
+var errEventualReadTime = errors.New("datastore: cannot use EventualConsistency query when read time is specified on client or query is in a transaction")
+
+// checkReadLocked is checkLocked for reads, which may not be eventually
+// consistent if a read time is set. c.mu must be held.
+func (c *Client) checkReadLocked(ctx context.Context, eventual bool) error {
+	if err := c.checkLocked(ctx); err != nil {
+		return err
+	}
+	if eventual && !c.readTime.IsZero() {
+		return errEventualReadTime
+	}
+	return nil
+}
+
+// WithReadOptions makes subsequent reads observe the state of the fake at
+// the time given by a datastore.ReadTime option, using the history of the
+// entities. Like the datastore package, it modifies c and returns it. A zero
+// read time restores reads of the current state.
+func (c *Client) WithReadOptions(ro ...datastore.ReadOption) dsiface.Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, o := range ro {
+		// The option types of the datastore package are unexported;
+		// ReadTime's is a time.Time.
+		if v := reflect.ValueOf(o); v.Type().ConvertibleTo(timeType) {
+			c.readTime = v.Convert(timeType).Interface().(time.Time)
+		}
+	}
+	return c
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Close closes the Client. Subsequent calls return an error.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+// Count returns the number of results for the query.
+func (c *Client) Count(ctx context.Context, q *datastore.Query) (int, error) {
+	res, err := c.runQuery(ctx, q)
+	if err != nil {
+		return 0, err
+	}
+	return len(res.results), nil
+}
+
+// Delete deletes the entity for the given key.
+func (c *Client) Delete(ctx context.Context, key *datastore.Key) error {
+	err := c.DeleteMulti(ctx, []*datastore.Key{key})
+	if me, ok := err.(datastore.MultiError); ok {
+		return me[0]
+	}
+	return err
+}
+
+// DeleteMulti is a batch version of Delete.
+func (c *Client) DeleteMulti(ctx context.Context, keys []*datastore.Key) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.checkLocked(ctx); err != nil {
+		return err
+	}
+	if err := checkDeletes(keys); err != nil {
+		return err
+	}
+	writes := make([]write, len(keys))
+	for i, k := range keys {
+		writes[i] = write{key: k}
+	}
+	if err := c.checkEntityGroupsLocked(writes, nil, false); err != nil {
+		return err
+	}
+	c.commitLocked(writes)
+	return nil
+}
+
+// checkDeletes validates the keys of a delete call.
+func checkDeletes(keys []*datastore.Key) error {
+	if err := checkBatch(len(keys), maxWriteBatch); err != nil {
+		return err
+	}
+	errs := make(datastore.MultiError, len(keys))
+	var failed bool
+	for i, k := range keys {
+		if err := checkKey(k, false); err != nil {
+			errs[i] = err
+			failed = true
+		}
+	}
+	if failed {
+		return errs
+	}
+	return nil
+}
+
+// Get loads the entity stored for key into dst, which must be a struct
+// pointer or implement datastore.PropertyLoadSaver.
+func (c *Client) Get(ctx context.Context, key *datastore.Key, dst interface{}) error {
+	if dst == nil {
+		return datastore.ErrInvalidEntityType
+	}
+	err := c.GetMulti(ctx, []*datastore.Key{key}, []interface{}{dst})
+	if me, ok := err.(datastore.MultiError); ok {
+		return me[0]
+	}
+	return err
+}
+
+// GetMulti is a batch version of Get.
+func (c *Client) GetMulti(ctx context.Context, keys []*datastore.Key, dst interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.checkReadLocked(ctx, false); err != nil {
+		return err
+	}
+	return c.getMultiLocked(keys, dst, c.readTime, nil)
+}
+
+// getMultiLocked loads the entities for keys as of time t, or the committed
+// entities if t is zero, into dst, calling observe, if not nil, with each key
+// looked up. c.mu must be held.
+func (c *Client) getMultiLocked(keys []*datastore.Key, dst interface{}, t time.Time, observe func(*datastore.Key)) error {
+	if err := checkBatch(len(keys), maxLookupBatch); err != nil {
+		return err
+	}
+	dsts, err := multiArg(dst, len(keys), true)
+	if err != nil {
+		return err
+	}
+	errs := make(datastore.MultiError, len(keys))
+	var failed bool
+	for i, k := range keys {
+		if err := checkKey(k, false); err != nil {
+			errs[i] = err
+			failed = true
+			continue
+		}
+		if observe != nil {
+			observe(k)
+		}
+		e := c.lookupLocked(k, t)
+		if e == nil {
+			errs[i] = datastore.ErrNoSuchEntity
+			failed = true
+			continue
+		}
+		if err := loadEntity(dsts[i], e.key, e.props); err != nil {
+			errs[i] = err
+			failed = true
+		}
+	}
+	if failed {
+		return errs
+	}
+	return nil
+}
+
+// Put saves the entity src into the datastore with the given key. If key is
+// incomplete, a new ID is allocated and the completed key is returned.
+func (c *Client) Put(ctx context.Context, key *datastore.Key, src interface{}) (*datastore.Key, error) {
+	keys, err := c.PutMulti(ctx, []*datastore.Key{key}, []interface{}{src})
+	if err != nil {
+		if me, ok := err.(datastore.MultiError); ok {
+			return nil, me[0]
+		}
+		return nil, err
+	}
+	return keys[0], nil
+}
+
+// PutMulti is a batch version of Put.
+func (c *Client) PutMulti(ctx context.Context, keys []*datastore.Key, src interface{}) ([]*datastore.Key, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.checkLocked(ctx); err != nil {
+		return nil, err
+	}
+	writes, err := prepareWrites(keys, src)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.checkEntityGroupsLocked(writes, nil, false); err != nil {
+		return nil, err
+	}
+	ret := make([]*datastore.Key, len(writes))
+	for i := range writes {
+		writes[i].key = c.completeKeyLocked(writes[i].key)
+		ret[i] = cloneKey(writes[i].key)
+	}
+	c.commitLocked(writes)
+	return ret, nil
+}
+
+// prepareWrites validates keys and converts the elements of src to
+// properties, reporting invalid keys and entities in a datastore.MultiError.
+func prepareWrites(keys []*datastore.Key, src interface{}) ([]write, error) {
+	if err := checkBatch(len(keys), maxWriteBatch); err != nil {
+		return nil, err
+	}
+	srcs, err := multiArg(src, len(keys), false)
+	if err != nil {
+		return nil, err
+	}
+	errs := make(datastore.MultiError, len(keys))
+	var failed bool
+	writes := make([]write, len(keys))
+	for i, k := range keys {
+		if err := checkKey(k, true); err != nil {
+			errs[i] = err
+			failed = true
+			continue
+		}
+		props, err := saveEntity(srcs[i])
+		if err == nil {
+			err = checkEntity(k, props)
+		}
+		if err != nil {
+			errs[i] = err
+			failed = true
+			continue
+		}
+		if props == nil {
+			props = []datastore.Property{}
+		}
+		writes[i] = write{key: k, props: props}
+	}
+	if failed {
+		return nil, errs
+	}
+	return writes, nil
+}
+
+// Run runs the given query.
+func (c *Client) Run(ctx context.Context, q *datastore.Query) dsiface.Iterator {
+	res, err := c.runQuery(ctx, q)
+	if err != nil {
+		return &queryIterator{err: err}
+	}
+	return newIterator(res)
+}
+
+// GetAll runs the query and returns all keys that match it, loading the
+// entities into dst, which must be a pointer to a slice, unless the query is
+// keys-only.
+func (c *Client) GetAll(ctx context.Context, q *datastore.Query, dst interface{}) ([]*datastore.Key, error) {
+	res, err := c.runQuery(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	var sv reflect.Value
+	if dst != nil {
+		sv = reflect.ValueOf(dst)
+		if sv.Kind() != reflect.Ptr || sv.Elem().Kind() != reflect.Slice {
+			return nil, datastore.ErrInvalidEntityType
+		}
+		sv = sv.Elem()
+	} else if !res.keysOnly {
+		return nil, errors.New("datastore: dst must not be nil unless the query is keys-only")
+	}
+	keys := make([]*datastore.Key, 0, len(res.results))
+	var errFieldMismatch error
+	for _, r := range res.results {
+		keys = append(keys, cloneKey(r.key))
+		if dst == nil || res.keysOnly {
+			continue
+		}
+		ev, elem, err := newElem(sv.Type().Elem())
+		if err != nil {
+			return nil, err
+		}
+		if err := loadEntity(elem, r.key, r.props); err != nil {
+			if _, ok := err.(*datastore.ErrFieldMismatch); !ok {
+				return nil, err
+			}
+			if errFieldMismatch == nil {
+				errFieldMismatch = err
+			}
+		}
+		sv.Set(reflect.Append(sv, ev))
+	}
+	return keys, errFieldMismatch
+}
+
+// multiArg returns the n elements of the slice v as values that can be passed
+// to saveEntity or loadEntity. If alloc is true, nil pointer elements are
+// replaced with newly allocated values.
+func multiArg(v interface{}, n int, alloc bool) ([]interface{}, error) {
+	sv := reflect.ValueOf(v)
+	if sv.Kind() != reflect.Slice {
+		return nil, errors.New("datastore: src or dst has invalid type")
+	}
+	if sv.Len() != n {
+		return nil, errors.New("datastore: key and src or dst slices have different length")
+	}
+	out := make([]interface{}, n)
+	for i := range out {
+		ev := sv.Index(i)
+		switch ev.Kind() {
+		case reflect.Struct, reflect.Slice:
+			out[i] = ev.Addr().Interface()
+		case reflect.Ptr:
+			if ev.IsNil() {
+				if !alloc {
+					return nil, datastore.ErrInvalidEntityType
+				}
+				ev.Set(reflect.New(ev.Type().Elem()))
+			}
+			out[i] = ev.Interface()
+		case reflect.Interface:
+			if ev.IsNil() {
+				return nil, datastore.ErrInvalidEntityType
+			}
+			out[i] = ev.Interface()
+		default:
+			return nil, datastore.ErrInvalidEntityType
+		}
+	}
+	return out, nil
+}
+
+// newElem allocates a new value of type t, which is the element type of a
+// slice passed to GetAll. It returns the value to append to the slice and the
+// value to load the entity into.
+func newElem(t reflect.Type) (reflect.Value, interface{}, error) {
+	switch t.Kind() {
+	case reflect.Struct, reflect.Slice:
+		p := reflect.New(t)
+		return p.Elem(), p.Interface(), nil
+	case reflect.Ptr:
+		if t.Elem().Kind() != reflect.Struct {
+			return reflect.Value{}, nil, datastore.ErrInvalidEntityType
+		}
+		p := reflect.New(t.Elem())
+		return p, p.Interface(), nil
+	}
+	return reflect.Value{}, nil, datastore.ErrInvalidEntityType
+}
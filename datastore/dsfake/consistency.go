@@ -0,0 +1,129 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dsfake
+
+import (
+	"time"
+)
+
+// Consistency configures when committed writes become visible to eventually
+// consistent queries. A write that has not become visible yet is pending.
+type Consistency struct {
+	// Delay is how long after its commit a pending write becomes visible. If
+	// Delay is zero, writes do not become visible with the passage of time.
+	Delay time.Duration
+
+	// Probability is the chance, between 0 and 1, that a pending write
+	// becomes visible each time an eventually consistent query runs.
+	Probability float64
+}
+
+// EventualConsistency returns an Option that makes queries without an
+// ancestor filter, and queries that request it with
+// datastore.Query.EventualConsistency, eventually consistent as configured by
+// cfg. Get, GetMulti and other ancestor queries remain strongly consistent.
+//
+// Writes to an entity become visible in commit order: once a write is
+// visible, earlier writes to the same entity are no longer observable.
+func EventualConsistency(cfg Consistency) Option {
+	return func(c *Client) {
+		c.consistency = &cfg
+	}
+}
+
+// indexUpdate is a committed write that is not yet visible to eventually
+// consistent queries.
+type indexUpdate struct {
+	key       string
+	ent       *entity // nil for a deletion
+	committed time.Time
+}
+
+// recordIndexUpdateLocked records a write for eventually consistent queries.
+// c.mu must be held.
+func (c *Client) recordIndexUpdateLocked(ks string, e *entity, committed time.Time) {
+	if c.consistency == nil {
+		return
+	}
+	c.pending = append(c.pending, &indexUpdate{key: ks, ent: e, committed: committed})
+}
+
+// queryViewLocked returns the entities visible to a query. c.mu must be held.
+func (c *Client) queryViewLocked(strong bool) map[string]*entity {
+	if c.consistency == nil || strong {
+		return c.entities
+	}
+	c.applyIndexUpdatesLocked(false)
+	return c.indexed
+}
+
+// applyIndexUpdatesLocked makes pending writes visible according to the
+// consistency configuration, or all of them if all is true. c.mu must be
+// held.
+func (c *Client) applyIndexUpdatesLocked(all bool) {
+	now := c.now()
+	visible := make([]bool, len(c.pending))
+	for i, u := range c.pending {
+		switch {
+		case all:
+			visible[i] = true
+		case c.consistency.Delay > 0 && now.Sub(u.committed) >= c.consistency.Delay:
+			visible[i] = true
+		case c.consistency.Probability > 0:
+			visible[i] = c.rand.Float64() < c.consistency.Probability
+		}
+	}
+	// Walk backwards so that only the latest visible write to each entity is
+	// applied, and earlier writes to it are discarded.
+	superseded := make(map[string]bool)
+	var remaining []*indexUpdate
+	for i := len(c.pending) - 1; i >= 0; i-- {
+		u := c.pending[i]
+		switch {
+		case superseded[u.key]:
+		case visible[i]:
+			if u.ent != nil {
+				c.indexed[u.key] = u.ent
+			} else {
+				delete(c.indexed, u.key)
+			}
+			superseded[u.key] = true
+		default:
+			remaining = append(remaining, u)
+		}
+	}
+	for i, j := 0, len(remaining)-1; i < j; i, j = i+1, j-1 {
+		remaining[i], remaining[j] = remaining[j], remaining[i]
+	}
+	c.pending = remaining
+}
+
+// ApplyPendingWrites makes every committed write visible to eventually
+// consistent queries.
+func (c *Client) ApplyPendingWrites() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.consistency != nil {
+		c.applyIndexUpdatesLocked(true)
+	}
+}
+
+// PendingWrites returns the number of committed writes that are not yet
+// visible to eventually consistent queries.
+func (c *Client) PendingWrites() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.pending)
+}
@@ -0,0 +1,71 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package dsfake provides an in-memory fake of the datastore client that
+// implements the interfaces in
+// github.com/googleapis/google-cloud-go-testing/datastore/dsiface.
+//
+// The fake stores entities as datastore.Property slices, so any type that the
+// datastore package can save and load may be used with it. Queries support
+// kinds, ancestors, property and composite filters, orders, projections,
+// limits, offsets and cursors, and aggregation queries support count, sum and
+// avg.
+//
+// Note: This package is in alpha. Some backwards-incompatible changes may occur.
+//
+// Consistency
+//
+// By default the fake is strongly consistent. Use the EventualConsistency
+// option to simulate the behavior of queries without an ancestor filter, which
+// may not observe recent writes:
+//
+//    client := dsfake.NewClient(dsfake.EventualConsistency(dsfake.Consistency{
+//        Delay: time.Second,
+//    }))
+//
+// Lookups by key and ancestor queries always observe every committed write.
+//
+// History
+//
+// The fake keeps every version of every entity, with its commit time read
+// from the clock given by the WithClock option. History returns the versions
+// of an entity, and reads made with datastore.ReadTime, through
+// Client.WithReadOptions, or in a read-only transaction started with
+// datastore.WithReadTime, observe the entities as of that time.
+//
+// Namespaces
+//
+// Entities in different namespaces are isolated from each other: keys may not
+// have parents in another namespace, and queries only return entities in
+// their own namespace, given by Query.Namespace. Ancestor queries fail if the
+// ancestor is in a different namespace. The namespaces in use, and the kinds
+// in use in a namespace, can be listed with __namespace__ and __kind__
+// metadata queries, as with the service.
+//
+// Limits
+//
+// The fake enforces the documented limits of the service: entity size,
+// indexed value size, index entries per entity, reserved and malformed kinds,
+// names and namespaces, and the number of keys in a single call. Problems with
+// individual entities are reported per key in a datastore.MultiError, using
+// the errors of the datastore package where the client itself would reject the
+// entity and gRPC status errors with code InvalidArgument where the service
+// would.
+//
+// The limits of transactions and entity groups are only enforced when the
+// WithEntityGroupLimits option is given, as most tests do not want commits to
+// fail because they run faster than the service allows:
+//
+//    client := dsfake.NewClient(dsfake.WithEntityGroupLimits(dsfake.DefaultEntityGroupLimits))
+package dsfake
@@ -0,0 +1,807 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dsfake
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"cloud.google.com/go/datastore/apiv1/datastorepb"
+	"github.com/googleapis/google-cloud-go-testing/datastore/dsiface"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+var _ dsiface.Client = (*Client)(nil)
+
+type item struct {
+	Name  string
+	Count int
+	Tags  []string
+}
+
+// fakeClock is a manually advanced clock for tests.
+type fakeClock struct {
+	t time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{t: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time          { return c.t }
+func (c *fakeClock) Advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func TestPutGetDelete(t *testing.T) {
+	ctx := context.Background()
+	client := NewClient()
+
+	key, err := client.Put(ctx, datastore.IncompleteKey("Item", nil), &item{Name: "a", Count: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.Incomplete() {
+		t.Fatalf("Put returned incomplete key %v", key)
+	}
+
+	var got item
+	if err := client.Get(ctx, key, &got); err != nil {
+		t.Fatal(err)
+	}
+	if want := (item{Name: "a", Count: 1}); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	if err := client.Delete(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Get(ctx, key, &got); err != datastore.ErrNoSuchEntity {
+		t.Errorf("got %v, want ErrNoSuchEntity", err)
+	}
+}
+
+func TestGetMulti(t *testing.T) {
+	ctx := context.Background()
+	client := NewClient()
+
+	k1 := datastore.NameKey("Item", "one", nil)
+	k2 := datastore.NameKey("Item", "two", nil)
+	if _, err := client.Put(ctx, k1, &item{Name: "one"}); err != nil {
+		t.Fatal(err)
+	}
+	dst := make([]*item, 2)
+	err := client.GetMulti(ctx, []*datastore.Key{k1, k2}, dst)
+	me, ok := err.(datastore.MultiError)
+	if !ok {
+		t.Fatalf("got %v, want MultiError", err)
+	}
+	if me[0] != nil || me[1] != datastore.ErrNoSuchEntity {
+		t.Errorf("got %v, want [nil, ErrNoSuchEntity]", me)
+	}
+	if dst[0].Name != "one" {
+		t.Errorf("got %q, want %q", dst[0].Name, "one")
+	}
+}
+
+func TestQuery(t *testing.T) {
+	ctx := context.Background()
+	client := NewClient()
+
+	parent := datastore.NameKey("Parent", "p", nil)
+	items := []*item{
+		{Name: "a", Count: 3, Tags: []string{"x"}},
+		{Name: "b", Count: 1, Tags: []string{"x", "y"}},
+		{Name: "c", Count: 2},
+	}
+	keys := []*datastore.Key{
+		datastore.NameKey("Item", "a", parent),
+		datastore.NameKey("Item", "b", nil),
+		datastore.NameKey("Item", "c", parent),
+	}
+	if _, err := client.PutMulti(ctx, keys, items); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		desc string
+		q    *datastore.Query
+		want []string
+	}{
+		{"all", datastore.NewQuery("Item"), []string{"b", "a", "c"}},
+		{"order", datastore.NewQuery("Item").Order("-Count"), []string{"a", "c", "b"}},
+		{"filter", datastore.NewQuery("Item").Filter("Count >=", 2), []string{"a", "c"}},
+		{"multi-valued", datastore.NewQuery("Item").Filter("Tags =", "x"), []string{"b", "a"}},
+		{"ancestor", datastore.NewQuery("Item").Ancestor(parent), []string{"a", "c"}},
+		{"limit offset", datastore.NewQuery("Item").Order("Count").Offset(1).Limit(1), []string{"c"}},
+		{"key filter", datastore.NewQuery("Item").Filter("__key__ >", keys[1]), []string{"a", "c"}},
+		{"not equal", datastore.NewQuery("Item").FilterField("Count", "!=", 2), []string{"b", "a"}},
+		{"in", datastore.NewQuery("Item").FilterField("Name", "in", []interface{}{"a", "c"}), []string{"a", "c"}},
+		{"not in", datastore.NewQuery("Item").FilterField("Name", "not-in", []interface{}{"a", "c"}), []string{"b"}},
+		{"or", datastore.NewQuery("Item").FilterEntity(datastore.OrFilter{Filters: []datastore.EntityFilter{
+			datastore.PropertyFilter{FieldName: "Count", Operator: ">", Value: 2},
+			datastore.PropertyFilter{FieldName: "Tags", Operator: "=", Value: "y"},
+		}}), []string{"b", "a"}},
+		{"other kind", datastore.NewQuery("Other"), nil},
+	} {
+		var got []item
+		if _, err := client.GetAll(ctx, test.q, &got); err != nil {
+			t.Fatalf("%s: %v", test.desc, err)
+		}
+		var names []string
+		for _, it := range got {
+			names = append(names, it.Name)
+		}
+		if !reflect.DeepEqual(names, test.want) {
+			t.Errorf("%s: got %v, want %v", test.desc, names, test.want)
+		}
+	}
+
+	n, err := client.Count(ctx, datastore.NewQuery("Item").KeysOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("Count: got %d, want 3", n)
+	}
+}
+
+func TestAggregationQuery(t *testing.T) {
+	ctx := context.Background()
+	client := NewClient()
+	keys := []*datastore.Key{
+		datastore.NameKey("Item", "a", nil),
+		datastore.NameKey("Item", "b", nil),
+		datastore.NameKey("Item", "c", nil),
+	}
+	items := []*item{{Name: "a", Count: 3}, {Name: "b", Count: 1}, {Name: "c", Count: 2}}
+	if _, err := client.PutMulti(ctx, keys, items); err != nil {
+		t.Fatal(err)
+	}
+
+	q := datastore.NewQuery("Item").Filter("Count >", 1)
+	got, err := client.RunAggregationQuery(ctx, q.NewAggregationQuery().
+		WithCount("n").WithSum("Count", "sum").WithAvg("Count", "").WithAvg("Name", "avgName"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := datastore.AggregationResult{
+		"n":          &datastorepb.Value{ValueType: &datastorepb.Value_IntegerValue{IntegerValue: 2}},
+		"sum":        &datastorepb.Value{ValueType: &datastorepb.Value_IntegerValue{IntegerValue: 5}},
+		"property_1": &datastorepb.Value{ValueType: &datastorepb.Value_DoubleValue{DoubleValue: 2.5}},
+		"avgName":    &datastorepb.Value{ValueType: &datastorepb.Value_NullValue{}},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for alias, w := range want {
+		if !proto.Equal(got[alias].(*datastorepb.Value), w.(*datastorepb.Value)) {
+			t.Errorf("%s: got %v, want %v", alias, got[alias], w)
+		}
+	}
+
+	if _, err := client.RunAggregationQuery(ctx, q.NewAggregationQuery()); err == nil {
+		t.Error("got nil error for an aggregation query without aggregations")
+	}
+	_, err = client.RunAggregationQuery(ctx, q.NewAggregationQuery().WithCount("n").WithSum("Count", "n"))
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("duplicate alias: got %v, want InvalidArgument", err)
+	}
+}
+
+func TestReadOptions(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{t: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	client := NewClient(WithClock(clock.Now))
+	key := datastore.NameKey("Item", "a", nil)
+	before := clock.Now()
+	clock.Advance(time.Minute)
+	if _, err := client.Put(ctx, key, &item{Name: "v1"}); err != nil {
+		t.Fatal(err)
+	}
+	v1 := clock.Now()
+	clock.Advance(time.Minute)
+	if _, err := client.Put(ctx, key, &item{Name: "v2"}); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Minute)
+	if err := client.Delete(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+
+	h := client.History(key)
+	if len(h) != 3 || !h[0].Time.Equal(v1) || h[1].Deleted() || !h[2].Deleted() {
+		t.Fatalf("got history %+v, want two writes and a deletion", h)
+	}
+	var x item
+	if err := datastore.LoadStruct(&x, h[1].Properties); err != nil || x.Name != "v2" {
+		t.Errorf("second version: got %+v, %v", x, err)
+	}
+
+	c := client.WithReadOptions(datastore.ReadTime(v1))
+	if err := c.Get(ctx, key, &x); err != nil || x.Name != "v1" {
+		t.Errorf("Get at read time: got %+v, %v; want v1", x, err)
+	}
+	var got []item
+	if _, err := c.GetAll(ctx, datastore.NewQuery("Item"), &got); err != nil || len(got) != 1 || got[0].Name != "v1" {
+		t.Errorf("GetAll at read time: got %+v, %v; want v1", got, err)
+	}
+	if _, err := c.GetAll(ctx, datastore.NewQuery("Item").EventualConsistency(), nil); err == nil {
+		t.Error("got nil error for an eventually consistent query with a read time")
+	}
+	client.WithReadOptions(datastore.ReadTime(before))
+	if err := c.Get(ctx, key, &x); err != datastore.ErrNoSuchEntity {
+		t.Errorf("Get before the first write: got %v, want ErrNoSuchEntity", err)
+	}
+	client.WithReadOptions(datastore.ReadTime(time.Time{}))
+	if err := c.Get(ctx, key, &x); err != datastore.ErrNoSuchEntity {
+		t.Errorf("Get of current state: got %v, want ErrNoSuchEntity", err)
+	}
+
+	tx, err := client.NewTransaction(ctx, datastore.ReadOnly, datastore.WithReadTime(v1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Get(key, &x); err != nil || x.Name != "v1" {
+		t.Errorf("transaction Get at read time: got %+v, %v; want v1", x, err)
+	}
+	if _, err := tx.Commit(); err != nil {
+		t.Errorf("read-only Commit: %v", err)
+	}
+}
+
+func TestNamespaces(t *testing.T) {
+	ctx := context.Background()
+	client := NewClient()
+	put := func(ns, kind, name string, x *item) {
+		t.Helper()
+		k := datastore.NameKey(kind, name, nil)
+		k.Namespace = ns
+		if _, err := client.Put(ctx, k, x); err != nil {
+			t.Fatal(err)
+		}
+	}
+	put("", "Item", "a", &item{Name: "default"})
+	put("tenant-a", "Item", "a", &item{Name: "tenant-a"})
+	put("tenant-a", "Other", "o", &item{})
+	put("tenant-b", "Item", "a", &item{Name: "tenant-b"})
+
+	for _, ns := range []string{"", "tenant-a", "tenant-b"} {
+		k := datastore.NameKey("Item", "a", nil)
+		k.Namespace = ns
+		var x item
+		if err := client.Get(ctx, k, &x); err != nil {
+			t.Fatal(err)
+		}
+		var got []item
+		if _, err := client.GetAll(ctx, datastore.NewQuery("Item").Namespace(ns), &got); err != nil {
+			t.Fatal(err)
+		}
+		want := ns
+		if want == "" {
+			want = "default"
+		}
+		if x.Name != want || len(got) != 1 || got[0].Name != want {
+			t.Errorf("namespace %q: got %q and %v, want only %q", ns, x.Name, got, want)
+		}
+	}
+
+	keyNames := func(q *datastore.Query) []string {
+		t.Helper()
+		keys, err := client.GetAll(ctx, q.KeysOnly(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, k := range keys {
+			if k.ID != 0 {
+				names = append(names, fmt.Sprint(k.ID))
+			} else {
+				names = append(names, k.Name)
+			}
+		}
+		return names
+	}
+	if got, want := keyNames(datastore.NewQuery("__namespace__")), []string{"1", "tenant-a", "tenant-b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("namespaces: got %v, want %v", got, want)
+	}
+	start := datastore.NameKey("__namespace__", "tenant-b", nil)
+	if got, want := keyNames(datastore.NewQuery("__namespace__").Filter("__key__ >=", start)), []string{"tenant-b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("namespaces from tenant-b: got %v, want %v", got, want)
+	}
+	if got, want := keyNames(datastore.NewQuery("__kind__").Namespace("tenant-a")), []string{"Item", "Other"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("kinds in tenant-a: got %v, want %v", got, want)
+	}
+
+	// Keys and ancestor queries may not cross namespaces.
+	parent := datastore.NameKey("Parent", "p", nil)
+	parent.Namespace = "tenant-a"
+	child := datastore.NameKey("Item", "c", parent)
+	child.Namespace = "tenant-b"
+	if _, err := client.Put(ctx, child, &item{}); err != datastore.ErrInvalidKey {
+		t.Errorf("cross-namespace parent: got %v, want ErrInvalidKey", err)
+	}
+	_, err := client.GetAll(ctx, datastore.NewQuery("Item").Ancestor(parent).Namespace("tenant-b"), nil)
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("cross-namespace ancestor query: got %v, want InvalidArgument", err)
+	}
+}
+
+func TestEntityGroupLimits(t *testing.T) {
+	ctx := context.Background()
+	clock := &fakeClock{t: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	client := NewClient(WithClock(clock.Now), WithEntityGroupLimits(EntityGroupLimits{
+		MaxEntityGroups: 2,
+		MaxMutations:    3,
+		WritesPerSecond: 1,
+	}))
+	root := datastore.NameKey("Counter", "c", nil)
+	child := datastore.NameKey("Shard", "s", root)
+
+	if _, err := client.Put(ctx, root, &item{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Put(ctx, child, &item{}); status.Code(err) != codes.Aborted {
+		t.Errorf("second write to group: got %v, want Aborted", err)
+	}
+	if _, err := client.Put(ctx, datastore.NameKey("Counter", "d", nil), &item{}); err != nil {
+		t.Errorf("write to another group: %v", err)
+	}
+	clock.Advance(time.Second)
+	if _, err := client.Put(ctx, child, &item{}); err != nil {
+		t.Errorf("write after a second: %v", err)
+	}
+	_, err := client.RunInTransaction(ctx, func(tx dsiface.Transaction) error {
+		_, err := tx.Put(root, &item{})
+		return err
+	})
+	if err != datastore.ErrConcurrentTransaction {
+		t.Errorf("contended transaction: got %v, want ErrConcurrentTransaction", err)
+	}
+
+	clock.Advance(time.Minute)
+	_, err = client.RunInTransaction(ctx, func(tx dsiface.Transaction) error {
+		for _, name := range []string{"c", "d", "e"} {
+			var x item
+			tx.Get(datastore.NameKey("Counter", name, nil), &x)
+		}
+		return nil
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("too many entity groups: got %v, want InvalidArgument", err)
+	}
+	_, err = client.RunInTransaction(ctx, func(tx dsiface.Transaction) error {
+		for i := 0; i < 4; i++ {
+			if _, err := tx.Put(datastore.IDKey("Shard", int64(i+1), root), &item{}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("too many mutations: got %v, want InvalidArgument", err)
+	}
+}
+
+func TestCursor(t *testing.T) {
+	ctx := context.Background()
+	client := NewClient()
+	for i := 0; i < 5; i++ {
+		if _, err := client.Put(ctx, datastore.IDKey("Item", int64(i+1), nil), &item{Count: i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	q := datastore.NewQuery("Item").Order("Count").Limit(2)
+	var got []int
+	var cursor datastore.Cursor
+	for {
+		it := client.Run(ctx, q.Start(cursor))
+		var n int
+		for {
+			var x item
+			_, err := it.Next(&x)
+			if err == iterator.Done {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, x.Count)
+			n++
+		}
+		if n == 0 {
+			break
+		}
+		var err error
+		if cursor, err = it.Cursor(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if want := []int{0, 1, 2, 3, 4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestTransaction(t *testing.T) {
+	ctx := context.Background()
+	client := NewClient()
+	key := datastore.NameKey("Item", "counter", nil)
+	if _, err := client.Put(ctx, key, &item{Count: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := client.NewTransaction(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var x item
+	if err := tx.Get(key, &x); err != nil {
+		t.Fatal(err)
+	}
+	// A concurrent write makes the transaction fail to commit.
+	if _, err := client.Put(ctx, key, &item{Count: 10}); err != nil {
+		t.Fatal(err)
+	}
+	x.Count++
+	if _, err := tx.Put(key, &x); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tx.Commit(); err != datastore.ErrConcurrentTransaction {
+		t.Fatalf("got %v, want ErrConcurrentTransaction", err)
+	}
+
+	var pk *datastore.PendingKey
+	cmt, err := client.RunInTransaction(ctx, func(tx dsiface.Transaction) error {
+		var x item
+		if err := tx.Get(key, &x); err != nil {
+			return err
+		}
+		x.Count++
+		if _, err := tx.Put(key, &x); err != nil {
+			return err
+		}
+		pk, err = tx.Put(datastore.IncompleteKey("Item", nil), &item{Name: "new"})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Get(ctx, key, &x); err != nil {
+		t.Fatal(err)
+	}
+	if x.Count != 11 {
+		t.Errorf("got count %d, want 11", x.Count)
+	}
+	newKey := cmt.Key(pk)
+	if newKey == nil || newKey.Incomplete() {
+		t.Fatalf("Commit.Key returned %v", newKey)
+	}
+	if err := client.Get(ctx, newKey, &x); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEventualConsistency(t *testing.T) {
+	ctx := context.Background()
+	clock := newFakeClock()
+	client := NewClient(WithClock(clock.Now), EventualConsistency(Consistency{Delay: time.Second}))
+
+	parent := datastore.NameKey("Parent", "p", nil)
+	key := datastore.NameKey("Item", "a", parent)
+	if _, err := client.Put(ctx, key, &item{Name: "a"}); err != nil {
+		t.Fatal(err)
+	}
+
+	count := func(q *datastore.Query) int {
+		n, err := client.Count(ctx, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	if n := count(datastore.NewQuery("Item")); n != 0 {
+		t.Errorf("global query before delay: got %d results, want 0", n)
+	}
+	if n := count(datastore.NewQuery("Item").Ancestor(parent)); n != 1 {
+		t.Errorf("ancestor query: got %d results, want 1", n)
+	}
+	var x item
+	if err := client.Get(ctx, key, &x); err != nil {
+		t.Errorf("Get: %v", err)
+	}
+
+	clock.Advance(time.Second)
+	if n := count(datastore.NewQuery("Item")); n != 1 {
+		t.Errorf("global query after delay: got %d results, want 1", n)
+	}
+
+	if err := client.Delete(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(datastore.NewQuery("Item")); n != 1 {
+		t.Errorf("global query after delete: got %d results, want 1", n)
+	}
+	if got := client.PendingWrites(); got != 1 {
+		t.Errorf("PendingWrites: got %d, want 1", got)
+	}
+	client.ApplyPendingWrites()
+	if n := count(datastore.NewQuery("Item")); n != 0 {
+		t.Errorf("global query after ApplyPendingWrites: got %d results, want 0", n)
+	}
+}
+
+func TestEventualConsistencyProbability(t *testing.T) {
+	ctx := context.Background()
+	client := NewClient(EventualConsistency(Consistency{Probability: 1}))
+	if _, err := client.Put(ctx, datastore.NameKey("Item", "a", nil), &item{}); err != nil {
+		t.Fatal(err)
+	}
+	n, err := client.Count(ctx, datastore.NewQuery("Item"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("got %d results, want 1", n)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	ctx := context.Background()
+	client := NewClient()
+
+	long := strings.Repeat("x", maxIndexedValueSize+1)
+	huge := strings.Repeat("x", maxEntitySize)
+	for _, test := range []struct {
+		desc  string
+		key   *datastore.Key
+		props datastore.PropertyList
+		code  codes.Code // codes.OK for client-side errors
+	}{
+		{"long indexed string", datastore.NameKey("Item", "a", nil), datastore.PropertyList{{Name: "S", Value: long}}, codes.OK},
+		{"too many index entries", datastore.NameKey("Item", "a", nil), datastore.PropertyList{{Name: "A", Value: make([]interface{}, maxIndexedProperties+1)}}, codes.OK},
+		{"duplicate property", datastore.NameKey("Item", "a", nil), datastore.PropertyList{{Name: "A", Value: 1}, {Name: "A", Value: 2}}, codes.OK},
+		{"entity too big", datastore.NameKey("Item", "a", nil), datastore.PropertyList{{Name: "S", Value: huge, NoIndex: true}}, codes.InvalidArgument},
+		{"reserved kind", datastore.NameKey("__Item__", "a", nil), nil, codes.InvalidArgument},
+		{"invalid namespace", &datastore.Key{Kind: "Item", Name: "a", Namespace: "no spaces"}, nil, codes.InvalidArgument},
+	} {
+		keys := []*datastore.Key{datastore.NameKey("Item", "ok", nil), test.key}
+		src := []datastore.PropertyList{{{Name: "A", Value: 1}}, test.props}
+		_, err := client.PutMulti(ctx, keys, src)
+		me, ok := err.(datastore.MultiError)
+		if !ok {
+			t.Errorf("%s: got %v, want MultiError", test.desc, err)
+			continue
+		}
+		if me[0] != nil || me[1] == nil {
+			t.Errorf("%s: got %v, want error for second key only", test.desc, me)
+			continue
+		}
+		if got := status.Code(me[1]); got != test.code && test.code != codes.OK {
+			t.Errorf("%s: got code %v, want %v", test.desc, got, test.code)
+		}
+	}
+
+	if _, err := client.PutMulti(ctx, []*datastore.Key{datastore.NameKey("Item", "ok", nil)}, []datastore.PropertyList{{{Name: "S", Value: long, NoIndex: true}}}); err != nil {
+		t.Errorf("unindexed long string: %v", err)
+	}
+
+	keys := make([]*datastore.Key, maxWriteBatch+1)
+	for i := range keys {
+		keys[i] = datastore.IDKey("Item", int64(i+1), nil)
+	}
+	if err := client.DeleteMulti(ctx, keys); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("oversized batch: got %v, want InvalidArgument", err)
+	}
+	if n, err := client.Count(ctx, datastore.NewQuery("Item")); err != nil || n != 1 {
+		t.Errorf("Count: got %d, %v; want 1 entity", n, err)
+	}
+}
+
+func TestDecodeMutation(t *testing.T) {
+	key := datastore.NameKey("Item", "a", nil)
+	dm, err := DecodeMutation(datastore.NewInsert(key, &item{Name: "a", Count: 2}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &DecodedMutation{
+		Op:  OpInsert,
+		Key: key,
+		Properties: []datastore.Property{
+			{Name: "Count", Value: int64(2)},
+			{Name: "Name", Value: "a"},
+		},
+	}
+	if !reflect.DeepEqual(dm, want) {
+		t.Errorf("got %+v, want %+v", dm, want)
+	}
+
+	dm, err = DecodeMutation(datastore.NewDelete(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dm.Op != OpDelete || !dm.Key.Equal(key) || dm.Properties != nil {
+		t.Errorf("got %+v, want delete of %v", dm, key)
+	}
+
+	if _, err := DecodeMutation(datastore.NewUpdate(datastore.IncompleteKey("Item", nil), &item{})); err == nil {
+		t.Error("got nil error for invalid mutation")
+	}
+}
+
+func TestMutate(t *testing.T) {
+	ctx := context.Background()
+	client := NewClient()
+	a := datastore.NameKey("Item", "a", nil)
+	b := datastore.NameKey("Item", "b", nil)
+
+	keys, err := client.Mutate(ctx,
+		datastore.NewInsert(a, &item{Name: "a"}),
+		datastore.NewUpsert(datastore.IncompleteKey("Item", nil), &item{Name: "new"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !keys[0].Equal(a) || keys[1].Incomplete() {
+		t.Errorf("got keys %v", keys)
+	}
+
+	_, err = client.Mutate(ctx, datastore.NewInsert(b, &item{Name: "b"}), datastore.NewInsert(a, &item{}))
+	if status.Code(err) != codes.AlreadyExists {
+		t.Errorf("insert of existing key: got %v, want AlreadyExists", err)
+	}
+	var x item
+	if err := client.Get(ctx, b, &x); err != datastore.ErrNoSuchEntity {
+		t.Errorf("failed Mutate was not atomic: got %v", err)
+	}
+
+	if _, err := client.Mutate(ctx, datastore.NewUpdate(b, &item{})); status.Code(err) != codes.NotFound {
+		t.Errorf("update of missing key: got %v, want NotFound", err)
+	}
+
+	if _, err := client.Mutate(ctx, datastore.NewUpdate(a, &item{Name: "a2"}), datastore.NewDelete(keys[1])); err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := client.Count(ctx, datastore.NewQuery("Item")); n != 1 {
+		t.Errorf("got %d entities, want 1", n)
+	}
+
+	_, err = client.RunInTransaction(ctx, func(tx dsiface.Transaction) error {
+		pks, err := tx.Mutate(datastore.NewDelete(a), datastore.NewInsert(a, &item{Name: "a3"}))
+		if err != nil {
+			return err
+		}
+		if pks[0] != nil || pks[1] == nil {
+			t.Errorf("got pending keys %v", pks)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Get(ctx, a, &x); err != nil || x.Name != "a3" {
+		t.Errorf("got %+v, %v; want a3", x, err)
+	}
+}
+
+func TestAllocateIDs(t *testing.T) {
+	ctx := context.Background()
+	client := NewClient()
+
+	if err := client.ReserveIDs(ctx, []*datastore.Key{datastore.IDKey("Item", 2, nil)}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Put(ctx, datastore.IDKey("Item", 3, nil), &item{}); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := client.AllocateIDs(ctx, []*datastore.Key{datastore.IncompleteKey("Item", nil), datastore.IncompleteKey("Item", nil)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := client.Put(ctx, datastore.IncompleteKey("Item", nil), &item{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := []int64{keys[0].ID, keys[1].ID, key.ID}, []int64{1, 4, 5}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got IDs %v, want %v", got, want)
+	}
+
+	if _, err := client.AllocateIDs(ctx, []*datastore.Key{datastore.IDKey("Item", 9, nil)}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("AllocateIDs of complete key: got %v, want InvalidArgument", err)
+	}
+}
+
+func TestScatteredIDsAreDeterministic(t *testing.T) {
+	ctx := context.Background()
+	ids := func() []int64 {
+		client := NewClient(WithIDPolicy(ScatteredIDs), WithSeed(42))
+		var ids []int64
+		for i := 0; i < 3; i++ {
+			k, err := client.Put(ctx, datastore.IncompleteKey("Item", nil), &item{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if k.ID <= 0 || k.ID >= maxScatteredID {
+				t.Errorf("ID %d out of range", k.ID)
+			}
+			ids = append(ids, k.ID)
+		}
+		return ids
+	}
+	if a, b := ids(), ids(); !reflect.DeepEqual(a, b) {
+		t.Errorf("got different IDs for the same seed: %v and %v", a, b)
+	}
+}
+
+func TestFixture(t *testing.T) {
+	ctx := context.Background()
+	client := NewClient(EventualConsistency(Consistency{}))
+	if err := client.LoadFixtureFile("testdata/fixture.yaml"); err != nil {
+		t.Fatal(err)
+	}
+
+	var x item
+	if err := client.Get(ctx, datastore.NameKey("Item", "a", nil), &x); err != nil {
+		t.Fatal(err)
+	}
+	if want := (item{Name: "a", Count: 3, Tags: []string{"red", "blue"}}); !reflect.DeepEqual(x, want) {
+		t.Errorf("got %+v, want %+v", x, want)
+	}
+	var pl datastore.PropertyList
+	key := datastore.IDKey("Item", 5, datastore.NameKey("Parent", "p", nil))
+	key.Namespace, key.Parent.Namespace = "tenant", "tenant"
+	if err := client.Get(ctx, key, &pl); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := client.Count(ctx, datastore.NewQuery("Item")); err != nil || n != 1 {
+		t.Errorf("Count: got %d, %v; want fixture entities to be visible", n, err)
+	}
+
+	// Dumping and reloading the fixture preserves the contents.
+	var buf bytes.Buffer
+	if err := client.DumpFixture().WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	f, err := ReadFixture(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other := NewClient()
+	if err := other.LoadFixture(f); err != nil {
+		t.Fatal(err)
+	}
+	var buf2 bytes.Buffer
+	if err := other.DumpFixture().WriteJSON(&buf2); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != buf2.String() {
+		t.Errorf("round trip changed the fixture:\n%s\n%s", buf.String(), buf2.String())
+	}
+
+	// Values must have exactly one type.
+	f, err = ReadFixture(strings.NewReader(`entities: [{key: {path: [{kind: K, name: k}]}, properties: {P: {string: a, integer: 1}}}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := NewClient().LoadFixture(f); err == nil {
+		t.Error("got nil error for a value with two types")
+	}
+}
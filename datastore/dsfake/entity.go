@@ -0,0 +1,385 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dsfake
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/datastore"
+)
+
+// entity is a stored entity.
+type entity struct {
+	key   *datastore.Key
+	props []datastore.Property
+}
+
+// keyString returns a string that uniquely identifies k, including its
+// namespace.
+func keyString(k *datastore.Key) string {
+	return k.Namespace + "\x00" + k.String()
+}
+
+// validKey reports whether k is a valid key. Incomplete keys are valid only
+// when allowIncomplete is true.
+func validKey(k *datastore.Key, allowIncomplete bool) bool {
+	if k == nil || (!allowIncomplete && k.Incomplete()) {
+		return false
+	}
+	for ; k != nil; k = k.Parent {
+		if k.Kind == "" || (k.Name != "" && k.ID != 0) {
+			return false
+		}
+		if k.Parent != nil && (k.Parent.Incomplete() || k.Parent.Namespace != k.Namespace) {
+			return false
+		}
+	}
+	return true
+}
+
+// rootKey returns the root of k's ancestor path, which identifies its entity
+// group.
+func rootKey(k *datastore.Key) *datastore.Key {
+	for k.Parent != nil {
+		k = k.Parent
+	}
+	return k
+}
+
+// hasAncestor reports whether ancestor is k or one of k's ancestors.
+func hasAncestor(k, ancestor *datastore.Key) bool {
+	for ; k != nil; k = k.Parent {
+		if k.Equal(ancestor) {
+			return true
+		}
+	}
+	return false
+}
+
+// cloneKey returns a deep copy of k.
+func cloneKey(k *datastore.Key) *datastore.Key {
+	if k == nil {
+		return nil
+	}
+	c := *k
+	c.Parent = cloneKey(k.Parent)
+	return &c
+}
+
+// saveEntity converts src, which must be a struct pointer or implement
+// datastore.PropertyLoadSaver, to properties.
+func saveEntity(src interface{}) ([]datastore.Property, error) {
+	var (
+		props []datastore.Property
+		err   error
+	)
+	if pls, ok := src.(datastore.PropertyLoadSaver); ok {
+		props, err = pls.Save()
+	} else {
+		props, err = datastore.SaveStruct(src)
+	}
+	if err != nil {
+		return nil, err
+	}
+	out := make([]datastore.Property, len(props))
+	for i, p := range props {
+		v, err := normalizeValue(p.Value)
+		if err != nil {
+			return nil, fmt.Errorf("datastore: property %q: %v", p.Name, err)
+		}
+		out[i] = datastore.Property{Name: p.Name, Value: v, NoIndex: p.NoIndex}
+	}
+	return out, nil
+}
+
+// loadEntity loads a copy of props, and the key if dst wants it, into dst.
+func loadEntity(dst interface{}, k *datastore.Key, props []datastore.Property) error {
+	props = cloneProperties(props)
+	if pls, ok := dst.(datastore.PropertyLoadSaver); ok {
+		err := pls.Load(props)
+		if kl, ok := dst.(datastore.KeyLoader); ok && err == nil {
+			err = kl.LoadKey(cloneKey(k))
+		}
+		return err
+	}
+	return datastore.LoadStruct(dst, props)
+}
+
+// normalizeValue converts v to the canonical type that the datastore service
+// would return for it, or reports an error if v cannot be stored.
+func normalizeValue(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case nil, int64, bool, string, float64, []byte:
+		return v, nil
+	case int:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case float32:
+		return float64(v), nil
+	case *datastore.Key:
+		if v == nil {
+			return nil, nil
+		}
+		return cloneKey(v), nil
+	case datastore.GeoPoint:
+		if !v.Valid() {
+			return nil, fmt.Errorf("invalid GeoPoint value")
+		}
+		return v, nil
+	case time.Time:
+		return v.Truncate(time.Microsecond), nil
+	case *datastore.Entity:
+		if v == nil {
+			return nil, nil
+		}
+		e := &datastore.Entity{Key: cloneKey(v.Key), Properties: make([]datastore.Property, len(v.Properties))}
+		for i, p := range v.Properties {
+			pv, err := normalizeValue(p.Value)
+			if err != nil {
+				return nil, err
+			}
+			e.Properties[i] = datastore.Property{Name: p.Name, Value: pv, NoIndex: p.NoIndex}
+		}
+		return e, nil
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, e := range v {
+			if _, ok := e.([]interface{}); ok {
+				return nil, fmt.Errorf("nested slices are not supported")
+			}
+			ev, err := normalizeValue(e)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = ev
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("invalid Value type %T", v)
+	}
+}
+
+// cloneProperties returns a deep copy of props.
+func cloneProperties(props []datastore.Property) []datastore.Property {
+	if props == nil {
+		return nil
+	}
+	out := make([]datastore.Property, len(props))
+	for i, p := range props {
+		out[i] = datastore.Property{Name: p.Name, Value: cloneValue(p.Value), NoIndex: p.NoIndex}
+	}
+	return out
+}
+
+func cloneValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case []byte:
+		return append([]byte(nil), v...)
+	case *datastore.Key:
+		return cloneKey(v)
+	case *datastore.Entity:
+		return &datastore.Entity{Key: cloneKey(v.Key), Properties: cloneProperties(v.Properties)}
+	case []interface{}:
+		out := make([]interface{}, len(v))
+		for i, e := range v {
+			out[i] = cloneValue(e)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// indexedValues returns the indexed values of the named property, expanding
+// array values and descending into entity values for dotted names. It
+// reports false if the entity has no such indexed property.
+func indexedValues(props []datastore.Property, name string) ([]interface{}, bool) {
+	var (
+		vals  []interface{}
+		found bool
+	)
+	for _, p := range props {
+		switch {
+		case p.Name == name:
+			if p.NoIndex {
+				continue
+			}
+			if arr, ok := p.Value.([]interface{}); ok {
+				vals = append(vals, arr...)
+				found = found || len(arr) > 0
+				continue
+			}
+			vals = append(vals, p.Value)
+			found = true
+		case strings.HasPrefix(name, p.Name+"."):
+			for _, v := range expand(p.Value) {
+				if e, ok := v.(*datastore.Entity); ok && e != nil {
+					sub, ok := indexedValues(e.Properties, name[len(p.Name)+1:])
+					vals = append(vals, sub...)
+					found = found || ok
+				}
+			}
+		}
+	}
+	return vals, found
+}
+
+func expand(v interface{}) []interface{} {
+	if arr, ok := v.([]interface{}); ok {
+		return arr
+	}
+	return []interface{}{v}
+}
+
+// typeRank orders values of different types the way the datastore service
+// does.
+func typeRank(v interface{}) int {
+	switch v.(type) {
+	case nil:
+		return 0
+	case int64:
+		return 1
+	case time.Time:
+		return 2
+	case bool:
+		return 3
+	case []byte:
+		return 4
+	case string:
+		return 5
+	case float64:
+		return 6
+	case datastore.GeoPoint:
+		return 7
+	case *datastore.Key:
+		return 8
+	default:
+		return 9
+	}
+}
+
+// compareValues returns -1, 0 or 1 depending on whether a sorts before, equal
+// to or after b. Both values must already be normalized.
+func compareValues(a, b interface{}) int {
+	if ra, rb := typeRank(a), typeRank(b); ra != rb {
+		return compareInts(int64(ra), int64(rb))
+	}
+	switch a := a.(type) {
+	case int64:
+		return compareInts(a, b.(int64))
+	case time.Time:
+		bt := b.(time.Time)
+		switch {
+		case a.Before(bt):
+			return -1
+		case a.After(bt):
+			return 1
+		}
+		return 0
+	case bool:
+		bb := b.(bool)
+		switch {
+		case a == bb:
+			return 0
+		case !a:
+			return -1
+		}
+		return 1
+	case []byte:
+		return bytes.Compare(a, b.([]byte))
+	case string:
+		return strings.Compare(a, b.(string))
+	case float64:
+		return compareFloats(a, b.(float64))
+	case datastore.GeoPoint:
+		bg := b.(datastore.GeoPoint)
+		if c := compareFloats(a.Lat, bg.Lat); c != 0 {
+			return c
+		}
+		return compareFloats(a.Lng, bg.Lng)
+	case *datastore.Key:
+		return compareKeys(a, b.(*datastore.Key))
+	case nil:
+		return 0
+	}
+	if reflect.DeepEqual(a, b) {
+		return 0
+	}
+	return -1
+}
+
+func compareInts(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// compareKeys orders keys by namespace and then by path, comparing each
+// element's kind and then its identifier, with numeric IDs before names.
+func compareKeys(a, b *datastore.Key) int {
+	if c := strings.Compare(a.Namespace, b.Namespace); c != 0 {
+		return c
+	}
+	pa, pb := keyPath(a), keyPath(b)
+	for i := 0; i < len(pa) && i < len(pb); i++ {
+		ea, eb := pa[i], pb[i]
+		if c := strings.Compare(ea.Kind, eb.Kind); c != 0 {
+			return c
+		}
+		switch {
+		case ea.Name == "" && eb.Name != "":
+			return -1
+		case ea.Name != "" && eb.Name == "":
+			return 1
+		case ea.Name != "":
+			if c := strings.Compare(ea.Name, eb.Name); c != 0 {
+				return c
+			}
+		default:
+			if c := compareInts(ea.ID, eb.ID); c != 0 {
+				return c
+			}
+		}
+	}
+	return compareInts(int64(len(pa)), int64(len(pb)))
+}
+
+// keyPath returns the elements of k's path from the root.
+func keyPath(k *datastore.Key) []*datastore.Key {
+	var path []*datastore.Key
+	for ; k != nil; k = k.Parent {
+		path = append([]*datastore.Key{k}, path...)
+	}
+	return path
+}
@@ -0,0 +1,134 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dsfake
+
+import (
+	"math"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// EntityGroupLimits configures the enforcement of the limits of transactions
+// and entity groups. An entity group is an entity together with all of its
+// descendants. Zero fields are not enforced.
+type EntityGroupLimits struct {
+	// MaxEntityGroups is the maximum number of entity groups that a
+	// transaction may read or write. The service's limit is 25.
+	MaxEntityGroups int
+
+	// MaxMutations is the maximum number of writes in a transaction. The
+	// service's limit is 500.
+	MaxMutations int
+
+	// WritesPerSecond is the sustained rate of commits to a single entity
+	// group. Commits above the rate fail with contention: transactions with
+	// datastore.ErrConcurrentTransaction, and other writes with code
+	// Aborted. The service supports about one write per second per entity
+	// group. Time is read from the Client's clock.
+	WritesPerSecond float64
+
+	// Burst is the number of commits to an entity group that may be made at
+	// once, before the rate applies. If Burst is zero, it is one.
+	Burst int
+}
+
+// DefaultEntityGroupLimits are the limits of the service.
+var DefaultEntityGroupLimits = EntityGroupLimits{
+	MaxEntityGroups: 25,
+	MaxMutations:    500,
+	WritesPerSecond: 1,
+}
+
+// WithEntityGroupLimits returns an Option that enforces limits on
+// transactions and on the write rate of entity groups. Fixtures are loaded
+// regardless of the limits.
+func WithEntityGroupLimits(limits EntityGroupLimits) Option {
+	return func(c *Client) {
+		c.groupLimits = &limits
+	}
+}
+
+// writeTokens is a token bucket limiting the commits to an entity group.
+type writeTokens struct {
+	tokens float64
+	last   time.Time
+}
+
+var errContention = status.Error(codes.Aborted, "too much contention on these datastore entities. please try again.")
+
+// checkEntityGroupsLocked reports an error if committing writes would exceed
+// the configured limits, and otherwise counts the commit against the write
+// rate of the entity groups it writes. For transactions, readGroups are the
+// entity groups read by the transaction, by keyString of their root keys.
+// c.mu must be held.
+func (c *Client) checkEntityGroupsLocked(writes []write, readGroups map[string]bool, tx bool) error {
+	l := c.groupLimits
+	if l == nil {
+		return nil
+	}
+	if tx && l.MaxMutations > 0 && len(writes) > l.MaxMutations {
+		return status.Errorf(codes.InvalidArgument, "a transaction may not contain more than %d mutations", l.MaxMutations)
+	}
+	groups := make(map[string]bool)
+	for g := range readGroups {
+		groups[g] = true
+	}
+	written := make(map[string]bool)
+	newGroups := 0 // each incomplete root key starts a new group
+	for _, w := range writes {
+		root := rootKey(w.key)
+		if root.Incomplete() {
+			newGroups++
+			continue
+		}
+		groups[keyString(root)] = true
+		written[keyString(root)] = true
+	}
+	if tx && l.MaxEntityGroups > 0 && len(groups)+newGroups > l.MaxEntityGroups {
+		return status.Errorf(codes.InvalidArgument, "operating on too many entity groups in a single transaction (limit %d)", l.MaxEntityGroups)
+	}
+	if l.WritesPerSecond <= 0 {
+		return nil
+	}
+	burst := float64(l.Burst)
+	if burst <= 0 {
+		burst = 1
+	}
+	now := c.now()
+	for g := range written {
+		wt := c.writeTokens[g]
+		if wt == nil {
+			wt = &writeTokens{tokens: burst, last: now}
+			c.writeTokens[g] = wt
+		}
+		if elapsed := now.Sub(wt.last).Seconds(); elapsed > 0 {
+			wt.tokens = math.Min(burst, wt.tokens+elapsed*l.WritesPerSecond)
+			wt.last = now
+		}
+		if wt.tokens < 1 {
+			if tx {
+				return datastore.ErrConcurrentTransaction
+			}
+			return errContention
+		}
+	}
+	for g := range written {
+		c.writeTokens[g].tokens--
+	}
+	return nil
+}
@@ -0,0 +1,374 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dsfake
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"sigs.k8s.io/yaml"
+)
+
+// A Fixture is a serializable set of entities, used to seed a Client and to
+// compare its contents with expected state. Fixtures are read from and written
+// to JSON or YAML documents of the following form:
+//
+//    entities:
+//    - key:
+//        namespace: tenant-a
+//        path:
+//        - {kind: Parent, name: p}
+//        - {kind: Item, id: 5}
+//      properties:
+//        Name: {string: widget}
+//        Count: {integer: 3}
+//        Created: {timestamp: "2020-01-01T00:00:00Z"}
+//        Location: {geoPoint: {lat: 52.5, lng: 13.4}}
+//        Owner: {key: {path: [{kind: User, name: alice}]}}
+//        Tags: {array: [{string: a}, {string: b}]}
+//        Details: {entity: {properties: {Color: {string: red}}}}
+//        Notes: {string: "...", noIndex: true}
+//        Deleted: {"null": true}
+//
+// YAML documents are read as YAML 1.1, in which unquoted null, y, n, yes, no,
+// on and off are not strings, so quote them where a string is meant.
+type Fixture struct {
+	Entities []*FixtureEntity `json:"entities"`
+}
+
+// FixtureEntity is an entity in a Fixture. Key may be omitted only for
+// entities nested in an entity value.
+type FixtureEntity struct {
+	Key        *FixtureKey             `json:"key,omitempty"`
+	Properties map[string]FixtureValue `json:"properties,omitempty"`
+}
+
+// FixtureKey is a key in a Fixture. The path is given from the root.
+type FixtureKey struct {
+	Namespace string               `json:"namespace,omitempty"`
+	Path      []FixturePathElement `json:"path"`
+}
+
+// FixturePathElement is an element of the path of a FixtureKey. At most one
+// of ID and Name may be set; neither is set for the last element of an
+// incomplete key, which is assigned an ID when it is loaded.
+type FixturePathElement struct {
+	Kind string `json:"kind"`
+	ID   int64  `json:"id,omitempty"`
+	Name string `json:"name,omitempty"`
+}
+
+// FixtureValue is a typed property value in a Fixture. Exactly one of the
+// value fields must be set.
+type FixtureValue struct {
+	Null      bool             `json:"null,omitempty"`
+	Boolean   *bool            `json:"boolean,omitempty"`
+	Integer   *int64           `json:"integer,omitempty"`
+	Double    *float64         `json:"double,omitempty"`
+	String    *string          `json:"string,omitempty"`
+	Blob      *[]byte          `json:"blob,omitempty"` // base64-encoded
+	Timestamp *time.Time       `json:"timestamp,omitempty"`
+	GeoPoint  *FixtureGeoPoint `json:"geoPoint,omitempty"`
+	Key       *FixtureKey      `json:"key,omitempty"`
+	Entity    *FixtureEntity   `json:"entity,omitempty"`
+	Array     *[]FixtureValue  `json:"array,omitempty"`
+
+	// NoIndex excludes the value, or every element of an array value, from
+	// indexes.
+	NoIndex bool `json:"noIndex,omitempty"`
+}
+
+// FixtureGeoPoint is a geographical point value in a Fixture.
+type FixtureGeoPoint struct {
+	Lat float64 `json:"lat"`
+	Lng float64 `json:"lng"`
+}
+
+// ReadFixture reads a Fixture from a JSON or YAML document.
+func ReadFixture(r io.Reader) (*Fixture, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	js, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("dsfake: reading fixture: %v", err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(js))
+	dec.DisallowUnknownFields()
+	var f Fixture
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("dsfake: reading fixture: %v", err)
+	}
+	return &f, nil
+}
+
+// WriteJSON writes f to w as indented JSON. Properties are sorted by name, so
+// the output is suitable for comparison with golden files.
+func (f *Fixture) WriteJSON(w io.Writer) error {
+	b, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// WriteYAML writes f to w as YAML. Properties are sorted by name, so the
+// output is suitable for comparison with golden files.
+func (f *Fixture) WriteYAML(w io.Writer) error {
+	b, err := yaml.Marshal(f)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// LoadFixtureFile reads the JSON or YAML fixture in the named file and loads
+// it into c.
+func (c *Client) LoadFixtureFile(filename string) error {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	f, err := ReadFixture(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("%s: %v", filename, err)
+	}
+	return c.LoadFixture(f)
+}
+
+// LoadFixture stores the entities of f in c, replacing existing entities with
+// the same keys, in a single commit. The entities are immediately visible to
+// all queries, regardless of the consistency configuration.
+func (c *Client) LoadFixture(f *Fixture) error {
+	writes := make([]write, len(f.Entities))
+	for i, fe := range f.Entities {
+		if fe.Key == nil {
+			return fmt.Errorf("dsfake: fixture entity %d has no key", i)
+		}
+		k, props, err := fe.decode()
+		if err != nil {
+			return fmt.Errorf("dsfake: fixture entity %d: %v", i, err)
+		}
+		if err := checkKey(k, true); err != nil {
+			return fmt.Errorf("dsfake: fixture entity %d: %v", i, err)
+		}
+		if err := checkEntity(k, props); err != nil {
+			return fmt.Errorf("dsfake: fixture entity %d: %v", i, err)
+		}
+		writes[i] = write{key: k, props: props}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return errClosed
+	}
+	for i := range writes {
+		writes[i].key = c.completeKeyLocked(writes[i].key)
+	}
+	c.commitLocked(writes)
+	if c.consistency != nil {
+		c.applyIndexUpdatesLocked(true)
+	}
+	return nil
+}
+
+// DumpFixture returns the committed entities of c, ordered by key.
+func (c *Client) DumpFixture() *Fixture {
+	c.mu.Lock()
+	ents := make([]*entity, 0, len(c.entities))
+	for _, e := range c.entities {
+		ents = append(ents, e)
+	}
+	c.mu.Unlock()
+	sort.Slice(ents, func(i, j int) bool {
+		return compareKeys(ents[i].key, ents[j].key) < 0
+	})
+	f := &Fixture{Entities: make([]*FixtureEntity, len(ents))}
+	for i, e := range ents {
+		f.Entities[i] = encodeFixtureEntity(e.key, e.props)
+	}
+	return f
+}
+
+func (fe *FixtureEntity) decode() (*datastore.Key, []datastore.Property, error) {
+	var (
+		k   *datastore.Key
+		err error
+	)
+	if fe.Key != nil {
+		if k, err = fe.Key.decode(); err != nil {
+			return nil, nil, err
+		}
+	}
+	names := make([]string, 0, len(fe.Properties))
+	for name := range fe.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	props := make([]datastore.Property, 0, len(names))
+	for _, name := range names {
+		fv := fe.Properties[name]
+		v, err := fv.decode()
+		if err != nil {
+			return nil, nil, fmt.Errorf("property %q: %v", name, err)
+		}
+		props = append(props, datastore.Property{Name: name, Value: v, NoIndex: fv.NoIndex})
+	}
+	return k, props, nil
+}
+
+func (fk *FixtureKey) decode() (*datastore.Key, error) {
+	if len(fk.Path) == 0 {
+		return nil, errors.New("key has an empty path")
+	}
+	var k *datastore.Key
+	for _, el := range fk.Path {
+		k = &datastore.Key{Kind: el.Kind, ID: el.ID, Name: el.Name, Parent: k, Namespace: fk.Namespace}
+	}
+	if !validKey(k, true) {
+		return nil, fmt.Errorf("invalid key %v", k)
+	}
+	return k, nil
+}
+
+func (fv FixtureValue) decode() (interface{}, error) {
+	var (
+		v interface{}
+		n int
+	)
+	set := func(x interface{}) {
+		v = x
+		n++
+	}
+	if fv.Null {
+		set(nil)
+	}
+	if fv.Boolean != nil {
+		set(*fv.Boolean)
+	}
+	if fv.Integer != nil {
+		set(*fv.Integer)
+	}
+	if fv.Double != nil {
+		set(*fv.Double)
+	}
+	if fv.String != nil {
+		set(*fv.String)
+	}
+	if fv.Blob != nil {
+		set(*fv.Blob)
+	}
+	if fv.Timestamp != nil {
+		set(*fv.Timestamp)
+	}
+	if fv.GeoPoint != nil {
+		set(datastore.GeoPoint{Lat: fv.GeoPoint.Lat, Lng: fv.GeoPoint.Lng})
+	}
+	if fv.Key != nil {
+		k, err := fv.Key.decode()
+		if err != nil {
+			return nil, err
+		}
+		set(k)
+	}
+	if fv.Entity != nil {
+		k, props, err := fv.Entity.decode()
+		if err != nil {
+			return nil, err
+		}
+		set(&datastore.Entity{Key: k, Properties: props})
+	}
+	if fv.Array != nil {
+		arr := make([]interface{}, len(*fv.Array))
+		for i, e := range *fv.Array {
+			if e.Array != nil {
+				return nil, errors.New("nested arrays are not supported")
+			}
+			ev, err := e.decode()
+			if err != nil {
+				return nil, err
+			}
+			arr[i] = ev
+		}
+		set(arr)
+	}
+	if n != 1 {
+		return nil, fmt.Errorf("value must have exactly one type, has %d", n)
+	}
+	return normalizeValue(v)
+}
+
+func encodeFixtureEntity(k *datastore.Key, props []datastore.Property) *FixtureEntity {
+	fe := &FixtureEntity{Properties: make(map[string]FixtureValue, len(props))}
+	if k != nil {
+		fe.Key = encodeFixtureKey(k)
+	}
+	for _, p := range props {
+		fv := encodeFixtureValue(p.Value)
+		fv.NoIndex = p.NoIndex
+		fe.Properties[p.Name] = fv
+	}
+	return fe
+}
+
+func encodeFixtureKey(k *datastore.Key) *FixtureKey {
+	fk := &FixtureKey{Namespace: k.Namespace}
+	for _, el := range keyPath(k) {
+		fk.Path = append(fk.Path, FixturePathElement{Kind: el.Kind, ID: el.ID, Name: el.Name})
+	}
+	return fk
+}
+
+func encodeFixtureValue(v interface{}) FixtureValue {
+	switch v := v.(type) {
+	case bool:
+		return FixtureValue{Boolean: &v}
+	case int64:
+		return FixtureValue{Integer: &v}
+	case float64:
+		return FixtureValue{Double: &v}
+	case string:
+		return FixtureValue{String: &v}
+	case []byte:
+		b := append([]byte{}, v...)
+		return FixtureValue{Blob: &b}
+	case time.Time:
+		t := v.UTC()
+		return FixtureValue{Timestamp: &t}
+	case datastore.GeoPoint:
+		return FixtureValue{GeoPoint: &FixtureGeoPoint{Lat: v.Lat, Lng: v.Lng}}
+	case *datastore.Key:
+		return FixtureValue{Key: encodeFixtureKey(v)}
+	case *datastore.Entity:
+		return FixtureValue{Entity: encodeFixtureEntity(v.Key, v.Properties)}
+	case []interface{}:
+		arr := make([]FixtureValue, len(v))
+		for i, e := range v {
+			arr[i] = encodeFixtureValue(e)
+		}
+		return FixtureValue{Array: &arr}
+	}
+	return FixtureValue{Null: true}
+}
@@ -0,0 +1,88 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dsfake
+
+import (
+	"time"
+
+	"cloud.google.com/go/datastore"
+)
+
+// Version is a committed version of an entity.
+type Version struct {
+	// Time is the time of the commit, read from the Client's clock.
+	Time time.Time
+
+	// Properties are the properties of the entity. They are nil if the
+	// commit deleted the entity.
+	Properties []datastore.Property
+}
+
+// Deleted reports whether the commit deleted the entity.
+func (v Version) Deleted() bool {
+	return v.Properties == nil
+}
+
+// version is an entry of the history of an entity.
+type version struct {
+	time time.Time
+	e    *entity // nil for a deletion
+}
+
+// recordVersionLocked adds e, the entity committed at time now with the key
+// ks, to its history. c.mu must be held.
+func (c *Client) recordVersionLocked(ks string, e *entity, now time.Time) {
+	c.history[ks] = append(c.history[ks], version{time: now, e: e})
+}
+
+// History returns every version of the entity with the given key, oldest
+// first, including deletions. The number of versions is the number of times
+// the entity was written.
+func (c *Client) History(key *datastore.Key) []Version {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var vs []Version
+	for _, v := range c.history[keyString(key)] {
+		ver := Version{Time: v.time}
+		if v.e != nil {
+			ver.Properties = cloneProperties(v.e.props)
+		}
+		vs = append(vs, ver)
+	}
+	return vs
+}
+
+// entityAtLocked returns the entity with key ks as of time t, or nil. c.mu
+// must be held.
+func (c *Client) entityAtLocked(ks string, t time.Time) *entity {
+	h := c.history[ks]
+	for i := len(h) - 1; i >= 0; i-- {
+		if !h[i].time.After(t) {
+			return h[i].e
+		}
+	}
+	return nil
+}
+
+// snapshotLocked returns the entities as of time t. c.mu must be held.
+func (c *Client) snapshotLocked(t time.Time) map[string]*entity {
+	out := make(map[string]*entity)
+	for ks := range c.history {
+		if e := c.entityAtLocked(ks, t); e != nil {
+			out[ks] = e
+		}
+	}
+	return out
+}
@@ -0,0 +1,143 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dsfake
+
+import (
+	"context"
+	"math/rand"
+
+	"cloud.google.com/go/datastore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// IDPolicy determines how the Client chooses IDs for incomplete keys.
+type IDPolicy int
+
+const (
+	// SequentialIDs allocates increasing IDs starting at 1. It is the
+	// default.
+	SequentialIDs IDPolicy = iota
+
+	// ScatteredIDs allocates IDs that are spread across the range of
+	// positive 53-bit integers, like the datastore service does. The IDs are
+	// drawn from the Client's random source, so use WithSeed to make them
+	// deterministic.
+	ScatteredIDs
+)
+
+// maxScatteredID is the exclusive upper bound of scattered IDs.
+const maxScatteredID = 1 << 53
+
+// WithIDPolicy returns an Option that sets the policy for allocating IDs.
+func WithIDPolicy(p IDPolicy) Option {
+	return func(c *Client) {
+		c.idPolicy = p
+	}
+}
+
+// WithSeed returns an Option that seeds the Client's random source, which is
+// used for scattered IDs and probabilistic eventual consistency. Clients with
+// the same seed and the same sequence of calls behave identically.
+func WithSeed(seed int64) Option {
+	return func(c *Client) {
+		c.rand = rand.New(rand.NewSource(seed))
+	}
+}
+
+// allocateIDLocked returns an ID that has never been allocated, reserved or
+// used in a complete key. c.mu must be held.
+func (c *Client) allocateIDLocked() int64 {
+	for {
+		var id int64
+		switch c.idPolicy {
+		case ScatteredIDs:
+			id = c.rand.Int63n(maxScatteredID-1) + 1
+		default:
+			id = c.nextID
+			c.nextID++
+		}
+		if !c.usedIDs[id] {
+			c.usedIDs[id] = true
+			return id
+		}
+	}
+}
+
+// AllocateIDs returns complete keys for the incomplete keys. The IDs are
+// never returned again by AllocateIDs, or used for keys completed by Put,
+// PutMulti or Mutate.
+func (c *Client) AllocateIDs(ctx context.Context, keys []*datastore.Key) ([]*datastore.Key, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.checkLocked(ctx); err != nil {
+		return nil, err
+	}
+	if err := checkIDKeys(keys, true); err != nil {
+		return nil, err
+	}
+	ret := make([]*datastore.Key, len(keys))
+	for i, k := range keys {
+		ret[i] = c.completeKeyLocked(k)
+	}
+	return ret, nil
+}
+
+// ReserveIDs prevents the IDs of the complete keys from being allocated for
+// incomplete keys.
+func (c *Client) ReserveIDs(ctx context.Context, keys []*datastore.Key) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.checkLocked(ctx); err != nil {
+		return err
+	}
+	if err := checkIDKeys(keys, false); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		c.usedIDs[k.ID] = true
+	}
+	return nil
+}
+
+// checkIDKeys validates the keys of AllocateIDs, which must be incomplete,
+// and ReserveIDs, which must have numeric IDs.
+func checkIDKeys(keys []*datastore.Key, incomplete bool) error {
+	if err := checkBatch(len(keys), maxWriteBatch); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err := checkKey(k, true); err != nil {
+			return err
+		}
+		if incomplete && !k.Incomplete() {
+			return status.Errorf(codes.InvalidArgument, "key %v is complete", k)
+		}
+		if !incomplete && k.ID == 0 {
+			return status.Errorf(codes.InvalidArgument, "key %v does not have a numeric ID", k)
+		}
+	}
+	return nil
+}
+
+// recordIDLocked prevents the ID of k, if any, from being allocated. c.mu
+// must be held.
+func (c *Client) recordIDLocked(k *datastore.Key) {
+	for ; k != nil; k = k.Parent {
+		if k.ID != 0 {
+			c.usedIDs[k.ID] = true
+		}
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dsfake
+
+import (
+	"cloud.google.com/go/datastore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// The kinds of metadata queries.
+const (
+	namespaceKind = "__namespace__"
+	kindKind      = "__kind__"
+)
+
+// metadata returns the entities of the metadata kind of q, derived from
+// entities, and the query to run over them. For queries of other kinds, it
+// returns entities and q unchanged.
+//
+// The entities of a __namespace__ query have no properties, and have keys
+// named after the namespaces in use, except that the key of the default
+// namespace has ID 1. The entities of a __kind__ query have keys named after
+// the kinds in use in the query's namespace.
+func (q *query) metadata(entities map[string]*entity) (map[string]*entity, *query, error) {
+	if !reserved(q.kind) {
+		return entities, q, nil
+	}
+	out := make(map[string]*entity)
+	add := func(k *datastore.Key) {
+		out[keyString(k)] = &entity{key: k, props: []datastore.Property{}}
+	}
+	switch q.kind {
+	case namespaceKind:
+		// Namespace keys are in the default namespace, whatever the
+		// namespace of the query.
+		mq := *q
+		mq.namespace = ""
+		q = &mq
+		for _, e := range entities {
+			if e.key.Namespace == "" {
+				add(datastore.IDKey(namespaceKind, 1, nil))
+			} else {
+				add(datastore.NameKey(namespaceKind, e.key.Namespace, nil))
+			}
+		}
+	case kindKind:
+		for _, e := range entities {
+			if e.key.Namespace == q.namespace {
+				k := datastore.NameKey(kindKind, e.key.Kind, nil)
+				k.Namespace = q.namespace
+				add(k)
+			}
+		}
+	default:
+		return nil, nil, status.Errorf(codes.InvalidArgument, "dsfake: queries of kind %q are not supported", q.kind)
+	}
+	return out, q, nil
+}
@@ -0,0 +1,334 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dsfake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	pb "cloud.google.com/go/datastore/apiv1/datastorepb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MutationOp is the kind of change made by a datastore.Mutation.
+type MutationOp int
+
+// The operations of the datastore.Mutation constructors.
+const (
+	// OpInsert is the operation of datastore.NewInsert.
+	OpInsert MutationOp = iota + 1
+	// OpUpsert is the operation of datastore.NewUpsert.
+	OpUpsert
+	// OpUpdate is the operation of datastore.NewUpdate.
+	OpUpdate
+	// OpDelete is the operation of datastore.NewDelete.
+	OpDelete
+)
+
+func (op MutationOp) String() string {
+	switch op {
+	case OpInsert:
+		return "insert"
+	case OpUpsert:
+		return "upsert"
+	case OpUpdate:
+		return "update"
+	case OpDelete:
+		return "delete"
+	}
+	return fmt.Sprintf("MutationOp(%d)", int(op))
+}
+
+// DecodedMutation is the content of a datastore.Mutation, whose fields are
+// unexported.
+type DecodedMutation struct {
+	Op  MutationOp
+	Key *datastore.Key
+
+	// Properties are the properties of the entity to save, sorted by name. It
+	// is nil for OpDelete.
+	Properties []datastore.Property
+}
+
+// DecodeMutation returns the operation, key and entity of m. If m was created
+// with invalid arguments, DecodeMutation returns the error that the datastore
+// package recorded for it.
+func DecodeMutation(m *datastore.Mutation) (*DecodedMutation, error) {
+	if m == nil {
+		return nil, errors.New("dsfake: nil mutation")
+	}
+	v := reflect.ValueOf(m).Elem()
+	if err, _ := unexported(v, "err").Interface().(error); err != nil {
+		return nil, err
+	}
+	key, _ := unexported(v, "key").Interface().(*datastore.Key)
+	mut, _ := unexported(v, "mut").Interface().(*pb.Mutation)
+	if key == nil || mut == nil {
+		return nil, errors.New("dsfake: mutation was not created by the datastore package")
+	}
+	dm := &DecodedMutation{Key: cloneKey(key)}
+	var e *pb.Entity
+	switch op := mut.Operation.(type) {
+	case *pb.Mutation_Insert:
+		dm.Op, e = OpInsert, op.Insert
+	case *pb.Mutation_Upsert:
+		dm.Op, e = OpUpsert, op.Upsert
+	case *pb.Mutation_Update:
+		dm.Op, e = OpUpdate, op.Update
+	case *pb.Mutation_Delete:
+		dm.Op = OpDelete
+		return dm, nil
+	default:
+		return nil, fmt.Errorf("dsfake: unknown mutation operation %T", op)
+	}
+	props, err := protoToProperties(e)
+	if err != nil {
+		return nil, err
+	}
+	dm.Properties = props
+	return dm, nil
+}
+
+// decodeMutations decodes muts, reporting invalid mutations in a
+// datastore.MultiError like the datastore package does.
+func decodeMutations(muts []*datastore.Mutation) ([]*DecodedMutation, error) {
+	if err := checkBatch(len(muts), maxWriteBatch); err != nil {
+		return nil, err
+	}
+	dms := make([]*DecodedMutation, len(muts))
+	errs := make(datastore.MultiError, len(muts))
+	var failed bool
+	for i, m := range muts {
+		dm, err := DecodeMutation(m)
+		if err == nil {
+			err = checkKey(dm.Key, dm.Op == OpInsert || dm.Op == OpUpsert)
+		}
+		if err == nil && dm.Op != OpDelete {
+			err = checkEntity(dm.Key, dm.Properties)
+		}
+		if err != nil {
+			errs[i] = err
+			failed = true
+			continue
+		}
+		dms[i] = dm
+	}
+	if failed {
+		return nil, errs
+	}
+	return dms, nil
+}
+
+// mutationWrites converts decoded mutations to writes.
+func mutationWrites(dms []*DecodedMutation) []write {
+	writes := make([]write, len(dms))
+	for i, dm := range dms {
+		writes[i] = write{key: dm.Key, props: dm.Properties, op: dm.Op}
+		if dm.Op != OpDelete && writes[i].props == nil {
+			writes[i].props = []datastore.Property{}
+		}
+	}
+	return writes
+}
+
+// checkPreconditionsLocked reports an error if an insert in writes would
+// overwrite an entity, or an update would create one, taking earlier writes
+// in the same batch into account. c.mu must be held.
+func (c *Client) checkPreconditionsLocked(writes []write) error {
+	exists := make(map[string]bool)
+	for _, w := range writes {
+		if w.key.Incomplete() {
+			continue
+		}
+		ks := keyString(w.key)
+		found, ok := exists[ks]
+		if !ok {
+			found = c.entities[ks] != nil
+		}
+		switch {
+		case w.op == OpInsert && found:
+			return status.Errorf(codes.AlreadyExists, "entity already exists: %v", w.key)
+		case w.op == OpUpdate && !found:
+			return status.Errorf(codes.NotFound, "no entity to update: %v", w.key)
+		}
+		exists[ks] = w.props != nil
+	}
+	return nil
+}
+
+// Mutate applies one or more mutations atomically. It returns the keys of the
+// mutations, in the same order, with incomplete keys completed.
+//
+// If any of the mutations are invalid, Mutate returns a datastore.MultiError.
+// If an insert would overwrite an existing entity, or an update would create
+// one, Mutate returns an error with code AlreadyExists or NotFound and makes
+// no changes.
+func (c *Client) Mutate(ctx context.Context, muts ...*datastore.Mutation) ([]*datastore.Key, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.checkLocked(ctx); err != nil {
+		return nil, err
+	}
+	dms, err := decodeMutations(muts)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	for _, dm := range dms {
+		if dm.Key.Incomplete() {
+			continue
+		}
+		ks := keyString(dm.Key)
+		if seen[ks] {
+			return nil, status.Errorf(codes.InvalidArgument, "a non-transactional commit may not contain multiple mutations affecting the same entity: %v", dm.Key)
+		}
+		seen[ks] = true
+	}
+	writes := mutationWrites(dms)
+	if err := c.checkPreconditionsLocked(writes); err != nil {
+		return nil, err
+	}
+	if err := c.checkEntityGroupsLocked(writes, nil, false); err != nil {
+		return nil, err
+	}
+	ret := make([]*datastore.Key, len(writes))
+	for i := range writes {
+		writes[i].key = c.completeKeyLocked(writes[i].key)
+		ret[i] = cloneKey(writes[i].key)
+	}
+	c.commitLocked(writes)
+	return ret, nil
+}
+
+// Mutate is the transactional version of Client.Mutate. The mutations are
+// applied when the transaction commits, and Commit fails if any of their
+// preconditions do not hold then. The returned PendingKeys are nil for
+// deletions.
+func (t *transaction) Mutate(muts ...*datastore.Mutation) ([]*datastore.PendingKey, error) {
+	t.c.mu.Lock()
+	defer t.c.mu.Unlock()
+	if err := t.checkLocked(); err != nil {
+		return nil, err
+	}
+	dms, err := decodeMutations(muts)
+	if err != nil {
+		return nil, err
+	}
+	writes := mutationWrites(dms)
+	pks := make([]*datastore.PendingKey, len(writes))
+	for i, w := range writes {
+		if w.op == OpDelete {
+			t.writes = append(t.writes, w)
+			continue
+		}
+		pks[i] = t.bufferLocked([]write{w})[0]
+	}
+	return pks, nil
+}
+
+// protoToProperties converts the properties of e, sorted by name.
+func protoToProperties(e *pb.Entity) ([]datastore.Property, error) {
+	if e == nil {
+		return nil, nil
+	}
+	names := make([]string, 0, len(e.Properties))
+	for name := range e.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	props := make([]datastore.Property, 0, len(names))
+	for _, name := range names {
+		pv := e.Properties[name]
+		v, err := protoToValue(pv)
+		if err != nil {
+			return nil, fmt.Errorf("dsfake: property %q: %v", name, err)
+		}
+		noIndex := pv.ExcludeFromIndexes
+		if arr := pv.GetArrayValue(); arr != nil && len(arr.Values) > 0 {
+			noIndex = arr.Values[0].ExcludeFromIndexes
+		}
+		props = append(props, datastore.Property{Name: name, Value: v, NoIndex: noIndex})
+	}
+	return props, nil
+}
+
+func protoToValue(v *pb.Value) (interface{}, error) {
+	switch v := v.ValueType.(type) {
+	case *pb.Value_NullValue:
+		return nil, nil
+	case *pb.Value_BooleanValue:
+		return v.BooleanValue, nil
+	case *pb.Value_IntegerValue:
+		return v.IntegerValue, nil
+	case *pb.Value_DoubleValue:
+		return v.DoubleValue, nil
+	case *pb.Value_StringValue:
+		return v.StringValue, nil
+	case *pb.Value_BlobValue:
+		return v.BlobValue, nil
+	case *pb.Value_TimestampValue:
+		return time.Unix(v.TimestampValue.Seconds, int64(v.TimestampValue.Nanos)), nil
+	case *pb.Value_GeoPointValue:
+		return datastore.GeoPoint{Lat: v.GeoPointValue.Latitude, Lng: v.GeoPointValue.Longitude}, nil
+	case *pb.Value_KeyValue:
+		return protoToKey(v.KeyValue)
+	case *pb.Value_EntityValue:
+		props, err := protoToProperties(v.EntityValue)
+		if err != nil {
+			return nil, err
+		}
+		var k *datastore.Key
+		if v.EntityValue.Key != nil {
+			if k, err = protoToKey(v.EntityValue.Key); err != nil {
+				return nil, err
+			}
+		}
+		return &datastore.Entity{Key: k, Properties: props}, nil
+	case *pb.Value_ArrayValue:
+		arr := make([]interface{}, len(v.ArrayValue.Values))
+		for i, e := range v.ArrayValue.Values {
+			ev, err := protoToValue(e)
+			if err != nil {
+				return nil, err
+			}
+			arr[i] = ev
+		}
+		return arr, nil
+	}
+	return nil, fmt.Errorf("unknown value type %T", v.ValueType)
+}
+
+func protoToKey(p *pb.Key) (*datastore.Key, error) {
+	var k *datastore.Key
+	for _, el := range p.Path {
+		k = &datastore.Key{
+			Kind:      el.Kind,
+			ID:        el.GetId(),
+			Name:      el.GetName(),
+			Parent:    k,
+			Namespace: p.GetPartitionId().GetNamespaceId(),
+		}
+	}
+	if k == nil {
+		return nil, errors.New("empty key path")
+	}
+	return k, nil
+}
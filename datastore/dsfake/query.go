@@ -0,0 +1,512 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dsfake
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"cloud.google.com/go/datastore"
+	"github.com/googleapis/google-cloud-go-testing/datastore/dsiface"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const keyFieldName = "__key__"
+
+// query is the contents of a datastore.Query, whose fields are unexported.
+type query struct {
+	kind       string
+	ancestor   *datastore.Key
+	filters    []entityFilter
+	orders     []order
+	projection []string
+	distinct   bool
+	distinctOn []string
+	keysOnly   bool
+	eventual   bool
+	limit      int32
+	offset     int32
+	start, end []byte
+	namespace  string
+}
+
+// An entityFilter is a property or composite filter of a query.
+type entityFilter interface {
+	matches(e *entity) bool
+}
+
+// filter is a property filter.
+type filter struct {
+	field string
+	op    string // one of "<", "<=", "=", ">=", ">", "!=", "in", "not-in"
+	value interface{}
+}
+
+// compositeFilter is the conjunction or disjunction of filters.
+type compositeFilter struct {
+	or      bool
+	filters []entityFilter
+}
+
+type order struct {
+	field string
+	desc  bool
+}
+
+// inspectQuery extracts the contents of q.
+func inspectQuery(q *datastore.Query) (*query, error) {
+	if q == nil {
+		return nil, errors.New("datastore: nil query")
+	}
+	v := reflect.ValueOf(q).Elem()
+	if err, _ := unexported(v, "err").Interface().(error); err != nil {
+		return nil, err
+	}
+	out := &query{
+		kind:       unexported(v, "kind").String(),
+		ancestor:   unexported(v, "ancestor").Interface().(*datastore.Key),
+		projection: unexported(v, "projection").Interface().([]string),
+		distinct:   unexported(v, "distinct").Bool(),
+		distinctOn: unexported(v, "distinctOn").Interface().([]string),
+		keysOnly:   unexported(v, "keysOnly").Bool(),
+		eventual:   unexported(v, "eventual").Bool(),
+		limit:      int32(unexported(v, "limit").Int()),
+		offset:     int32(unexported(v, "offset").Int()),
+		start:      unexported(v, "start").Bytes(),
+		end:        unexported(v, "end").Bytes(),
+		namespace:  unexported(v, "namespace").String(),
+	}
+	for _, ef := range unexported(v, "filter").Interface().([]datastore.EntityFilter) {
+		f, err := convertFilter(ef)
+		if err != nil {
+			return nil, err
+		}
+		out.filters = append(out.filters, f)
+	}
+	ords := unexported(v, "order")
+	for i := 0; i < ords.Len(); i++ {
+		o := ords.Index(i)
+		out.orders = append(out.orders, order{
+			field: o.FieldByName("FieldName").String(),
+			desc:  o.FieldByName("Direction").Bool(),
+		})
+	}
+	return out, nil
+}
+
+// convertFilter converts a filter of a datastore.Query.
+func convertFilter(ef datastore.EntityFilter) (entityFilter, error) {
+	switch ef := ef.(type) {
+	case datastore.PropertyFilter:
+		if ef.FieldName == "" {
+			return nil, errors.New("datastore: empty query filter field name")
+		}
+		val, err := normalizeValue(ef.Value)
+		if err != nil {
+			return nil, fmt.Errorf("datastore: bad query filter value type: %v", err)
+		}
+		switch ef.Operator {
+		case "<", "<=", "=", ">=", ">", "!=":
+		case "in", "not-in":
+			if _, ok := val.([]interface{}); !ok {
+				return nil, status.Errorf(codes.InvalidArgument, "the %s operator requires an array value", ef.Operator)
+			}
+		default:
+			return nil, fmt.Errorf("datastore: invalid operator %q in filter", ef.Operator)
+		}
+		return filter{field: ef.FieldName, op: ef.Operator, value: val}, nil
+	case datastore.AndFilter:
+		return convertCompositeFilter(false, ef.Filters)
+	case datastore.OrFilter:
+		return convertCompositeFilter(true, ef.Filters)
+	}
+	return nil, fmt.Errorf("dsfake: unsupported filter type %T", ef)
+}
+
+func convertCompositeFilter(or bool, efs []datastore.EntityFilter) (entityFilter, error) {
+	cf := compositeFilter{or: or}
+	for _, ef := range efs {
+		f, err := convertFilter(ef)
+		if err != nil {
+			return nil, err
+		}
+		cf.filters = append(cf.filters, f)
+	}
+	return cf, nil
+}
+
+// unexported returns the named field of the addressable struct v, in a form
+// that allows its value to be read.
+func unexported(v reflect.Value, name string) reflect.Value {
+	f := v.FieldByName(name)
+	return reflect.NewAt(f.Type(), unsafe.Pointer(f.UnsafeAddr())).Elem()
+}
+
+// result is a single query result.
+type result struct {
+	key   *datastore.Key
+	props []datastore.Property
+}
+
+// queryResults are the results of a query, after cursors, offset and limit
+// have been applied.
+type queryResults struct {
+	results  []result
+	keysOnly bool
+	start    int // position of the first result in the full result set
+}
+
+// runQuery runs q against the fake's current state.
+func (c *Client) runQuery(ctx context.Context, q *datastore.Query) (*queryResults, error) {
+	qi, err := inspectQuery(q)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.checkReadLocked(ctx, qi.eventual); err != nil {
+		return nil, err
+	}
+	var view map[string]*entity
+	if !c.readTime.IsZero() {
+		view = c.snapshotLocked(c.readTime)
+	} else {
+		view = c.queryViewLocked(qi.ancestor != nil && !qi.eventual)
+	}
+	entities, qi, err := qi.metadata(view)
+	if err != nil {
+		return nil, err
+	}
+	return qi.run(entities)
+}
+
+// run runs q against entities.
+func (q *query) run(entities map[string]*entity) (*queryResults, error) {
+	if q.ancestor != nil && !validKey(q.ancestor, false) {
+		return nil, datastore.ErrInvalidKey
+	}
+	if !namespaceRE.MatchString(q.namespace) || reserved(q.namespace) {
+		return nil, status.Errorf(codes.InvalidArgument, "namespace %q is not valid", q.namespace)
+	}
+	if q.ancestor != nil && q.ancestor.Namespace != q.namespace {
+		return nil, status.Errorf(codes.InvalidArgument, "the ancestor key is in namespace %q, but the query is in namespace %q", q.ancestor.Namespace, q.namespace)
+	}
+	var all []result
+	for _, e := range entities {
+		if !q.matches(e) {
+			continue
+		}
+		all = append(all, result{key: e.key, props: e.props})
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return q.less(all[i], all[j])
+	})
+	if len(q.projection) > 0 {
+		all = q.project(all)
+	}
+
+	start, err := decodePosition(q.start)
+	if err != nil {
+		return nil, err
+	}
+	end := len(all)
+	if q.end != nil {
+		if end, err = decodePosition(q.end); err != nil {
+			return nil, err
+		}
+	}
+	if end > len(all) {
+		end = len(all)
+	}
+	start += int(q.offset)
+	if start > end {
+		start = end
+	}
+	if q.limit >= 0 && start+int(q.limit) < end {
+		end = start + int(q.limit)
+	}
+	res := &queryResults{keysOnly: q.keysOnly, start: start}
+	for _, r := range all[start:end] {
+		props := cloneProperties(r.props)
+		if q.keysOnly {
+			props = nil
+		}
+		res.results = append(res.results, result{key: cloneKey(r.key), props: props})
+	}
+	return res, nil
+}
+
+// matches reports whether e satisfies the kind, namespace, ancestor and
+// filters of q.
+func (q *query) matches(e *entity) bool {
+	if q.kind != "" && e.key.Kind != q.kind {
+		return false
+	}
+	if e.key.Namespace != q.namespace {
+		return false
+	}
+	if q.ancestor != nil && !hasAncestor(e.key, q.ancestor) {
+		return false
+	}
+	for _, f := range q.filters {
+		if !f.matches(e) {
+			return false
+		}
+	}
+	for _, o := range q.orders {
+		if o.field == keyFieldName {
+			continue
+		}
+		if _, ok := indexedValues(e.props, o.field); !ok {
+			return false
+		}
+	}
+	for _, p := range q.projection {
+		if _, ok := indexedValues(e.props, p); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// matches reports whether any indexed value of the filtered property of e
+// satisfies f.
+func (f filter) matches(e *entity) bool {
+	var vals []interface{}
+	if f.field == keyFieldName {
+		vals = []interface{}{e.key}
+	} else {
+		vals, _ = indexedValues(e.props, f.field)
+	}
+	for _, v := range vals {
+		if f.matchesValue(v) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f filter) matchesValue(v interface{}) bool {
+	switch f.op {
+	case "!=":
+		return compareValues(v, f.value) != 0
+	case "in", "not-in":
+		in := false
+		for _, x := range f.value.([]interface{}) {
+			if compareValues(v, x) == 0 {
+				in = true
+				break
+			}
+		}
+		return in == (f.op == "in")
+	case "=":
+		return compareValues(v, f.value) == 0
+	}
+	if typeRank(v) != typeRank(f.value) {
+		// Inequality filters only match values of the same type.
+		return false
+	}
+	c := compareValues(v, f.value)
+	switch f.op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">=":
+		return c >= 0
+	case ">":
+		return c > 0
+	}
+	return false
+}
+
+// matches reports whether e satisfies all, or for a disjunction any, of the
+// filters of f.
+func (f compositeFilter) matches(e *entity) bool {
+	for _, sub := range f.filters {
+		if sub.matches(e) == f.or {
+			return f.or
+		}
+	}
+	return !f.or
+}
+
+// less reports whether a sorts before b under the orders of q. Entities that
+// compare equal are ordered by key.
+func (q *query) less(a, b result) bool {
+	for _, o := range q.orders {
+		var c int
+		if o.field == keyFieldName {
+			c = compareKeys(a.key, b.key)
+		} else {
+			c = compareValues(sortValue(a, o), sortValue(b, o))
+		}
+		if o.desc {
+			c = -c
+		}
+		if c != 0 {
+			return c < 0
+		}
+	}
+	return compareKeys(a.key, b.key) < 0
+}
+
+// sortValue returns the value of r used to order it by o: the smallest value
+// of a multi-valued property in ascending order, and the largest in
+// descending order.
+func sortValue(r result, o order) interface{} {
+	vals, _ := indexedValues(r.props, o.field)
+	if len(vals) == 0 {
+		return nil
+	}
+	best := vals[0]
+	for _, v := range vals[1:] {
+		c := compareValues(v, best)
+		if (o.desc && c > 0) || (!o.desc && c < 0) {
+			best = v
+		}
+	}
+	return best
+}
+
+// project replaces the properties of each result with the projected
+// properties. A result with a multi-valued projected property is returned
+// once for each of its values, and duplicates are removed for distinct
+// queries.
+func (q *query) project(rs []result) []result {
+	var out []result
+	seen := make(map[string]bool)
+	for _, r := range rs {
+		rows := [][]datastore.Property{nil}
+		for _, name := range q.projection {
+			vals, _ := indexedValues(r.props, name)
+			var next [][]datastore.Property
+			for _, row := range rows {
+				for _, v := range vals {
+					next = append(next, append(row[:len(row):len(row)], datastore.Property{Name: name, Value: v}))
+				}
+			}
+			rows = next
+		}
+		for _, row := range rows {
+			if q.distinct || len(q.distinctOn) > 0 {
+				id := q.distinctKey(row)
+				if seen[id] {
+					continue
+				}
+				seen[id] = true
+			}
+			out = append(out, result{key: r.key, props: row})
+		}
+	}
+	return out
+}
+
+// distinctKey returns a string identifying the values of the distinct
+// properties in row.
+func (q *query) distinctKey(row []datastore.Property) string {
+	names := q.distinctOn
+	if len(names) == 0 {
+		names = q.projection
+	}
+	var b strings.Builder
+	for _, name := range names {
+		for _, p := range row {
+			if p.Name == name {
+				fmt.Fprintf(&b, "%T:%v;", p.Value, p.Value)
+			}
+		}
+	}
+	return b.String()
+}
+
+const cursorPrefix = "dsfake:"
+
+// encodePosition returns a cursor for position pos in a query's full result
+// set.
+func encodePosition(pos int) datastore.Cursor {
+	s := base64.URLEncoding.EncodeToString([]byte(cursorPrefix + strconv.Itoa(pos)))
+	c, err := datastore.DecodeCursor(s)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// decodePosition returns the position stored in a cursor created by
+// encodePosition.
+func decodePosition(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	s := string(b)
+	if !strings.HasPrefix(s, cursorPrefix) {
+		return 0, errors.New("dsfake: invalid cursor")
+	}
+	pos, err := strconv.Atoi(s[len(cursorPrefix):])
+	if err != nil || pos < 0 {
+		return 0, errors.New("dsfake: invalid cursor")
+	}
+	return pos, nil
+}
+
+// queryIterator implements dsiface.Iterator over precomputed query results.
+type queryIterator struct {
+	dsiface.Iterator
+	res *queryResults
+	i   int
+	err error
+}
+
+func newIterator(res *queryResults) *queryIterator {
+	return &queryIterator{res: res}
+}
+
+// Next returns the key of the next result and loads the entity into dst,
+// unless the query is keys-only or dst is nil. When there are no more
+// results, iterator.Done is returned.
+func (it *queryIterator) Next(dst interface{}) (*datastore.Key, error) {
+	if it.err != nil {
+		return nil, it.err
+	}
+	if it.i >= len(it.res.results) {
+		return nil, iterator.Done
+	}
+	r := it.res.results[it.i]
+	it.i++
+	if dst != nil && !it.res.keysOnly {
+		if err := loadEntity(dst, r.key, r.props); err != nil {
+			return cloneKey(r.key), err
+		}
+	}
+	return cloneKey(r.key), nil
+}
+
+// Cursor returns a cursor for the iterator's current location.
+func (it *queryIterator) Cursor() (datastore.Cursor, error) {
+	if it.err != nil {
+		return datastore.Cursor{}, it.err
+	}
+	return encodePosition(it.res.start + it.i), nil
+}
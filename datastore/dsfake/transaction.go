@@ -0,0 +1,291 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dsfake
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"time"
+
+	"cloud.google.com/go/datastore"
+	"github.com/googleapis/google-cloud-go-testing/datastore/dsiface"
+)
+
+var (
+	errExpiredTransaction  = errors.New("datastore: transaction expired")
+	errReadOnlyTransaction = errors.New("datastore: cannot modify entities in a read-only transaction")
+)
+
+// transaction implements dsiface.Transaction. Writes are buffered until
+// Commit, and reads observe the state committed before the transaction
+// started writing. Commit fails with datastore.ErrConcurrentTransaction if
+// any entity the transaction read or wrote was modified by another commit
+// since the transaction began.
+type transaction struct {
+	dsiface.Transaction
+	c        *Client
+	ctx      context.Context
+	startSeq int64
+	readOnly bool
+	readTime time.Time       // for reads, if not zero
+	touched  map[string]bool // keys read or written, by keyString
+	groups   map[string]bool // entity groups read, by keyString of their roots
+	writes   []write
+	pending  map[*datastore.PendingKey]int // index into writes
+	done     bool
+}
+
+// commit implements dsiface.Commit.
+type commit struct {
+	dsiface.Commit
+	keys map[*datastore.PendingKey]*datastore.Key
+}
+
+// transactionSettings are the decoded datastore.TransactionOptions.
+type transactionSettings struct {
+	attempts int
+	readOnly bool
+	readTime time.Time
+}
+
+// decodeTransactionOptions interprets opts. The option types of the datastore
+// package are unexported, so they are recognized by their kind.
+func decodeTransactionOptions(opts []datastore.TransactionOption) transactionSettings {
+	s := transactionSettings{attempts: 3}
+	var readTime time.Time
+	for _, o := range opts {
+		v := reflect.ValueOf(o)
+		switch {
+		case o == datastore.ReadOnly:
+			s.readOnly = true
+		case v.Kind() == reflect.Int:
+			if n := int(v.Int()); n > 0 {
+				s.attempts = n
+			}
+		case v.Kind() == reflect.Struct && v.NumField() == 1 && v.Field(0).Type() == timeType:
+			// datastore.WithReadTime.
+			readTime = v.Field(0).Interface().(time.Time)
+		}
+	}
+	// Like the datastore package, read times only apply to read-only
+	// transactions.
+	if s.readOnly {
+		s.readTime = readTime
+	}
+	return s
+}
+
+// NewTransaction starts a new transaction.
+func (c *Client) NewTransaction(ctx context.Context, opts ...datastore.TransactionOption) (dsiface.Transaction, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.checkLocked(ctx); err != nil {
+		return nil, err
+	}
+	return c.newTransactionLocked(ctx, decodeTransactionOptions(opts)), nil
+}
+
+func (c *Client) newTransactionLocked(ctx context.Context, s transactionSettings) *transaction {
+	return &transaction{
+		c:        c,
+		ctx:      ctx,
+		startSeq: c.seq,
+		readOnly: s.readOnly,
+		readTime: s.readTime,
+		touched:  make(map[string]bool),
+		groups:   make(map[string]bool),
+		pending:  make(map[*datastore.PendingKey]int),
+	}
+}
+
+// RunInTransaction runs f in a transaction, retrying it when the commit fails
+// with datastore.ErrConcurrentTransaction, up to the number of attempts given
+// by the datastore.MaxAttempts option (three by default).
+func (c *Client) RunInTransaction(ctx context.Context, f func(tx dsiface.Transaction) error, opts ...datastore.TransactionOption) (dsiface.Commit, error) {
+	s := decodeTransactionOptions(opts)
+	for i := 0; i < s.attempts; i++ {
+		c.mu.Lock()
+		if err := c.checkLocked(ctx); err != nil {
+			c.mu.Unlock()
+			return nil, err
+		}
+		tx := c.newTransactionLocked(ctx, s)
+		c.mu.Unlock()
+		if err := f(tx); err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		cmt, err := tx.Commit()
+		if err != datastore.ErrConcurrentTransaction {
+			return cmt, err
+		}
+	}
+	return nil, datastore.ErrConcurrentTransaction
+}
+
+func (t *transaction) checkLocked() error {
+	if t.done {
+		return errExpiredTransaction
+	}
+	return t.c.checkLocked(t.ctx)
+}
+
+// Get is the transactional version of Client.Get.
+func (t *transaction) Get(key *datastore.Key, dst interface{}) error {
+	if dst == nil {
+		return datastore.ErrInvalidEntityType
+	}
+	err := t.GetMulti([]*datastore.Key{key}, []interface{}{dst})
+	if me, ok := err.(datastore.MultiError); ok {
+		return me[0]
+	}
+	return err
+}
+
+// GetMulti is a batch version of Get.
+func (t *transaction) GetMulti(keys []*datastore.Key, dst interface{}) error {
+	t.c.mu.Lock()
+	defer t.c.mu.Unlock()
+	if err := t.checkLocked(); err != nil {
+		return err
+	}
+	return t.c.getMultiLocked(keys, dst, t.readTime, func(k *datastore.Key) {
+		t.touched[keyString(k)] = true
+		t.groups[keyString(rootKey(k))] = true
+	})
+}
+
+// Put is the transactional version of Client.Put. The returned PendingKey can
+// be resolved with the Commit returned by Commit.
+func (t *transaction) Put(key *datastore.Key, src interface{}) (*datastore.PendingKey, error) {
+	pks, err := t.PutMulti([]*datastore.Key{key}, []interface{}{src})
+	if err != nil {
+		if me, ok := err.(datastore.MultiError); ok {
+			return nil, me[0]
+		}
+		return nil, err
+	}
+	return pks[0], nil
+}
+
+// PutMulti is a batch version of Put.
+func (t *transaction) PutMulti(keys []*datastore.Key, src interface{}) ([]*datastore.PendingKey, error) {
+	t.c.mu.Lock()
+	defer t.c.mu.Unlock()
+	if err := t.checkLocked(); err != nil {
+		return nil, err
+	}
+	writes, err := prepareWrites(keys, src)
+	if err != nil {
+		return nil, err
+	}
+	return t.bufferLocked(writes), nil
+}
+
+// bufferLocked adds writes to the transaction and returns a PendingKey for
+// each of them. t.c.mu must be held.
+func (t *transaction) bufferLocked(writes []write) []*datastore.PendingKey {
+	pks := make([]*datastore.PendingKey, len(writes))
+	for i, w := range writes {
+		pks[i] = &datastore.PendingKey{}
+		t.pending[pks[i]] = len(t.writes)
+		t.writes = append(t.writes, write{key: cloneKey(w.key), props: w.props, op: w.op})
+	}
+	return pks
+}
+
+// Delete is the transactional version of Client.Delete.
+func (t *transaction) Delete(key *datastore.Key) error {
+	err := t.DeleteMulti([]*datastore.Key{key})
+	if me, ok := err.(datastore.MultiError); ok {
+		return me[0]
+	}
+	return err
+}
+
+// DeleteMulti is a batch version of Delete.
+func (t *transaction) DeleteMulti(keys []*datastore.Key) error {
+	t.c.mu.Lock()
+	defer t.c.mu.Unlock()
+	if err := t.checkLocked(); err != nil {
+		return err
+	}
+	if err := checkDeletes(keys); err != nil {
+		return err
+	}
+	for _, k := range keys {
+		t.writes = append(t.writes, write{key: cloneKey(k)})
+	}
+	return nil
+}
+
+// Commit applies the buffered writes atomically.
+func (t *transaction) Commit() (dsiface.Commit, error) {
+	t.c.mu.Lock()
+	defer t.c.mu.Unlock()
+	if err := t.checkLocked(); err != nil {
+		return nil, err
+	}
+	t.done = true
+	if t.readOnly && len(t.writes) > 0 {
+		return nil, errReadOnlyTransaction
+	}
+	for _, w := range t.writes {
+		if !w.key.Incomplete() {
+			t.touched[keyString(w.key)] = true
+		}
+	}
+	if !t.readOnly {
+		for ks := range t.touched {
+			if t.c.lastWrite[ks] > t.startSeq {
+				return nil, datastore.ErrConcurrentTransaction
+			}
+		}
+	}
+	if err := t.c.checkPreconditionsLocked(t.writes); err != nil {
+		return nil, err
+	}
+	if err := t.c.checkEntityGroupsLocked(t.writes, t.groups, true); err != nil {
+		return nil, err
+	}
+	cmt := &commit{keys: make(map[*datastore.PendingKey]*datastore.Key)}
+	for i := range t.writes {
+		if t.writes[i].props != nil {
+			t.writes[i].key = t.c.completeKeyLocked(t.writes[i].key)
+		}
+	}
+	for pk, i := range t.pending {
+		cmt.keys[pk] = cloneKey(t.writes[i].key)
+	}
+	t.c.commitLocked(t.writes)
+	return cmt, nil
+}
+
+// Rollback abandons the transaction.
+func (t *transaction) Rollback() error {
+	t.c.mu.Lock()
+	defer t.c.mu.Unlock()
+	if err := t.checkLocked(); err != nil {
+		return err
+	}
+	t.done = true
+	return nil
+}
+
+// Key resolves a pending key handle into a final key.
+func (c *commit) Key(p *datastore.PendingKey) *datastore.Key {
+	return cloneKey(c.keys[p])
+}
@@ -0,0 +1,211 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dsfake
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+	"unicode/utf8"
+
+	"cloud.google.com/go/datastore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Limits enforced by the datastore service and client.
+// See https://cloud.google.com/datastore/docs/concepts/limits.
+const (
+	maxWriteBatch        = 500     // keys in a single write call
+	maxLookupBatch       = 1000    // keys in a single lookup call
+	maxEntitySize        = 1048572 // bytes in an entity, including its key
+	maxIndexedValueSize  = 1500    // bytes in an indexed string or []byte value
+	maxIndexedProperties = 20000   // indexed values in an entity
+	maxKeyPartSize       = 1500    // bytes in a kind or key name
+)
+
+var namespaceRE = regexp.MustCompile(`^[0-9A-Za-z._-]{0,100}$`)
+
+// reserved reports whether s is reserved for use by the datastore service.
+func reserved(s string) bool {
+	return len(s) >= 4 && s[:2] == "__" && s[len(s)-2:] == "__"
+}
+
+// checkBatch reports an error if a call with n keys exceeds the batch limit
+// max.
+func checkBatch(n, max int) error {
+	if n > max {
+		return status.Errorf(codes.InvalidArgument, "cannot write or look up more than %d entities in a single call", max)
+	}
+	return nil
+}
+
+// checkKey reports an error if k is not a valid key, in the form that the
+// client or service would report it. Incomplete keys are allowed only when
+// allowIncomplete is true.
+func checkKey(k *datastore.Key, allowIncomplete bool) error {
+	if !validKey(k, allowIncomplete) {
+		return datastore.ErrInvalidKey
+	}
+	if !namespaceRE.MatchString(k.Namespace) || reserved(k.Namespace) {
+		return status.Errorf(codes.InvalidArgument, "namespace %q is not valid", k.Namespace)
+	}
+	for ; k != nil; k = k.Parent {
+		switch {
+		case reserved(k.Kind):
+			return status.Errorf(codes.InvalidArgument, "the key path element kind %q is reserved", k.Kind)
+		case len(k.Kind) > maxKeyPartSize:
+			return status.Errorf(codes.InvalidArgument, "the key path element kind is longer than %d bytes", maxKeyPartSize)
+		case reserved(k.Name):
+			return status.Errorf(codes.InvalidArgument, "the key path element name %q is reserved", k.Name)
+		case len(k.Name) > maxKeyPartSize:
+			return status.Errorf(codes.InvalidArgument, "the key path element name is longer than %d bytes", maxKeyPartSize)
+		case k.ID < 0:
+			return status.Errorf(codes.InvalidArgument, "the key path element ID %d is negative", k.ID)
+		}
+	}
+	return nil
+}
+
+// checkEntity reports an error if the entity with key k and properties props
+// would be rejected by the client or service.
+func checkEntity(k *datastore.Key, props []datastore.Property) error {
+	var indexed int
+	names := make(map[string]bool)
+	for _, p := range props {
+		if names[p.Name] {
+			return fmt.Errorf("datastore: duplicate Property with Name %q", p.Name)
+		}
+		names[p.Name] = true
+		if reserved(p.Name) {
+			return status.Errorf(codes.InvalidArgument, "the property name %q is reserved", p.Name)
+		}
+		n, err := checkValue(p.Value, p.NoIndex)
+		if err != nil {
+			return fmt.Errorf("datastore: %v for a Property with Name %q", err, p.Name)
+		}
+		indexed += n
+		if indexed > maxIndexedProperties {
+			return errors.New("datastore: too many indexed properties")
+		}
+	}
+	if size := entitySize(k, props); size > maxEntitySize {
+		return status.Errorf(codes.InvalidArgument, "entity is too big: %d bytes exceeds the maximum of %d", size, maxEntitySize)
+	}
+	return nil
+}
+
+// checkValue validates a normalized property value and returns the number
+// of index entries it requires.
+func checkValue(v interface{}, noIndex bool) (int, error) {
+	switch v := v.(type) {
+	case string:
+		if !utf8.ValidString(v) {
+			return 0, fmt.Errorf("string is not valid utf8: %q", v)
+		}
+		if len(v) > maxIndexedValueSize && !noIndex {
+			return 0, errors.New("string property too long to index")
+		}
+	case []byte:
+		if len(v) > maxIndexedValueSize && !noIndex {
+			return 0, errors.New("[]byte property too long to index")
+		}
+	case *datastore.Entity:
+		if v == nil || noIndex {
+			return 0, nil
+		}
+		var n int
+		for _, p := range v.Properties {
+			m, err := checkValue(p.Value, p.NoIndex)
+			if err != nil {
+				return 0, err
+			}
+			n += m
+		}
+		return n, nil
+	case []interface{}:
+		var n int
+		for _, e := range v {
+			m, err := checkValue(e, noIndex)
+			if err != nil {
+				return 0, err
+			}
+			n += m
+		}
+		return n, nil
+	}
+	if noIndex {
+		return 0, nil
+	}
+	return 1, nil
+}
+
+// entitySize estimates the stored size of an entity, following the storage
+// size calculations documented for Cloud Datastore.
+func entitySize(k *datastore.Key, props []datastore.Property) int {
+	size := keySize(k)
+	for _, p := range props {
+		size += len(p.Name) + 1 + valueSize(p.Value)
+	}
+	return size + 32
+}
+
+func keySize(k *datastore.Key) int {
+	if k == nil {
+		return 0
+	}
+	size := len(k.Namespace) + 1
+	for ; k != nil; k = k.Parent {
+		size += len(k.Kind) + 1
+		if k.Name != "" {
+			size += len(k.Name) + 1
+		} else {
+			size += 8
+		}
+	}
+	return size + 16
+}
+
+func valueSize(v interface{}) int {
+	switch v := v.(type) {
+	case nil, bool:
+		return 1
+	case int64, float64:
+		return 8
+	case time.Time:
+		return 8
+	case datastore.GeoPoint:
+		return 16
+	case string:
+		return len(v) + 1
+	case []byte:
+		return len(v) + 1
+	case *datastore.Key:
+		return keySize(v)
+	case *datastore.Entity:
+		if v == nil {
+			return 1
+		}
+		return entitySize(v.Key, v.Properties)
+	case []interface{}:
+		var size int
+		for _, e := range v {
+			size += valueSize(e)
+		}
+		return size
+	}
+	return 0
+}
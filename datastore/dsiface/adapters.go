@@ -87,10 +87,18 @@ func (c client) PutMulti(ctx context.Context, keys []*datastore.Key, src interfa
 	return c.Client.PutMulti(ctx, keys, src)
 }
 
+func (c client) ReserveIDs(ctx context.Context, keys []*datastore.Key) error {
+	return c.Client.ReserveIDs(ctx, keys)
+}
+
 func (c client) Run(ctx context.Context, q *datastore.Query) Iterator {
 	return iterator{c.Client.Run(ctx, q)}
 }
 
+func (c client) RunAggregationQuery(ctx context.Context, aq *datastore.AggregationQuery) (datastore.AggregationResult, error) {
+	return c.Client.RunAggregationQuery(ctx, aq)
+}
+
 func (c client) RunInTransaction(ctx context.Context, f func(tx Transaction) error, opts ...datastore.TransactionOption) (Commit, error) {
 	cmt, err := c.Client.RunInTransaction(ctx, func(tx *datastore.Transaction) error {
 		return f(transaction{tx})
@@ -98,6 +106,10 @@ func (c client) RunInTransaction(ctx context.Context, f func(tx Transaction) err
 	return commit{cmt}, err
 }
 
+func (c client) WithReadOptions(ro ...datastore.ReadOption) Client {
+	return client{c.Client.WithReadOptions(ro...)}
+}
+
 func (t transaction) Commit() (Commit, error) {
 	c, err := t.Transaction.Commit()
 	return commit{c}, err
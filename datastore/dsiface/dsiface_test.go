@@ -12,7 +12,7 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-package dsiface
+package dsiface_test
 
 import (
 	"context"
@@ -23,6 +23,8 @@ import (
 	"time"
 
 	"cloud.google.com/go/datastore"
+	"github.com/googleapis/google-cloud-go-testing/datastore/dsemulator"
+	"github.com/googleapis/google-cloud-go-testing/datastore/dsiface"
 )
 
 func TestIntegration(t *testing.T) {
@@ -30,18 +32,21 @@ func TestIntegration(t *testing.T) {
 		t.Skip("integration tests skipped in short mode")
 	}
 
+	kind := fmt.Sprintf("dsiface_test_%d", time.Now().UnixNano())
 	projID := os.Getenv("DATASTORE_PROJECT_ID")
 	if projID == "" {
-		t.Skip("missing DATASTORE_PROJECT_ID environment variable")
+		// Without a project, run against a local emulator, or skip if it is
+		// not installed.
+		basicTests(t, kind, dsemulator.NewTestClient(t))
+		return
 	}
 
-	kind := fmt.Sprintf("dsiface_test_%d", time.Now().UnixNano())
 	ctx := context.Background()
 	c, err := datastore.NewClient(ctx, projID)
 	if err != nil {
 		t.Fatal(err)
 	}
-	client := AdaptClient(c)
+	client := dsiface.AdaptClient(c)
 	defer client.Close()
 	basicTests(t, kind, client)
 }
@@ -50,7 +55,7 @@ type sourceData struct {
 	Payload string
 }
 
-func basicTests(t *testing.T, kindName string, client Client) {
+func basicTests(t *testing.T, kindName string, client dsiface.Client) {
 	ctx := context.Background()
 
 	want := "test-payload"
@@ -86,11 +91,11 @@ func TestFake(t *testing.T) {
 }
 
 type fakeClient struct {
-	Client
+	dsiface.Client
 	m map[string]interface{}
 }
 
-func newFakeClient() Client {
+func newFakeClient() dsiface.Client {
 	return &fakeClient{
 		m: make(map[string]interface{}),
 	}
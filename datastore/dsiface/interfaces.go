@@ -34,8 +34,11 @@ type Client interface {
 	NewTransaction(ctx context.Context, opts ...datastore.TransactionOption) (t Transaction, err error)
 	Put(ctx context.Context, key *datastore.Key, src interface{}) (*datastore.Key, error)
 	PutMulti(ctx context.Context, keys []*datastore.Key, src interface{}) (ret []*datastore.Key, err error)
+	ReserveIDs(ctx context.Context, keys []*datastore.Key) error
 	Run(ctx context.Context, q *datastore.Query) Iterator
+	RunAggregationQuery(ctx context.Context, aq *datastore.AggregationQuery) (ar datastore.AggregationResult, err error)
 	RunInTransaction(ctx context.Context, f func(tx Transaction) error, opts ...datastore.TransactionOption) (cmt Commit, err error)
+	WithReadOptions(ro ...datastore.ReadOption) Client
 
 	embedToIncludeNewMethods()
 }
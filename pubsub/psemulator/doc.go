@@ -0,0 +1,40 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package psemulator serves the Pub/Sub gRPC API on a local port for tests,
+// backed by an in-memory psfake.Broker, and provides clients connected to
+// it.
+//
+// Unlike the gcloud Pub/Sub emulator, the server runs in the test process,
+// so it starts instantly and needs nothing installed. Code that uses a
+// *pubsub.Client, which can only be pointed at an emulator with the
+// PUBSUB_EMULATOR_HOST environment variable, and code that uses psiface can
+// share the same Broker, and tests can inspect the Broker's state through
+// its psfake.Clients:
+//
+//    func TestSomething(t *testing.T) {
+//        b := psfake.NewBroker()
+//        e, err := psemulator.Start(b, "")
+//        if err != nil {
+//            t.Fatal(err)
+//        }
+//        defer e.Stop()
+//        client := e.NewTestClient(t) // sets PUBSUB_EMULATOR_HOST
+//        ...
+//        acked := b.Client(e.ProjectID).Acked("sub")
+//        ...
+//    }
+//
+// Note: This package is in alpha. Some backwards-incompatible changes may occur.
+package psemulator
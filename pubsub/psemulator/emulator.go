@@ -0,0 +1,144 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package psemulator
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/googleapis/google-cloud-go-testing/pubsub/psfake"
+	"github.com/googleapis/google-cloud-go-testing/pubsub/psiface"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// DefaultProjectID is the project ID used when Start is given none.
+const DefaultProjectID = "psemulator-test"
+
+// Emulator is a running Pub/Sub server.
+type Emulator struct {
+	// Host is the address of the server, in the form expected in the
+	// PUBSUB_EMULATOR_HOST environment variable.
+	Host string
+	// ProjectID is the project ID that clients of the server use.
+	ProjectID string
+	// Broker holds the state of the server.
+	Broker *psfake.Broker
+
+	srv      *grpc.Server
+	stopOnce sync.Once
+}
+
+// Start serves the Pub/Sub API backed by b on a free local port. If b is
+// nil, a new Broker is used; if projectID is empty, DefaultProjectID is
+// used. The server runs until Stop is called.
+func Start(b *psfake.Broker, projectID string) (*Emulator, error) {
+	if b == nil {
+		b = psfake.NewBroker()
+	}
+	if projectID == "" {
+		projectID = DefaultProjectID
+	}
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return nil, err
+	}
+	e := &Emulator{
+		Host:      l.Addr().String(),
+		ProjectID: projectID,
+		Broker:    b,
+		srv:       grpc.NewServer(),
+	}
+	b.RegisterServer(e.srv)
+	go e.srv.Serve(l)
+	return e, nil
+}
+
+// Stop shuts the server down, closing open streams. It is safe to call Stop
+// more than once.
+func (e *Emulator) Stop() error {
+	e.stopOnce.Do(e.srv.Stop)
+	return nil
+}
+
+// NewClient returns a client connected to the server. It does not depend on
+// the PUBSUB_EMULATOR_HOST environment variable.
+func (e *Emulator) NewClient(ctx context.Context) (psiface.Client, error) {
+	c, err := e.newClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return psiface.AdaptClient(c), nil
+}
+
+func (e *Emulator) newClient(ctx context.Context) (*pubsub.Client, error) {
+	return pubsub.NewClient(ctx, e.ProjectID, e.clientOptions()...)
+}
+
+// NewSchemaClient returns a schema client connected to the server. Unlike
+// pubsub.Client, pubsub.SchemaClient ignores PUBSUB_EMULATOR_HOST, so code
+// under test that manages schemas must be given the server's address.
+func (e *Emulator) NewSchemaClient(ctx context.Context) (psiface.SchemaClient, error) {
+	c, err := pubsub.NewSchemaClient(ctx, e.ProjectID, e.clientOptions()...)
+	if err != nil {
+		return nil, err
+	}
+	return psiface.AdaptSchemaClient(c), nil
+}
+
+func (e *Emulator) clientOptions() []option.ClientOption {
+	return []option.ClientOption{
+		option.WithEndpoint("passthrough:///" + e.Host),
+		option.WithoutAuthentication(),
+		option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())),
+	}
+}
+
+// NewTestClient returns a client connected to the server, which is closed
+// when the test finishes. For the duration of the test, it also sets
+// PUBSUB_EMULATOR_HOST and PUBSUB_PROJECT_ID, so that clients created by the
+// code under test use the server; tests that call it must not run in
+// parallel.
+//
+// The state of the Broker is not reset, so tests sharing an Emulator should
+// use distinct topic and subscription IDs.
+func (e *Emulator) NewTestClient(t testing.TB) psiface.Client {
+	t.Helper()
+	t.Setenv("PUBSUB_EMULATOR_HOST", e.Host)
+	t.Setenv("PUBSUB_PROJECT_ID", e.ProjectID)
+	client, err := e.newClient(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return psiface.AdaptClient(client)
+}
+
+// NewTestClient starts a server with a new Broker for a single test and
+// returns a client connected to it, as Emulator.NewTestClient does. The
+// server is stopped when the test finishes.
+func NewTestClient(t testing.TB) psiface.Client {
+	t.Helper()
+	e, err := Start(nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { e.Stop() })
+	return e.NewTestClient(t)
+}
@@ -0,0 +1,226 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package psemulator
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/googleapis/google-cloud-go-testing/pubsub/psfake"
+	"github.com/googleapis/google-cloud-go-testing/pubsub/psiface"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestStartStop(t *testing.T) {
+	e, err := Start(nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.ProjectID != DefaultProjectID {
+		t.Errorf("got project ID %q, want %q", e.ProjectID, DefaultProjectID)
+	}
+	if e.Broker == nil {
+		t.Error("Broker is nil")
+	}
+	if err := e.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Stop(); err != nil {
+		t.Errorf("second Stop: %v", err)
+	}
+}
+
+// TestSharedBroker publishes with a raw pubsub.Client that finds the server
+// through PUBSUB_EMULATOR_HOST, receives with StreamingPull, and checks the
+// result through the Broker.
+func TestSharedBroker(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	b := psfake.NewBroker()
+	e, err := Start(b, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Stop()
+	ifaceClient := e.NewTestClient(t)
+	if got := os.Getenv("PUBSUB_EMULATOR_HOST"); got != e.Host {
+		t.Errorf("PUBSUB_EMULATOR_HOST = %q, want %q", got, e.Host)
+	}
+
+	client, err := pubsub.NewClient(ctx, e.ProjectID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	topic, err := client.CreateTopic(ctx, "topic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer topic.Stop()
+	_, err = ifaceClient.CreateSubscription(ctx, "sub", psiface.SubscriptionConfig{
+		Topic: ifaceClient.Topic("topic"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"a", "b", "c"}
+	for _, data := range want {
+		if _, err := topic.Publish(ctx, &pubsub.Message{Data: []byte(data)}).Get(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var (
+		mu  sync.Mutex
+		got = map[string]bool{}
+	)
+	rctx, rcancel := context.WithCancel(ctx)
+	err = client.Subscription("sub").Receive(rctx, func(_ context.Context, m *pubsub.Message) {
+		m.Ack()
+		mu.Lock()
+		defer mu.Unlock()
+		got[string(m.Data)] = true
+		if len(got) == len(want) {
+			rcancel()
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, data := range want {
+		if !got[data] {
+			t.Errorf("message %q not received", data)
+		}
+	}
+
+	// Acks are sent asynchronously, so wait for the Broker to see them.
+	fc := b.Client(e.ProjectID)
+	for len(fc.Acked("sub")) < len(want) {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("got %d acked messages, want %d", len(fc.Acked("sub")), len(want))
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+	if n := len(fc.Outstanding("sub")); n != 0 {
+		t.Errorf("got %d outstanding messages, want 0", n)
+	}
+}
+
+func TestPull(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	client := NewTestClient(t)
+	topic, err := client.CreateTopic(ctx, "topic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer topic.Stop()
+	sub, err := client.CreateSubscription(ctx, "sub", psiface.SubscriptionConfig{
+		Topic: topic,
+		SubscriptionConfig: pubsub.SubscriptionConfig{
+			AckDeadline: 10 * time.Second,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := sub.Config(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.AckDeadline != 10*time.Second {
+		t.Errorf("got AckDeadline %v, want 10s", cfg.AckDeadline)
+	}
+	if _, err := topic.Publish(ctx, psiface.NewMessage([]byte("x"), map[string]string{"k": "v"}, "")).Get(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nack the first delivery; the message is redelivered.
+	var attempts int
+	rctx, rcancel := context.WithCancel(ctx)
+	sub.SetReceiveSettings(pubsub.ReceiveSettings{Synchronous: true, NumGoroutines: 1})
+	err = sub.Receive(rctx, func(_ context.Context, m psiface.Message) {
+		attempts++
+		if m.Attributes()["k"] != "v" {
+			t.Errorf("got attributes %v", m.Attributes())
+		}
+		if attempts == 1 {
+			m.Nack()
+			return
+		}
+		m.Ack()
+		rcancel()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 2 {
+		t.Errorf("got %d deliveries, want 2", attempts)
+	}
+}
+
+func TestSchema(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	e, err := Start(nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Stop()
+	client := e.NewTestClient(t)
+	sc, err := e.NewSchemaClient(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sc.Close()
+
+	schema, err := sc.CreateSchema(ctx, "schema", pubsub.SchemaConfig{
+		Type:       pubsub.SchemaProtocolBuffer,
+		Definition: `syntax = "proto3"; message M { string s = 1; }`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sc.ValidateMessageWithID(ctx, []byte(`{"s": "x"}`), pubsub.EncodingJSON, "schema"); err != nil {
+		t.Error(err)
+	}
+	topic, err := client.CreateTopicWithConfig(ctx, "topic", &pubsub.TopicConfig{
+		SchemaSettings: &pubsub.SchemaSettings{Schema: schema.Name, Encoding: pubsub.EncodingJSON},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer topic.Stop()
+	cfg, err := topic.Config(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.SchemaSettings == nil || cfg.SchemaSettings.Schema != schema.Name {
+		t.Errorf("got schema settings %+v", cfg.SchemaSettings)
+	}
+	if _, err := topic.Publish(ctx, psiface.NewMessage([]byte(`{"s": "x"}`), nil, "")).Get(ctx); err != nil {
+		t.Error(err)
+	}
+	if _, err := topic.Publish(ctx, psiface.NewMessage([]byte(`{"s": 1}`), nil, "")).Get(ctx); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("got %v, want InvalidArgument", err)
+	}
+}
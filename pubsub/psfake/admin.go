@@ -0,0 +1,388 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package psfake
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/iam"
+	"cloud.google.com/go/pubsub"
+	"github.com/googleapis/google-cloud-go-testing/pubsub/psiface"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// deletedTopic is the topic of subscriptions whose topic was deleted.
+const deletedTopic = "_deleted-topic_"
+
+// The errors of the pubsub package for updates without changes.
+var (
+	errNoTopicUpdate        = errors.New("pubsub: UpdateTopic call with nothing to update")
+	errNoSubscriptionUpdate = errors.New("pubsub: UpdateSubscription call with nothing to update")
+)
+
+func (b *Broker) topicLocked(name string) (*topicState, error) {
+	t := b.topics[name]
+	if t == nil {
+		return nil, status.Errorf(codes.NotFound, "Resource not found (resource=%s).", resourceID(name))
+	}
+	return t, nil
+}
+
+func (b *Broker) topicExists(name string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.topics[name] != nil
+}
+
+// deleteTopic deletes the topic. Its subscriptions and snapshots remain, but
+// are detached from it.
+func (b *Broker) deleteTopic(name string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t, err := b.topicLocked(name)
+	if err != nil {
+		return err
+	}
+	for _, s := range t.subs {
+		s.topic = deletedTopic
+	}
+	for _, sn := range t.snapshots {
+		sn.topic = deletedTopic
+	}
+	delete(b.topics, name)
+	delete(b.policies, name)
+	return nil
+}
+
+func (b *Broker) topicConfig(name string) (pubsub.TopicConfig, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t, err := b.topicLocked(name)
+	if err != nil {
+		return pubsub.TopicConfig{}, err
+	}
+	return t.cfg, nil
+}
+
+func (b *Broker) updateTopic(name string, u pubsub.TopicConfigToUpdate) (pubsub.TopicConfig, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	t, err := b.topicLocked(name)
+	if err != nil {
+		return pubsub.TopicConfig{}, err
+	}
+	cfg := t.cfg
+	if u.Labels != nil {
+		cfg.Labels = u.Labels
+	}
+	if u.MessageStoragePolicy != nil {
+		cfg.MessageStoragePolicy = *u.MessageStoragePolicy
+	}
+	if u.RetentionDuration != nil {
+		d, ok := u.RetentionDuration.(time.Duration)
+		switch {
+		case !ok:
+			return pubsub.TopicConfig{}, status.Errorf(codes.InvalidArgument, "invalid retention duration %v", u.RetentionDuration)
+		case d < 0:
+			cfg.RetentionDuration = nil
+		default:
+			cfg.RetentionDuration = d
+		}
+	}
+	if u.SchemaSettings != nil {
+		if *u.SchemaSettings == (pubsub.SchemaSettings{}) {
+			cfg.SchemaSettings = nil
+		} else {
+			ss := *u.SchemaSettings
+			if err := b.checkSchemaSettingsLocked(&ss); err != nil {
+				return pubsub.TopicConfig{}, err
+			}
+			cfg.SchemaSettings = &ss
+		}
+	}
+	if err := checkTopicRetention(cfg); err != nil {
+		return pubsub.TopicConfig{}, err
+	}
+	if u.IngestionDataSourceSettings != nil {
+		cfg.IngestionDataSourceSettings = u.IngestionDataSourceSettings
+	}
+	if u.MessageTransforms != nil {
+		cfg.MessageTransforms = u.MessageTransforms
+	}
+	t.cfg = cfg
+	b.pruneTopicLocked(t)
+	return cfg, nil
+}
+
+// updateSubscription applies u to the configuration of the
+// subscription.
+func (b *Broker) updateSubscription(name string, u pubsub.SubscriptionConfigToUpdate) (psiface.SubscriptionConfig, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s, err := b.subscriptionLocked(name)
+	if err != nil {
+		return psiface.SubscriptionConfig{}, err
+	}
+	cfg := s.cfg
+	if u.PushConfig != nil {
+		cfg.PushConfig = *u.PushConfig
+	}
+	if u.AckDeadline != 0 {
+		cfg.AckDeadline = u.AckDeadline
+	}
+	if u.RetainAckedMessages != nil {
+		retain, ok := u.RetainAckedMessages.(bool)
+		if !ok {
+			return psiface.SubscriptionConfig{}, status.Errorf(codes.InvalidArgument, "invalid RetainAckedMessages %v", u.RetainAckedMessages)
+		}
+		cfg.RetainAckedMessages = retain
+	}
+	if u.RetentionDuration != 0 {
+		cfg.RetentionDuration = u.RetentionDuration
+	}
+	if u.ExpirationPolicy != nil {
+		cfg.ExpirationPolicy = u.ExpirationPolicy
+	}
+	if u.DeadLetterPolicy != nil {
+		cfg.DeadLetterPolicy = u.DeadLetterPolicy
+		if u.DeadLetterPolicy.DeadLetterTopic == "" {
+			cfg.DeadLetterPolicy = nil
+		}
+	}
+	if u.Labels != nil {
+		cfg.Labels = u.Labels
+	}
+	if u.RetryPolicy != nil {
+		cfg.RetryPolicy = u.RetryPolicy
+		if u.RetryPolicy.MinimumBackoff == nil && u.RetryPolicy.MaximumBackoff == nil {
+			cfg.RetryPolicy = nil
+		}
+	}
+	if u.EnableExactlyOnceDelivery != nil {
+		exactlyOnce, ok := u.EnableExactlyOnceDelivery.(bool)
+		if !ok {
+			return psiface.SubscriptionConfig{}, status.Errorf(codes.InvalidArgument, "invalid EnableExactlyOnceDelivery %v", u.EnableExactlyOnceDelivery)
+		}
+		cfg.EnableExactlyOnceDelivery = exactlyOnce
+	}
+	if err := checkSubscriptionConfig(&cfg); err != nil {
+		return psiface.SubscriptionConfig{}, err
+	}
+	s.cfg = cfg
+	if cfg.PushConfig.Endpoint != "" {
+		b.startPusherLocked(s)
+	}
+	b.notifyLocked()
+	return b.subscriptionConfigLocked(s), nil
+}
+
+// subscriptionConfigLocked returns the configuration of s, with its topic.
+// b.mu must be held.
+func (b *Broker) subscriptionConfigLocked(s *subscriptionState) psiface.SubscriptionConfig {
+	cfg := s.cfg
+	cfg.Topic = b.topicHandle(s.topic)
+	return cfg
+}
+
+// topicHandle returns a topic for the full name of a topic.
+func (b *Broker) topicHandle(name string) *topic {
+	project, id, ok := parseName(name, "topics")
+	if !ok {
+		// A deleted topic.
+		t := b.Client("").topic("")
+		t.name = name
+		return t
+	}
+	return b.Client(project).topic(id)
+}
+
+// listTopics returns the names of the topics of the project, ordered.
+func (b *Broker) listTopics(project string) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var names []string
+	for name := range b.topics {
+		if p, _, _ := parseName(name, "topics"); p == project {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// listSubscriptions returns the names of the subscriptions of the project, or
+// of the topic if topic is not empty, ordered.
+func (b *Broker) listSubscriptions(project, topic string) ([]string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.reapLocked()
+	var names []string
+	if topic != "" {
+		t, err := b.topicLocked(topic)
+		if err != nil {
+			return nil, err
+		}
+		for name := range t.subs {
+			names = append(names, name)
+		}
+	} else {
+		for name := range b.subs {
+			if p, _, _ := parseName(name, "subscriptions"); p == project {
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Topics returns an iterator over the topics of the project, ordered by name.
+func (c *Client) Topics(ctx context.Context) psiface.TopicIterator {
+	it := &topicIterator{}
+	for _, name := range c.b.listTopics(c.project) {
+		it.topics = append(it.topics, c.topic(resourceID(name)))
+	}
+	return it
+}
+
+// Subscriptions returns an iterator over the subscriptions of the project,
+// ordered by name.
+func (c *Client) Subscriptions(ctx context.Context) psiface.SubscriptionIterator {
+	names, _ := c.b.listSubscriptions(c.project, "")
+	return c.b.subscriptionIterator(names, nil)
+}
+
+// ID returns the ID of the topic.
+func (t *topic) ID() string {
+	return resourceID(t.name)
+}
+
+// Exists reports whether the topic exists.
+func (t *topic) Exists(ctx context.Context) (bool, error) {
+	return t.c.b.topicExists(t.name), nil
+}
+
+// Delete deletes the topic. Its subscriptions remain, but no longer receive
+// messages, and their topic becomes "_deleted-topic_".
+func (t *topic) Delete(ctx context.Context) error {
+	return t.c.b.deleteTopic(t.name)
+}
+
+// Config returns the configuration of the topic. Its ID and String methods
+// return empty strings, since the name field is unexported.
+func (t *topic) Config(ctx context.Context) (pubsub.TopicConfig, error) {
+	return t.c.b.topicConfig(t.name)
+}
+
+// Update changes the configuration of the topic.
+func (t *topic) Update(ctx context.Context, cfg pubsub.TopicConfigToUpdate) (pubsub.TopicConfig, error) {
+	if cfg.Labels == nil && cfg.MessageStoragePolicy == nil && cfg.RetentionDuration == nil &&
+		cfg.SchemaSettings == nil && cfg.IngestionDataSourceSettings == nil && cfg.MessageTransforms == nil {
+		return pubsub.TopicConfig{}, errNoTopicUpdate
+	}
+	return t.c.b.updateTopic(t.name, cfg)
+}
+
+// Subscriptions returns an iterator over the subscriptions of the topic,
+// ordered by name. If the topic does not exist, the iterator's Next returns
+// an error with code NotFound.
+func (t *topic) Subscriptions(ctx context.Context) psiface.SubscriptionIterator {
+	names, err := t.c.b.listSubscriptions("", t.name)
+	return t.c.b.subscriptionIterator(names, err)
+}
+
+// IAM returns a handle for the IAM policy of the topic.
+func (t *topic) IAM() *iam.Handle {
+	return iam.InternalNewHandleGRPCClient(&iamClient{b: t.c.b}, t.name)
+}
+
+// ID returns the ID of the subscription.
+func (s *subscription) ID() string {
+	return resourceID(s.name)
+}
+
+// Config returns the configuration of the subscription, with defaults filled
+// in as by the service.
+func (s *subscription) Config(ctx context.Context) (psiface.SubscriptionConfig, error) {
+	b := s.c.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	st, err := b.subscriptionLocked(s.name)
+	if err != nil {
+		return psiface.SubscriptionConfig{}, err
+	}
+	return b.subscriptionConfigLocked(st), nil
+}
+
+// Update changes the configuration of the subscription. Setting a PushConfig
+// with an endpoint starts pushing messages; setting one without an endpoint
+// makes the subscription a pull subscription.
+func (s *subscription) Update(ctx context.Context, cfg pubsub.SubscriptionConfigToUpdate) (psiface.SubscriptionConfig, error) {
+	if cfg.PushConfig == nil && cfg.BigQueryConfig == nil && cfg.CloudStorageConfig == nil &&
+		cfg.AckDeadline == 0 && cfg.RetainAckedMessages == nil && cfg.RetentionDuration == 0 &&
+		cfg.ExpirationPolicy == nil && cfg.DeadLetterPolicy == nil && cfg.Labels == nil &&
+		cfg.RetryPolicy == nil && cfg.EnableExactlyOnceDelivery == nil && cfg.MessageTransforms == nil {
+		return psiface.SubscriptionConfig{}, errNoSubscriptionUpdate
+	}
+	return s.c.b.updateSubscription(s.name, cfg)
+}
+
+// topicIterator implements psiface.TopicIterator.
+type topicIterator struct {
+	psiface.TopicIterator
+	topics []psiface.Topic
+}
+
+func (it *topicIterator) Next() (psiface.Topic, error) {
+	if len(it.topics) == 0 {
+		return nil, iterator.Done
+	}
+	t := it.topics[0]
+	it.topics = it.topics[1:]
+	return t, nil
+}
+
+// subscriptionIterator implements psiface.SubscriptionIterator.
+type subscriptionIterator struct {
+	psiface.SubscriptionIterator
+	subs []psiface.Subscription
+	err  error
+}
+
+func (b *Broker) subscriptionIterator(names []string, err error) *subscriptionIterator {
+	it := &subscriptionIterator{err: err}
+	for _, name := range names {
+		project, id, _ := parseName(name, "subscriptions")
+		it.subs = append(it.subs, b.Client(project).subscription(id))
+	}
+	return it
+}
+
+func (it *subscriptionIterator) Next() (psiface.Subscription, error) {
+	if it.err != nil {
+		return nil, it.err
+	}
+	if len(it.subs) == 0 {
+		return nil, iterator.Done
+	}
+	s := it.subs[0]
+	it.subs = it.subs[1:]
+	return s, nil
+}
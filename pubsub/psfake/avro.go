@@ -0,0 +1,532 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package psfake
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// avroType is a parsed Avro schema.
+type avroType struct {
+	kind     string // a primitive type name, or record, enum, array, map, union or fixed
+	name     string // full name of named types
+	fields   []avroField
+	symbols  []string
+	items    *avroType // of arrays and, as values, of maps
+	branches []*avroType
+	size     int
+}
+
+type avroField struct {
+	name       string
+	typ        *avroType
+	hasDefault bool
+}
+
+var avroPrimitives = map[string]bool{
+	"null": true, "boolean": true, "int": true, "long": true,
+	"float": true, "double": true, "bytes": true, "string": true,
+}
+
+// parseAvroSchema parses the JSON definition of an Avro schema. Logical types
+// are validated as their underlying types.
+func parseAvroSchema(def string) (*avroType, error) {
+	var v interface{}
+	if err := json.Unmarshal([]byte(def), &v); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+	p := &avroParser{named: make(map[string]*avroType)}
+	return p.parse(v, "")
+}
+
+type avroParser struct {
+	named map[string]*avroType // by full name
+}
+
+// fullName returns the full name of a type named name in namespace.
+func fullName(name, namespace string) string {
+	if strings.Contains(name, ".") || namespace == "" {
+		return name
+	}
+	return namespace + "." + name
+}
+
+func (p *avroParser) parse(v interface{}, namespace string) (*avroType, error) {
+	switch v := v.(type) {
+	case string:
+		if avroPrimitives[v] {
+			return &avroType{kind: v}, nil
+		}
+		if t := p.named[fullName(v, namespace)]; t != nil {
+			return t, nil
+		}
+		if t := p.named[v]; t != nil {
+			return t, nil
+		}
+		return nil, fmt.Errorf("unknown type %q", v)
+	case []interface{}:
+		t := &avroType{kind: "union"}
+		seen := make(map[string]bool)
+		for _, b := range v {
+			bt, err := p.parse(b, namespace)
+			if err != nil {
+				return nil, err
+			}
+			if bt.kind == "union" {
+				return nil, errors.New("unions may not immediately contain other unions")
+			}
+			if seen[bt.branchName()] {
+				return nil, fmt.Errorf("duplicate %q in union", bt.branchName())
+			}
+			seen[bt.branchName()] = true
+			t.branches = append(t.branches, bt)
+		}
+		return t, nil
+	case map[string]interface{}:
+		return p.parseComplex(v, namespace)
+	default:
+		return nil, fmt.Errorf("invalid type %v", v)
+	}
+}
+
+func (p *avroParser) parseComplex(v map[string]interface{}, namespace string) (*avroType, error) {
+	kind, ok := v["type"].(string)
+	if !ok {
+		if v["type"] == nil {
+			return nil, errors.New(`missing "type"`)
+		}
+		return p.parse(v["type"], namespace)
+	}
+	switch kind {
+	case "record", "error", "enum", "fixed":
+		name, _ := v["name"].(string)
+		if name == "" {
+			return nil, fmt.Errorf("%s without a name", kind)
+		}
+		if ns, ok := v["namespace"].(string); ok && !strings.Contains(name, ".") {
+			namespace = ns
+		}
+		name = fullName(name, namespace)
+		if i := strings.LastIndex(name, "."); i >= 0 {
+			namespace = name[:i]
+		}
+		if p.named[name] != nil || avroPrimitives[name] {
+			return nil, fmt.Errorf("type %q is defined twice", name)
+		}
+		t := &avroType{kind: kind, name: name}
+		if kind == "error" {
+			t.kind = "record"
+		}
+		// Register the type first, so that it can refer to itself.
+		p.named[name] = t
+		switch kind {
+		case "record", "error":
+			fields, ok := v["fields"].([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("record %q without fields", name)
+			}
+			seen := make(map[string]bool)
+			for _, f := range fields {
+				fm, ok := f.(map[string]interface{})
+				if !ok {
+					return nil, fmt.Errorf("invalid field in record %q", name)
+				}
+				fname, _ := fm["name"].(string)
+				if fname == "" || seen[fname] {
+					return nil, fmt.Errorf("missing or duplicate field name in record %q", name)
+				}
+				seen[fname] = true
+				if fm["type"] == nil {
+					return nil, fmt.Errorf("field %q without a type", fname)
+				}
+				ft, err := p.parse(fm["type"], namespace)
+				if err != nil {
+					return nil, fmt.Errorf("field %q: %v", fname, err)
+				}
+				_, hasDefault := fm["default"]
+				t.fields = append(t.fields, avroField{name: fname, typ: ft, hasDefault: hasDefault})
+			}
+		case "enum":
+			symbols, ok := v["symbols"].([]interface{})
+			if !ok || len(symbols) == 0 {
+				return nil, fmt.Errorf("enum %q without symbols", name)
+			}
+			for _, s := range symbols {
+				str, ok := s.(string)
+				if !ok {
+					return nil, fmt.Errorf("invalid symbol in enum %q", name)
+				}
+				t.symbols = append(t.symbols, str)
+			}
+		case "fixed":
+			size, ok := v["size"].(float64)
+			if !ok || size < 0 || size != math.Trunc(size) {
+				return nil, fmt.Errorf("fixed %q without a valid size", name)
+			}
+			t.size = int(size)
+		}
+		return t, nil
+	case "array", "map":
+		key := "items"
+		if kind == "map" {
+			key = "values"
+		}
+		if v[key] == nil {
+			return nil, fmt.Errorf("%s without %s", kind, key)
+		}
+		items, err := p.parse(v[key], namespace)
+		if err != nil {
+			return nil, err
+		}
+		return &avroType{kind: kind, items: items}, nil
+	default:
+		if avroPrimitives[kind] {
+			return &avroType{kind: kind}, nil
+		}
+		return p.parse(kind, namespace)
+	}
+}
+
+// branchName is the name of a union branch of type t in the JSON encoding.
+func (t *avroType) branchName() string {
+	if t.name != "" {
+		return t.name
+	}
+	return t.kind
+}
+
+// validateAvroBinary reports whether data is a value of type t in the Avro
+// binary encoding.
+func validateAvroBinary(t *avroType, data []byte) error {
+	r := &avroReader{data: data}
+	if err := r.value(t); err != nil {
+		return err
+	}
+	if r.pos != len(data) {
+		return fmt.Errorf("%d bytes after the end of the value", len(data)-r.pos)
+	}
+	return nil
+}
+
+type avroReader struct {
+	data []byte
+	pos  int
+}
+
+var errAvroEOF = errors.New("unexpected end of data")
+
+func (r *avroReader) long() (int64, error) {
+	u, n := binary.Uvarint(r.data[r.pos:])
+	if n <= 0 {
+		if n == 0 {
+			return 0, errAvroEOF
+		}
+		return 0, errors.New("invalid varint")
+	}
+	r.pos += n
+	return int64(u>>1) ^ -int64(u&1), nil
+}
+
+func (r *avroReader) bytes(n int64) ([]byte, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("negative length %d", n)
+	}
+	if n > int64(len(r.data)-r.pos) {
+		return nil, errAvroEOF
+	}
+	b := r.data[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return b, nil
+}
+
+// blocks reads the blocks of an array or map, calling item for each item.
+func (r *avroReader) blocks(item func() error) error {
+	for {
+		n, err := r.long()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return nil
+		}
+		if n < 0 {
+			// A negative count is followed by the size of the block.
+			n = -n
+			if _, err := r.long(); err != nil {
+				return err
+			}
+		}
+		for ; n > 0; n-- {
+			pos := r.pos
+			if err := item(); err != nil {
+				return err
+			}
+			if r.pos == pos {
+				// Items that take no bytes, such as nulls, are all valid
+				// if one is, and the count may be huge.
+				break
+			}
+		}
+	}
+}
+
+func (r *avroReader) value(t *avroType) error {
+	switch t.kind {
+	case "null":
+		return nil
+	case "boolean":
+		b, err := r.bytes(1)
+		if err != nil {
+			return err
+		}
+		if b[0] > 1 {
+			return fmt.Errorf("invalid boolean %d", b[0])
+		}
+		return nil
+	case "int":
+		n, err := r.long()
+		if err == nil && (n < math.MinInt32 || n > math.MaxInt32) {
+			err = fmt.Errorf("int %d out of range", n)
+		}
+		return err
+	case "long":
+		_, err := r.long()
+		return err
+	case "float":
+		_, err := r.bytes(4)
+		return err
+	case "double":
+		_, err := r.bytes(8)
+		return err
+	case "bytes", "string":
+		n, err := r.long()
+		if err != nil {
+			return err
+		}
+		b, err := r.bytes(n)
+		if err == nil && t.kind == "string" && !utf8.Valid(b) {
+			err = errors.New("invalid UTF-8 in string")
+		}
+		return err
+	case "fixed":
+		_, err := r.bytes(int64(t.size))
+		return err
+	case "enum":
+		n, err := r.long()
+		if err == nil && (n < 0 || n >= int64(len(t.symbols))) {
+			err = fmt.Errorf("enum index %d out of range for %s", n, t.name)
+		}
+		return err
+	case "record":
+		for _, f := range t.fields {
+			if err := r.value(f.typ); err != nil {
+				return fmt.Errorf("field %q: %v", f.name, err)
+			}
+		}
+		return nil
+	case "array":
+		return r.blocks(func() error { return r.value(t.items) })
+	case "map":
+		return r.blocks(func() error {
+			if err := r.value(&avroType{kind: "string"}); err != nil {
+				return err
+			}
+			return r.value(t.items)
+		})
+	case "union":
+		n, err := r.long()
+		if err != nil {
+			return err
+		}
+		if n < 0 || n >= int64(len(t.branches)) {
+			return fmt.Errorf("union index %d out of range", n)
+		}
+		return r.value(t.branches[n])
+	}
+	return fmt.Errorf("unknown type %q", t.kind)
+}
+
+// validateAvroJSON reports whether data is a value of type t in the Avro JSON
+// encoding, where the values of unions other than null are objects whose
+// only key is the name of their type.
+func validateAvroJSON(t *avroType, data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return fmt.Errorf("invalid JSON: %v", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("invalid JSON: data after the end of the value")
+	}
+	return avroJSONValue(t, v)
+}
+
+func avroJSONValue(t *avroType, v interface{}) error {
+	mismatch := func() error {
+		return fmt.Errorf("expected %s, got %s", t.branchName(), jsonKind(v))
+	}
+	switch t.kind {
+	case "null":
+		if v != nil {
+			return mismatch()
+		}
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return mismatch()
+		}
+	case "int", "long":
+		n, ok := v.(json.Number)
+		if !ok {
+			return mismatch()
+		}
+		bits := 64
+		if t.kind == "int" {
+			bits = 32
+		}
+		if _, err := strconv.ParseInt(n.String(), 10, bits); err != nil {
+			return fmt.Errorf("invalid %s %s", t.kind, n)
+		}
+	case "float", "double":
+		if _, ok := v.(json.Number); !ok {
+			return mismatch()
+		}
+	case "string":
+		if _, ok := v.(string); !ok {
+			return mismatch()
+		}
+	case "bytes", "fixed":
+		s, ok := v.(string)
+		if !ok {
+			return mismatch()
+		}
+		n := 0
+		for _, r := range s {
+			if r > 0xFF {
+				return fmt.Errorf("invalid %s: code point %U is not a byte", t.kind, r)
+			}
+			n++
+		}
+		if t.kind == "fixed" && n != t.size {
+			return fmt.Errorf("got %d bytes for %s, want %d", n, t.name, t.size)
+		}
+	case "enum":
+		s, ok := v.(string)
+		if !ok {
+			return mismatch()
+		}
+		for _, sym := range t.symbols {
+			if s == sym {
+				return nil
+			}
+		}
+		return fmt.Errorf("%q is not a symbol of %s", s, t.name)
+	case "record":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return mismatch()
+		}
+		known := make(map[string]bool)
+		for _, f := range t.fields {
+			known[f.name] = true
+			fv, ok := obj[f.name]
+			if !ok {
+				if f.hasDefault {
+					continue
+				}
+				return fmt.Errorf("missing field %q", f.name)
+			}
+			if err := avroJSONValue(f.typ, fv); err != nil {
+				return fmt.Errorf("field %q: %v", f.name, err)
+			}
+		}
+		for k := range obj {
+			if !known[k] {
+				return fmt.Errorf("unknown field %q in %s", k, t.name)
+			}
+		}
+	case "array":
+		a, ok := v.([]interface{})
+		if !ok {
+			return mismatch()
+		}
+		for i, item := range a {
+			if err := avroJSONValue(t.items, item); err != nil {
+				return fmt.Errorf("item %d: %v", i, err)
+			}
+		}
+	case "map":
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return mismatch()
+		}
+		for k, item := range obj {
+			if err := avroJSONValue(t.items, item); err != nil {
+				return fmt.Errorf("key %q: %v", k, err)
+			}
+		}
+	case "union":
+		if v == nil {
+			for _, b := range t.branches {
+				if b.kind == "null" {
+					return nil
+				}
+			}
+			return errors.New("null is not in the union")
+		}
+		obj, ok := v.(map[string]interface{})
+		if !ok || len(obj) != 1 {
+			return fmt.Errorf("expected a union value like {\"type\": value}, got %s", jsonKind(v))
+		}
+		for k, bv := range obj {
+			for _, b := range t.branches {
+				if k == b.branchName() || b.name != "" && k == b.name[strings.LastIndex(b.name, ".")+1:] {
+					return avroJSONValue(b, bv)
+				}
+			}
+			return fmt.Errorf("%q is not in the union", k)
+		}
+	default:
+		return fmt.Errorf("unknown type %q", t.kind)
+	}
+	return nil
+}
+
+// jsonKind describes a decoded JSON value in errors.
+func jsonKind(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
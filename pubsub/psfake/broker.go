@@ -0,0 +1,652 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package psfake
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/iam/apiv1/iampb"
+	"cloud.google.com/go/pubsub"
+	"github.com/googleapis/google-cloud-go-testing/pubsub/psiface"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Broker is an in-memory Pub/Sub service. It holds the topics, subscriptions
+// and messages of any number of projects, and is safe for concurrent use.
+type Broker struct {
+	mu           sync.Mutex
+	now          func() time.Time
+	topics       map[string]*topicState        // by full name
+	subs         map[string]*subscriptionState // by full name
+	snapshots    map[string]*snapshotState     // by full name
+	schemas      map[string]*schemaState       // by full name
+	lastMsgID    int64
+	lastAckID    int64
+	lastSnap     int64         // for generated snapshot names
+	lastRevision int64         // for schema revision IDs
+	changed      chan struct{} // closed and replaced when deliveries change
+
+	policies   map[string]*iampb.Policy // by resource name
+	lastPolicy int64                    // for etags
+	manual     bool                     // set by WithManualDelivery
+	fakeClock  bool                     // set by WithClock
+	timers     []*clockTimer            // waiting for a clock from WithClock
+	signer     TokenSigner
+	done       chan struct{} // closed by Close
+	closed     bool
+	pushers    sync.WaitGroup
+}
+
+// An Option configures a Broker.
+type Option func(*Broker)
+
+// WithClock returns an Option that makes the Broker read the current time
+// from now instead of time.Now. The time is used for publish times, ack
+// deadlines and the DelayThreshold of publish batches. Receivers notice that
+// the time has advanced within pollInterval, so a test can advance its clock
+// past an ack deadline and expect the message to be redelivered shortly
+// after.
+func WithClock(now func() time.Time) Option {
+	return func(b *Broker) {
+		b.now = now
+		b.fakeClock = true
+	}
+}
+
+// clockTimer is a call waiting for a clock from WithClock to reach a time.
+type clockTimer struct {
+	when time.Time
+	f    func()
+}
+
+// afterFunc calls f in its own goroutine once d has passed on the Broker's
+// clock, unless the returned function is called first. A clock from
+// WithClock cannot signal that it advanced, so its timers fire when the
+// Broker next checks the time: when receivers poll for messages, and while
+// PublishResult.Get waits.
+func (b *Broker) afterFunc(d time.Duration, f func()) (stop func()) {
+	if !b.fakeClock {
+		t := time.AfterFunc(d, f)
+		return func() { t.Stop() }
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ct := &clockTimer{when: b.now().Add(d), f: f}
+	b.timers = append(b.timers, ct)
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		for i, x := range b.timers {
+			if x == ct {
+				b.timers = append(b.timers[:i], b.timers[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+func (b *Broker) fireTimers() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.fireTimersLocked()
+}
+
+// fireTimersLocked starts the calls of the timers whose time has come. b.mu
+// must be held.
+func (b *Broker) fireTimersLocked() {
+	if len(b.timers) == 0 {
+		return
+	}
+	now := b.now()
+	var waiting []*clockTimer
+	for _, ct := range b.timers {
+		if now.Before(ct.when) {
+			waiting = append(waiting, ct)
+			continue
+		}
+		go ct.f()
+	}
+	b.timers = waiting
+}
+
+const (
+	defaultAckDeadline = 10 * time.Second
+	minAckDeadline     = 10 * time.Second
+	maxAckDeadline     = 600 * time.Second
+)
+
+// pollInterval is how often waiting receivers check for expired ack
+// deadlines.
+var pollInterval = 10 * time.Millisecond
+
+// NewBroker returns an empty Broker configured by opts.
+func NewBroker(opts ...Option) *Broker {
+	b := &Broker{
+		now:       time.Now,
+		topics:    make(map[string]*topicState),
+		subs:      make(map[string]*subscriptionState),
+		snapshots: make(map[string]*snapshotState),
+		schemas:   make(map[string]*schemaState),
+		policies:  make(map[string]*iampb.Policy),
+		changed:   make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+type topicState struct {
+	name      string
+	cfg       pubsub.TopicConfig
+	subs      map[string]*subscriptionState
+	snapshots map[string]*snapshotState
+	retained  []*message // messages within the topic's retention duration, if it has one
+}
+
+type subscriptionState struct {
+	name        string
+	topic       string // full name of the topic
+	cfg         psiface.SubscriptionConfig
+	filter      filterExpr           // nil if there is no filter
+	queue       []*delivery          // messages waiting to be delivered, in publish order
+	outstanding map[string]*delivery // delivered messages that are not acked, by ack ID
+	busyKeys    map[string]bool      // ordering keys of outstanding messages, if ordering is enabled
+	acked       []*message           // acked messages, if RetainAckedMessages is set
+	published   []*message           // every message published to the subscription
+	ackLog      []event              // acks, in order
+	nackLog     []event              // nacks, in order
+	receivers   []*receiver          // calls to Receive, with WithManualDelivery
+	pushing     bool                 // whether a pusher is running
+	connected   int                  // number of receivers connected
+	lastActive  time.Time            // for the expiration policy
+}
+
+// message is a published message.
+type message struct {
+	seq         int64 // order of publication
+	id          string
+	data        []byte
+	attributes  map[string]string
+	orderingKey string
+	publishTime time.Time
+}
+
+// delivery is a message in a subscription.
+type delivery struct {
+	msg       *message
+	attempts  int       // number of times the message was delivered
+	ackID     string    // set while the message is outstanding
+	deadline  time.Time // ack deadline, while outstanding and not leased
+	leased    bool      // whether a Receive callback is processing the message
+	leaseEnd  time.Time // if not zero, when the lease ends even if the callback is running
+	notBefore time.Time // earliest time of the next delivery, after a failed push
+}
+
+// idRE matches valid topic and subscription IDs.
+var idRE = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9\-_.~+%]{2,254}$`)
+
+// checkID reports an error if id is not a valid topic or subscription ID.
+func checkID(id string) error {
+	if !idRE.MatchString(id) || strings.HasPrefix(id, "goog") {
+		return status.Errorf(codes.InvalidArgument, "invalid resource name given (name=%s)", id)
+	}
+	return nil
+}
+
+// resourceID returns the last element of a resource name.
+func resourceID(name string) string {
+	return name[strings.LastIndex(name, "/")+1:]
+}
+
+// parseName returns the project and ID of a full resource name in the given
+// collection, such as "topics".
+func parseName(name, collection string) (project, id string, ok bool) {
+	parts := strings.Split(name, "/")
+	if len(parts) != 4 || parts[0] != "projects" || parts[2] != collection || checkID(parts[3]) != nil {
+		return "", "", false
+	}
+	return parts[1], parts[3], true
+}
+
+// notifyLocked wakes up receivers waiting for deliveries. b.mu must be held.
+func (b *Broker) notifyLocked() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+func (b *Broker) createTopic(name string, cfg pubsub.TopicConfig) error {
+	if err := checkID(resourceID(name)); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.topics[name] != nil {
+		return status.Errorf(codes.AlreadyExists, "Topic already exists")
+	}
+	if err := b.checkSchemaSettingsLocked(cfg.SchemaSettings); err != nil {
+		return err
+	}
+	if err := checkTopicRetention(cfg); err != nil {
+		return err
+	}
+	if ss := cfg.SchemaSettings; ss != nil {
+		cfg.SchemaSettings = &pubsub.SchemaSettings{}
+		*cfg.SchemaSettings = *ss
+	}
+	b.topics[name] = &topicState{
+		name:      name,
+		cfg:       cfg,
+		subs:      make(map[string]*subscriptionState),
+		snapshots: make(map[string]*snapshotState),
+	}
+	return nil
+}
+
+func (b *Broker) createSubscription(name, topic string, cfg psiface.SubscriptionConfig) error {
+	if err := checkID(resourceID(name)); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.reapLocked()
+	t := b.topics[topic]
+	if t == nil {
+		return status.Errorf(codes.NotFound, "Resource not found (resource=%s).", resourceID(topic))
+	}
+	if b.subs[name] != nil {
+		return status.Errorf(codes.AlreadyExists, "Subscription already exists")
+	}
+	cfg.Topic = nil
+	if err := checkSubscriptionConfig(&cfg); err != nil {
+		return err
+	}
+	var filter filterExpr
+	if cfg.Filter != "" {
+		var err error
+		if filter, err = parseFilter(cfg.Filter); err != nil {
+			return status.Errorf(codes.InvalidArgument, "Invalid filter expression: %v", err)
+		}
+	}
+	s := &subscriptionState{
+		name:        name,
+		topic:       topic,
+		cfg:         cfg,
+		filter:      filter,
+		outstanding: make(map[string]*delivery),
+		busyKeys:    make(map[string]bool),
+		lastActive:  b.now(),
+	}
+	b.subs[name] = s
+	t.subs[name] = s
+	if cfg.PushConfig.Endpoint != "" {
+		b.startPusherLocked(s)
+	}
+	return nil
+}
+
+// checkSubscriptionConfig validates the mutable settings of cfg and sets
+// their defaults.
+func checkSubscriptionConfig(cfg *psiface.SubscriptionConfig) error {
+	if err := checkDeadLetterPolicy(cfg); err != nil {
+		return err
+	}
+	if err := checkExpirationPolicy(cfg); err != nil {
+		return err
+	}
+	switch {
+	case cfg.RetentionDuration == 0:
+		cfg.RetentionDuration = defaultRetentionDuration
+	case cfg.RetentionDuration < minRetentionDuration || cfg.RetentionDuration > maxRetentionDuration:
+		return status.Errorf(codes.InvalidArgument, "The message retention duration must be between %v and %v", minRetentionDuration, maxRetentionDuration)
+	}
+	switch {
+	case cfg.AckDeadline == 0:
+		cfg.AckDeadline = defaultAckDeadline
+	case cfg.AckDeadline < minAckDeadline || cfg.AckDeadline > maxAckDeadline:
+		return status.Errorf(codes.InvalidArgument, "The ack deadline must be between %d and %d seconds", minAckDeadline/time.Second, maxAckDeadline/time.Second)
+	}
+	return nil
+}
+
+func (b *Broker) subscriptionExists(name string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.reapLocked()
+	return b.subs[name] != nil
+}
+
+func (b *Broker) deleteSubscription(name string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s, err := b.subscriptionLocked(name)
+	if err != nil {
+		return err
+	}
+	b.deleteSubscriptionLocked(s)
+	return nil
+}
+
+func (b *Broker) deleteSubscriptionLocked(s *subscriptionState) {
+	delete(b.subs, s.name)
+	if t := b.topics[s.topic]; t != nil {
+		delete(t.subs, s.name)
+	}
+	b.notifyLocked()
+}
+
+// publish publishes a batch of messages to the topic, returning their IDs.
+// Like a publish request to the service, it fails for all the messages or for
+// none.
+func (b *Broker) publish(topic string, msgs []*pendingMessage) ([]string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.reapLocked()
+	t := b.topics[topic]
+	if t == nil {
+		return nil, status.Errorf(codes.NotFound, "Resource not found (resource=%s).", resourceID(topic))
+	}
+	// Validate every message first, so that none is published if one fails.
+	attrs := make([]map[string]string, len(msgs))
+	for i, m := range msgs {
+		schemaAttrs, err := b.validateLocked(t, m.data)
+		if err != nil {
+			return nil, err
+		}
+		attrs[i] = m.attributes
+		if schemaAttrs != nil {
+			attrs[i] = make(map[string]string, len(m.attributes)+len(schemaAttrs))
+			for k, v := range m.attributes {
+				attrs[i][k] = v
+			}
+			for k, v := range schemaAttrs {
+				attrs[i][k] = v
+			}
+		}
+	}
+	ids := make([]string, len(msgs))
+	for i, m := range msgs {
+		ids[i] = b.publishLocked(t, m.data, attrs[i], m.orderingKey).id
+	}
+	return ids, nil
+}
+
+// publishLocked adds a message to every subscription of t whose filter it
+// matches. b.mu must be held.
+func (b *Broker) publishLocked(t *topicState, data []byte, attrs map[string]string, orderingKey string) *message {
+	b.lastMsgID++
+	m := &message{
+		seq:         b.lastMsgID,
+		id:          strconv.FormatInt(b.lastMsgID, 10),
+		data:        append([]byte(nil), data...),
+		orderingKey: orderingKey,
+		publishTime: b.now(),
+	}
+	if len(attrs) > 0 {
+		m.attributes = make(map[string]string, len(attrs))
+		for k, v := range attrs {
+			m.attributes[k] = v
+		}
+	}
+	for _, s := range t.subs {
+		if s.filter == nil || s.filter.matches(m.attributes) {
+			s.queue = append(s.queue, &delivery{msg: m})
+			s.published = append(s.published, m)
+		}
+	}
+	for _, sn := range t.snapshots {
+		sn.msgs = append(sn.msgs, m)
+	}
+	if topicRetention(t.cfg) > 0 {
+		t.retained = append(t.retained, m)
+		b.pruneTopicLocked(t)
+	}
+	b.notifyLocked()
+	return m
+}
+
+// next removes the next message waiting in the subscription and leases it to
+// a receiver, or to the pusher if push is set. If the subscription has message
+// ordering enabled, messages with an ordering key are skipped while an earlier
+// message with the same key is outstanding or waiting to be pushed again. If
+// there is no message, it returns a channel that is closed when that may have
+// changed.
+//
+// The lease lasts until the message is released, acked or nacked, but no
+// longer than maxLease if it is positive. If maxLease is negative, the
+// message is not leased, and its ack deadline starts immediately. The
+// returned delivery is a copy, which the caller may read without b.mu.
+func (b *Broker) next(sub string, push bool, maxLease time.Duration) (*delivery, <-chan struct{}, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s, err := b.subscriptionLocked(sub)
+	if err != nil {
+		return nil, nil, err
+	}
+	if isPush := s.cfg.PushConfig.Endpoint != ""; isPush != push {
+		if push {
+			s.pushing = false
+		}
+		if isPush {
+			return nil, nil, status.Errorf(codes.FailedPrecondition, "Subscription %s is a push subscription", resourceID(sub))
+		}
+		return nil, nil, status.Errorf(codes.FailedPrecondition, "Subscription %s is not a push subscription", resourceID(sub))
+	}
+	b.fireTimersLocked()
+	b.expireLocked(s)
+	b.pruneLocked(s)
+	now := b.now()
+	if !push {
+		s.lastActive = now
+	}
+	var delayedKeys map[string]bool
+	i := 0
+	for ; i < len(s.queue); i++ {
+		k := s.queue[i].msg.orderingKey
+		if s.busyKeys[k] || delayedKeys[k] {
+			continue
+		}
+		if now.Before(s.queue[i].notBefore) {
+			if k != "" && s.cfg.EnableMessageOrdering {
+				if delayedKeys == nil {
+					delayedKeys = make(map[string]bool)
+				}
+				delayedKeys[k] = true
+			}
+			continue
+		}
+		break
+	}
+	if i == len(s.queue) {
+		return nil, b.changed, nil
+	}
+	d := s.queue[i]
+	s.queue = append(s.queue[:i], s.queue[i+1:]...)
+	if k := d.msg.orderingKey; k != "" && s.cfg.EnableMessageOrdering {
+		s.busyKeys[k] = true
+	}
+	b.lastAckID++
+	d.ackID = fmt.Sprintf("%s/%d", resourceID(sub), b.lastAckID)
+	d.attempts++
+	d.leased = true
+	d.leaseEnd = time.Time{}
+	switch {
+	case maxLease > 0:
+		d.leaseEnd = now.Add(maxLease)
+	case maxLease < 0:
+		d.leased = false
+		d.deadline = now.Add(s.cfg.AckDeadline)
+	}
+	s.outstanding[d.ackID] = d
+	cp := *d
+	return &cp, nil, nil
+}
+
+// held removes from sizes the ack IDs of the messages that are no longer
+// outstanding in the subscription, because they were acked, nacked or
+// expired, and returns the number and total size of the others, and a
+// channel that is closed when that may have changed.
+func (b *Broker) held(sub string, sizes map[string]int) (n, size int, changed <-chan struct{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.reapLocked()
+	b.fireTimersLocked()
+	s := b.subs[sub]
+	if s != nil {
+		b.expireLocked(s)
+	}
+	for ackID, sz := range sizes {
+		if s == nil || s.outstanding[ackID] == nil {
+			delete(sizes, ackID)
+			continue
+		}
+		n++
+		size += sz
+	}
+	return n, size, b.changed
+}
+
+// expireLocked returns the outstanding messages of s whose ack deadlines have
+// passed, or whose leases have ended, to its queue. b.mu must be held.
+func (b *Broker) expireLocked(s *subscriptionState) {
+	now := b.now()
+	for ackID, d := range s.outstanding {
+		leased := d.leased && (d.leaseEnd.IsZero() || !now.After(d.leaseEnd))
+		if !leased && (d.leased || !now.Before(d.deadline)) {
+			delete(s.outstanding, ackID)
+			b.requeueLocked(s, d)
+		}
+	}
+}
+
+// requeueLocked puts an outstanding message back in the queue of s, in
+// publish order, for redelivery, unless it is forwarded to the dead-letter
+// topic of s. b.mu must be held.
+func (b *Broker) requeueLocked(s *subscriptionState, d *delivery) {
+	delete(s.busyKeys, d.msg.orderingKey)
+	if b.deadLetterLocked(s, d) {
+		return
+	}
+	d.ackID = ""
+	d.leased = false
+	i := sort.Search(len(s.queue), func(i int) bool { return s.queue[i].msg.seq > d.msg.seq })
+	s.queue = append(s.queue, nil)
+	copy(s.queue[i+1:], s.queue[i:])
+	s.queue[i] = d
+}
+
+// release ends the lease of an outstanding message when the Receive callback
+// returns, starting its ack deadline.
+func (b *Broker) release(sub, ackID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.subs[sub]
+	if s == nil {
+		return
+	}
+	if d := s.outstanding[ackID]; d != nil {
+		d.leased = false
+		d.deadline = b.now().Add(s.cfg.AckDeadline)
+	}
+}
+
+// ack removes an outstanding message from the subscription. Acks for messages
+// that are no longer outstanding, because their deadline expired, are
+// ignored.
+func (b *Broker) ack(sub, ackID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.subs[sub]
+	if s == nil {
+		return
+	}
+	s.lastActive = b.now()
+	d := s.outstanding[ackID]
+	if d == nil {
+		return
+	}
+	delete(s.outstanding, ackID)
+	s.ackLog = append(s.ackLog, event{d.msg, d.attempts})
+	if s.cfg.RetainAckedMessages {
+		s.acked = append(s.acked, d.msg)
+	}
+	if s.busyKeys[d.msg.orderingKey] {
+		delete(s.busyKeys, d.msg.orderingKey)
+		b.notifyLocked()
+	}
+}
+
+// nack returns an outstanding message to the subscription's queue for
+// immediate redelivery.
+func (b *Broker) nack(sub, ackID string) {
+	b.nackWithDelay(sub, ackID, 0)
+}
+
+// nackWithDelay returns an outstanding message to the subscription's queue
+// for redelivery after the delay.
+func (b *Broker) nackWithDelay(sub, ackID string, delay time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.subs[sub]
+	if s == nil {
+		return
+	}
+	if d := s.outstanding[ackID]; d != nil {
+		b.nackLocked(s, d, delay)
+	}
+}
+
+// nackLocked returns an outstanding message to the queue of s for redelivery
+// after the delay. b.mu must be held.
+func (b *Broker) nackLocked(s *subscriptionState, d *delivery, delay time.Duration) {
+	delete(s.outstanding, d.ackID)
+	s.nackLog = append(s.nackLog, event{d.msg, d.attempts})
+	d.notBefore = b.now().Add(delay)
+	b.requeueLocked(s, d)
+	b.notifyLocked()
+}
+
+// modifyAckDeadline sets the ack deadlines of outstanding messages to d from
+// now, ending their leases. A zero d nacks them. Ack IDs of messages that are
+// no longer outstanding are ignored.
+func (b *Broker) modifyAckDeadline(sub string, ackIDs []string, d time.Duration) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s, err := b.subscriptionLocked(sub)
+	if err != nil {
+		return err
+	}
+	s.lastActive = b.now()
+	for _, ackID := range ackIDs {
+		dl := s.outstanding[ackID]
+		switch {
+		case dl == nil:
+		case d == 0:
+			b.nackLocked(s, dl, 0)
+		default:
+			dl.leased = false
+			dl.deadline = b.now().Add(d)
+		}
+	}
+	return nil
+}
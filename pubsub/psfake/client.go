@@ -0,0 +1,474 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package psfake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/googleapis/google-cloud-go-testing/pubsub/psiface"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Client implements psiface.Client for the topics and subscriptions of a
+// project in a Broker.
+type Client struct {
+	psiface.Client
+	b       *Broker
+	project string
+}
+
+// Client returns a client for the project with the given ID.
+func (b *Broker) Client(projectID string) *Client {
+	return &Client{b: b, project: projectID}
+}
+
+// errOrderingNotEnabled is the error of the pubsub package for a message with
+// an ordering key published to a topic without message ordering.
+var errOrderingNotEnabled = errors.New("Topic.EnableMessageOrdering=false, but an OrderingKey was set in Message. Please remove the OrderingKey or turn on Topic.EnableMessageOrdering")
+
+// topic implements psiface.Topic. Like a pubsub.Topic, it holds the
+// publishing state of ordering keys.
+type topic struct {
+	psiface.Topic
+	c    *Client
+	name string
+
+	mu       sync.Mutex
+	ordering bool
+	paused   map[string]bool // ordering keys paused by a failed publish
+	stopped  bool
+	settings pubsub.PublishSettings
+	batch    *batch        // messages waiting to be published, if any
+	flushed  chan struct{} // closed and replaced when a batch is published
+
+	// Count and size of the messages accepted by Publish whose results are
+	// not ready, for flow control.
+	unpublished      int
+	unpublishedBytes int
+}
+
+// subscription implements psiface.Subscription.
+type subscription struct {
+	psiface.Subscription
+	c        *Client
+	name     string
+	mu       sync.Mutex
+	settings pubsub.ReceiveSettings
+}
+
+// CreateTopic creates a new topic.
+func (c *Client) CreateTopic(ctx context.Context, topicID string) (psiface.Topic, error) {
+	t := c.topic(topicID)
+	if err := c.b.createTopic(t.name, pubsub.TopicConfig{}); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// CreateTopicWithConfig creates a new topic with the given configuration.
+// If it has SchemaSettings, the schema must exist in the Broker, and messages
+// that do not conform to it are rejected when they are published.
+func (c *Client) CreateTopicWithConfig(ctx context.Context, topicID string, tc *pubsub.TopicConfig) (psiface.Topic, error) {
+	t := c.topic(topicID)
+	var cfg pubsub.TopicConfig
+	if tc != nil {
+		cfg = *tc
+	}
+	if err := c.b.createTopic(t.name, cfg); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Topic returns a reference to the topic with the given ID, which may not
+// exist.
+func (c *Client) Topic(id string) psiface.Topic {
+	return c.topic(id)
+}
+
+func (c *Client) topic(id string) *topic {
+	return &topic{
+		c:        c,
+		name:     fmt.Sprintf("projects/%s/topics/%s", c.project, id),
+		paused:   make(map[string]bool),
+		settings: defaultPublishSettings,
+		flushed:  make(chan struct{}),
+	}
+}
+
+// CreateSubscription creates a new subscription to cfg.Topic, which may be
+// any psiface.Topic whose String method returns the topic's full name.
+func (c *Client) CreateSubscription(ctx context.Context, id string, cfg psiface.SubscriptionConfig) (psiface.Subscription, error) {
+	if cfg.Topic == nil {
+		return nil, status.Errorf(codes.InvalidArgument, "the subscription's topic is not set")
+	}
+	s := c.subscription(id)
+	if err := c.b.createSubscription(s.name, cfg.Topic.String(), cfg); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Subscription returns a reference to the subscription with the given ID,
+// which may not exist.
+func (c *Client) Subscription(id string) psiface.Subscription {
+	return c.subscription(id)
+}
+
+func (c *Client) subscription(id string) *subscription {
+	return &subscription{c: c, name: fmt.Sprintf("projects/%s/subscriptions/%s", c.project, id)}
+}
+
+// Snapshot returns a reference to the snapshot with the given ID, which may
+// not exist.
+func (c *Client) Snapshot(id string) psiface.Snapshot {
+	return &snapshot{c: c, name: fmt.Sprintf("projects/%s/snapshots/%s", c.project, id)}
+}
+
+// Snapshots returns an iterator over the snapshots of the project, ordered by
+// name.
+func (c *Client) Snapshots(ctx context.Context) psiface.SnapshotConfigIterator {
+	it := &snapshotConfigIterator{}
+	for _, sn := range c.b.listSnapshots(c.project) {
+		it.cfgs = append(it.cfgs, c.snapshotConfig(sn))
+	}
+	return it
+}
+
+func (c *Client) snapshotConfig(sn snapshotState) *psiface.SnapshotConfig {
+	project, id, _ := parseName(sn.topic, "topics")
+	return &psiface.SnapshotConfig{
+		SnapshotConfig: pubsub.SnapshotConfig{Expiration: sn.expiration},
+		Snapshot:       &snapshot{c: c, name: sn.name},
+		Topic:          c.b.Client(project).topic(id),
+	}
+}
+
+// String returns the full name of the topic.
+func (t *topic) String() string {
+	return t.name
+}
+
+// SetEnableMessageOrdering enables or disables publishing messages with
+// ordering keys.
+func (t *topic) SetEnableMessageOrdering(enabled bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ordering = enabled
+}
+
+// ResumePublish resumes publishing for the ordering key after a failure.
+func (t *topic) ResumePublish(orderingKey string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.paused, orderingKey)
+}
+
+// String returns the full name of the subscription.
+func (s *subscription) String() string {
+	return s.name
+}
+
+// Exists reports whether the subscription exists.
+func (s *subscription) Exists(ctx context.Context) (bool, error) {
+	return s.c.b.subscriptionExists(s.name), nil
+}
+
+// Delete deletes the subscription. Its outstanding messages are dropped.
+func (s *subscription) Delete(ctx context.Context) error {
+	return s.c.b.deleteSubscription(s.name)
+}
+
+// Receive calls f with the messages of the subscription, concurrently, until
+// ctx is done, when it returns nil, or the subscription is deleted, when it
+// returns an error with code NotFound. In either case, it first waits for the
+// calls to f to return. It fails with FailedPrecondition for push
+// subscriptions. Several calls to Receive may run concurrently; each message
+// is delivered to one of them.
+//
+// As with the pubsub package, a message counts against the
+// MaxOutstandingMessages and MaxOutstandingBytes (the size of its data) of
+// the ReceiveSettings, by default 1000 messages and 1e9 bytes, until it is
+// acked or nacked or its ack deadline expires. Receive stops pulling messages
+// while either limit is reached; negative limits mean no limit. Unlike the
+// pubsub package, where NumGoroutines is the number of streams pulling
+// messages, at most NumGoroutines calls to f (10 by default) run at once, so
+// setting it to 1 makes Receive call f with one message at a time.
+//
+// A message's ack deadline is extended while f runs, for up to MaxExtension
+// (60 minutes by default), and starts when f returns. If MaxExtension is
+// negative, the deadline starts when the message is delivered. A message
+// that is not acked before its deadline is redelivered; a message that is
+// nacked is redelivered immediately.
+//
+// If the Broker has the WithManualDelivery option, Receive only calls f with
+// the messages delivered by Client.Deliver, and the outstanding message
+// limits do not apply.
+func (s *subscription) Receive(ctx context.Context, f func(context.Context, psiface.Message)) error {
+	settings := s.ReceiveSettings()
+	maxMessages := settings.MaxOutstandingMessages
+	if maxMessages == 0 {
+		maxMessages = pubsub.DefaultReceiveSettings.MaxOutstandingMessages
+	}
+	maxBytes := settings.MaxOutstandingBytes
+	if maxBytes == 0 {
+		maxBytes = pubsub.DefaultReceiveSettings.MaxOutstandingBytes
+	}
+	numGoroutines := settings.NumGoroutines
+	if numGoroutines <= 0 {
+		numGoroutines = pubsub.DefaultReceiveSettings.NumGoroutines
+	}
+	maxExtension := settings.MaxExtension
+	if maxExtension == 0 {
+		maxExtension = pubsub.DefaultReceiveSettings.MaxExtension
+	}
+
+	b := s.c.b
+	defer b.connect(s.name)()
+	if b.manual {
+		return b.receiveManual(ctx, s.name, f, numGoroutines, maxExtension)
+	}
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	held := make(map[string]int) // data sizes of the messages counted against the limits, by ack ID
+	running := make(chan struct{}, numGoroutines)
+	for ctx.Err() == nil {
+		n, size, wait := b.held(s.name, held)
+		if maxMessages > 0 && n >= maxMessages || maxBytes > 0 && size >= maxBytes {
+			select {
+			case <-ctx.Done():
+			case <-wait:
+			case <-ticker.C:
+			}
+			continue
+		}
+		select {
+		case running <- struct{}{}:
+		case <-ctx.Done():
+			continue
+		}
+		d, wait, err := b.next(s.name, false, maxExtension)
+		if err != nil {
+			return err
+		}
+		if d == nil {
+			<-running
+			select {
+			case <-ctx.Done():
+			case <-wait:
+			case <-ticker.C:
+			}
+			continue
+		}
+		held[d.ackID] = len(d.msg.data)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-running }()
+			f(ctx, newReceivedMessage(b, s.name, d))
+			b.release(s.name, d.ackID)
+		}()
+	}
+	return nil
+}
+
+// ReceiveSettings returns the settings of Receive for this handle.
+func (s *subscription) ReceiveSettings() pubsub.ReceiveSettings {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.settings
+}
+
+// SetReceiveSettings sets the settings of later calls to Receive on this
+// handle, as the ReceiveSettings field of a pubsub.Subscription does.
+func (s *subscription) SetReceiveSettings(settings pubsub.ReceiveSettings) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.settings = settings
+}
+
+// SeekToTime marks the messages retained by the subscription that were
+// published before t as acked, and those published at or after t as unacked.
+// Acked messages are only retained if the subscription has
+// RetainAckedMessages set, and no messages are retained for longer than its
+// RetentionDuration.
+func (s *subscription) SeekToTime(ctx context.Context, t time.Time) error {
+	return s.c.b.seekToTime(s.name, t)
+}
+
+// CreateSnapshot creates a snapshot of the subscription, which retains the
+// messages that are unacked in it and the messages published to its topic
+// afterwards. If name is empty, a unique name is assigned.
+func (s *subscription) CreateSnapshot(ctx context.Context, name string) (*psiface.SnapshotConfig, error) {
+	sn, err := s.c.b.createSnapshot(fmt.Sprintf("projects/%s/snapshots/%s", s.c.project, name), s.name)
+	if err != nil {
+		return nil, err
+	}
+	return s.c.snapshotConfig(sn), nil
+}
+
+// SeekToSnapshot marks the messages retained by the snapshot as unacked, and
+// all other messages as acked. The snapshot must be in the subscription's
+// project and for its topic.
+func (s *subscription) SeekToSnapshot(ctx context.Context, snap psiface.Snapshot) error {
+	return s.c.b.seekToSnapshot(s.name, fmt.Sprintf("projects/%s/snapshots/%s", s.c.project, snap.ID()))
+}
+
+// snapshot implements psiface.Snapshot.
+type snapshot struct {
+	psiface.Snapshot
+	c    *Client
+	name string
+}
+
+// ID returns the ID of the snapshot.
+func (s *snapshot) ID() string {
+	return resourceID(s.name)
+}
+
+// Delete deletes the snapshot.
+func (s *snapshot) Delete(ctx context.Context) error {
+	return s.c.b.deleteSnapshot(s.name)
+}
+
+// snapshotConfigIterator implements psiface.SnapshotConfigIterator.
+type snapshotConfigIterator struct {
+	psiface.SnapshotConfigIterator
+	cfgs []*psiface.SnapshotConfig
+}
+
+func (it *snapshotConfigIterator) Next() (*psiface.SnapshotConfig, error) {
+	if len(it.cfgs) == 0 {
+		return nil, iterator.Done
+	}
+	cfg := it.cfgs[0]
+	it.cfgs = it.cfgs[1:]
+	return cfg, nil
+}
+
+// receivedMessage implements psiface.Message for a delivered message.
+type receivedMessage struct {
+	psiface.Message
+	b       *Broker
+	sub     string
+	ackID   string
+	msg     *message
+	data    []byte
+	attempt int
+	once    sync.Once
+}
+
+func newReceivedMessage(b *Broker, sub string, d *delivery) *receivedMessage {
+	return &receivedMessage{
+		b:       b,
+		sub:     sub,
+		ackID:   d.ackID,
+		msg:     d.msg,
+		data:    append([]byte(nil), d.msg.data...),
+		attempt: d.attempts,
+	}
+}
+
+func (m *receivedMessage) ID() string {
+	return m.msg.id
+}
+
+func (m *receivedMessage) Data() []byte {
+	return m.data
+}
+
+func (m *receivedMessage) Attributes() map[string]string {
+	return m.msg.attributes
+}
+
+func (m *receivedMessage) PublishTime() time.Time {
+	return m.msg.publishTime
+}
+
+func (m *receivedMessage) OrderingKey() string {
+	return m.msg.orderingKey
+}
+
+// DeliveryAttempt returns the number of times the message has been delivered
+// to the subscription, starting at 1. Unlike the service, which sets it only
+// for subscriptions with a dead-letter policy, the Broker always sets it.
+func (m *receivedMessage) DeliveryAttempt() *int {
+	n := m.attempt
+	return &n
+}
+
+// Ack acknowledges the message. Calls to Ack or Nack have no effect after the
+// first.
+func (m *receivedMessage) Ack() {
+	m.once.Do(func() { m.b.ack(m.sub, m.ackID) })
+}
+
+// Nack makes the message available for redelivery immediately.
+func (m *receivedMessage) Nack() {
+	m.once.Do(func() { m.b.nack(m.sub, m.ackID) })
+}
+
+// publishResult implements psiface.PublishResult.
+type publishResult struct {
+	psiface.PublishResult
+	b     *Broker // whose clock timers Get checks while it waits, if any
+	ready chan struct{}
+	id    string
+	err   error
+}
+
+func newPublishResult(id string, err error) *publishResult {
+	r := &publishResult{ready: make(chan struct{})}
+	r.set(id, err)
+	return r
+}
+
+// set makes the result ready.
+func (r *publishResult) set(id string, err error) {
+	r.id, r.err = id, err
+	close(r.ready)
+}
+
+// Get returns the server-assigned ID of the message, or the error that
+// prevented it from being published. It blocks until the result is ready or
+// ctx is done. While it waits, it publishes the message's batch once the
+// Broker's clock passes its DelayThreshold.
+func (r *publishResult) Get(ctx context.Context) (string, error) {
+	var tick <-chan time.Time
+	if r.b != nil && r.b.fakeClock {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-r.ready:
+			return r.id, r.err
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-tick:
+			r.b.fireTimers()
+		}
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package psfake
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/googleapis/google-cloud-go-testing/pubsub/psiface"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Attributes added to messages forwarded to a dead-letter topic, as by the
+// service.
+const (
+	DeadLetterDeliveryCountAttribute       = "CloudPubSubDeadLetterSourceDeliveryCount"
+	DeadLetterSubscriptionAttribute        = "CloudPubSubDeadLetterSourceSubscription"
+	DeadLetterSubscriptionProjectAttribute = "CloudPubSubDeadLetterSourceSubscriptionProject"
+	DeadLetterTopicPublishTimeAttribute    = "CloudPubSubDeadLetterSourceTopicPublishTime"
+)
+
+const (
+	defaultMaxDeliveryAttempts = 5
+	minMaxDeliveryAttempts     = 5
+	maxMaxDeliveryAttempts     = 100
+)
+
+// checkDeadLetterPolicy validates the dead-letter policy of cfg, if any, and
+// sets its defaults.
+func checkDeadLetterPolicy(cfg *psiface.SubscriptionConfig) error {
+	p := cfg.DeadLetterPolicy
+	if p == nil {
+		return nil
+	}
+	if _, _, ok := parseName(p.DeadLetterTopic, "topics"); !ok {
+		return status.Errorf(codes.InvalidArgument, "Invalid dead letter topic name: %q", p.DeadLetterTopic)
+	}
+	p2 := *p
+	switch {
+	case p2.MaxDeliveryAttempts == 0:
+		p2.MaxDeliveryAttempts = defaultMaxDeliveryAttempts
+	case p2.MaxDeliveryAttempts < minMaxDeliveryAttempts || p2.MaxDeliveryAttempts > maxMaxDeliveryAttempts:
+		return status.Errorf(codes.InvalidArgument, "max_delivery_attempts must be between %d and %d", minMaxDeliveryAttempts, maxMaxDeliveryAttempts)
+	}
+	cfg.DeadLetterPolicy = &p2
+	return nil
+}
+
+// deadLetterLocked forwards d to the dead-letter topic of s, and reports
+// whether it did, if d has reached the maximum number of delivery attempts.
+// Messages are not forwarded while the dead-letter topic does not exist.
+// b.mu must be held.
+func (b *Broker) deadLetterLocked(s *subscriptionState, d *delivery) bool {
+	p := s.cfg.DeadLetterPolicy
+	if p == nil || d.attempts < p.MaxDeliveryAttempts {
+		return false
+	}
+	t := b.topics[p.DeadLetterTopic]
+	if t == nil {
+		return false
+	}
+	project, _, _ := parseName(s.name, "subscriptions")
+	attrs := make(map[string]string, len(d.msg.attributes)+4)
+	for k, v := range d.msg.attributes {
+		attrs[k] = v
+	}
+	attrs[DeadLetterDeliveryCountAttribute] = strconv.Itoa(d.attempts)
+	attrs[DeadLetterSubscriptionAttribute] = resourceID(s.name)
+	attrs[DeadLetterSubscriptionProjectAttribute] = project
+	attrs[DeadLetterTopicPublishTimeAttribute] = d.msg.publishTime.UTC().Format(time.RFC3339Nano)
+	b.publishLocked(t, d.msg.data, attrs, d.msg.orderingKey)
+	return true
+}
@@ -0,0 +1,198 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package psfake
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/googleapis/google-cloud-go-testing/pubsub/psiface"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// WithManualDelivery returns an Option that stops Receive from pulling
+// messages on its own: messages are only delivered to running calls to
+// Receive by Client.Deliver, which waits for the callbacks to return. Push
+// subscriptions are not affected.
+func WithManualDelivery() Option {
+	return func(b *Broker) {
+		b.manual = true
+	}
+}
+
+// receiver is a call to Receive with WithManualDelivery.
+type receiver struct {
+	ctx          context.Context
+	f            func(context.Context, psiface.Message)
+	running      chan struct{} // holds a value per running call to f
+	maxExtension time.Duration
+	calls        sync.WaitGroup // calls to f, added while the receiver is registered
+}
+
+// receiveManual registers a receiver for the subscription, and waits until
+// ctx is done or the subscription is deleted, and then for the calls to f.
+func (b *Broker) receiveManual(ctx context.Context, sub string, f func(context.Context, psiface.Message), numGoroutines int, maxExtension time.Duration) error {
+	r := &receiver{
+		ctx:          ctx,
+		f:            f,
+		running:      make(chan struct{}, numGoroutines),
+		maxExtension: maxExtension,
+	}
+	b.mu.Lock()
+	s, err := b.subscriptionLocked(sub)
+	if err != nil {
+		b.mu.Unlock()
+		return err
+	}
+	if s.cfg.PushConfig.Endpoint != "" {
+		b.mu.Unlock()
+		return status.Errorf(codes.FailedPrecondition, "Subscription %s is a push subscription", resourceID(sub))
+	}
+	s.receivers = append(s.receivers, r)
+	b.notifyLocked()
+	for ctx.Err() == nil {
+		if b.subs[sub] != s {
+			err = status.Errorf(codes.NotFound, "Resource not found (resource=%s).", resourceID(sub))
+			break
+		}
+		changed := b.changed
+		b.mu.Unlock()
+		select {
+		case <-ctx.Done():
+		case <-changed:
+		}
+		b.mu.Lock()
+	}
+	for i, rr := range s.receivers {
+		if rr == r {
+			s.receivers = append(s.receivers[:i], s.receivers[i+1:]...)
+			break
+		}
+	}
+	b.mu.Unlock()
+	r.calls.Wait()
+	return err
+}
+
+// Deliver delivers the messages that are waiting in the subscription with the
+// given ID to the calls to Receive running on it, and waits until the
+// callbacks return. It returns the number of messages delivered. The Broker
+// must have the WithManualDelivery option.
+//
+// If no call to Receive is running on the subscription, Deliver first waits
+// for one, until ctx is done. Messages are given to the calls to Receive in
+// turn, and in publish order, up to their NumGoroutines at once. Messages
+// that become available while the callbacks run, such as nacked messages or
+// later messages with the ordering key of an acked one, are left for the
+// next call to Deliver.
+func (c *Client) Deliver(ctx context.Context, subID string) (int, error) {
+	b := c.b
+	if !b.manual {
+		return 0, fmt.Errorf("psfake: Deliver requires the WithManualDelivery option")
+	}
+	name := fmt.Sprintf("projects/%s/subscriptions/%s", c.project, subID)
+	b.mu.Lock()
+	for {
+		s, err := b.subscriptionLocked(name)
+		if err != nil {
+			b.mu.Unlock()
+			return 0, err
+		}
+		if len(s.receivers) > 0 {
+			break
+		}
+		changed := b.changed
+		b.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-changed:
+		}
+		b.mu.Lock()
+	}
+	b.mu.Unlock()
+
+	// Take all the messages before calling any callback, so that those the
+	// callbacks make available are left for the next call.
+	var (
+		ds []*delivery
+		rs []*receiver // the receiver of each delivery
+	)
+	for i := 0; ; i++ {
+		b.mu.Lock()
+		s := b.subs[name]
+		if s == nil || len(s.receivers) == 0 {
+			b.mu.Unlock()
+			break
+		}
+		r := s.receivers[i%len(s.receivers)]
+		r.calls.Add(1)
+		b.mu.Unlock()
+		d, _, err := b.next(name, false, r.maxExtension)
+		if d == nil {
+			r.calls.Done()
+		}
+		if err != nil {
+			for i, d := range ds {
+				b.release(name, d.ackID)
+				rs[i].calls.Done()
+			}
+			return 0, err
+		}
+		if d == nil {
+			break
+		}
+		ds = append(ds, d)
+		rs = append(rs, r)
+	}
+
+	var wg sync.WaitGroup
+	for i, d := range ds {
+		r := rs[i]
+		r.running <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer r.calls.Done()
+			r.f(r.ctx, newReceivedMessage(b, name, d))
+			<-r.running
+			b.release(name, d.ackID)
+		}()
+	}
+	wg.Wait()
+	return len(ds), nil
+}
+
+// Pull returns up to max messages waiting in the subscription with the given
+// ID, or all of them if max is not positive, without waiting for more. The
+// ack deadlines of the returned messages have started.
+func (c *Client) Pull(subID string, max int) ([]psiface.Message, error) {
+	name := fmt.Sprintf("projects/%s/subscriptions/%s", c.project, subID)
+	var msgs []psiface.Message
+	for max <= 0 || len(msgs) < max {
+		d, _, err := c.b.next(name, false, -1)
+		if err != nil {
+			return nil, err
+		}
+		if d == nil {
+			break
+		}
+		msgs = append(msgs, newReceivedMessage(c.b, name, d))
+	}
+	return msgs, nil
+}
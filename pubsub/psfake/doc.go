@@ -0,0 +1,142 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package psfake provides an in-memory Pub/Sub service, Broker, and clients
+// for it that implement the interfaces in
+// github.com/googleapis/google-cloud-go-testing/pubsub/psiface.
+//
+// Each subscription receives every message published to its topic after the
+// subscription was created, independently of the other subscriptions.
+// Messages are given increasing IDs and the time at which they were
+// published, and a message delivered by Receive remains outstanding until it
+// is acknowledged:
+//
+//    broker := psfake.NewBroker()
+//    client := broker.Client("my-project")
+//    topic, err := client.CreateTopic(ctx, "my-topic")
+//    ...
+//    sub, err := client.CreateSubscription(ctx, "my-sub", psiface.SubscriptionConfig{Topic: topic})
+//    ...
+//    id, err := topic.Publish(ctx, msg).Get(ctx)
+//
+// Publish batches messages as the pubsub package does, following the
+// PublishSettings of the topic handle: a batch is published when it reaches
+// CountThreshold messages or ByteThreshold bytes, when Flush or Stop is
+// called, or when the Broker's clock passes its DelayThreshold. The
+// CountThreshold of a new handle is 1, as its PublishSettings report, so
+// each message is published at once until SetPublishSettings sets a larger
+// one. With a clock from WithClock, the DelayThreshold of a partial batch is
+// noticed when receivers poll or a PublishResult's Get waits, after the
+// clock is advanced. Publish enforces the message size limit, the
+// BufferedByteLimit and publisher flow control.
+//
+// Delivery
+//
+// Delivery is at least once, as with the service. A message delivered by
+// Receive is leased to the receiver while the callback runs, for up to the
+// MaxExtension of the subscription handle's ReceiveSettings; when the
+// callback returns, the message's ack deadline starts, taken from the
+// subscription's AckDeadline (10 seconds by default). A message that is not
+// acked by its deadline, or is nacked, is returned to the subscription and
+// delivered again, before messages published after it. Each delivery
+// increments the message's delivery attempt, available from its
+// DeliveryAttempt method.
+//
+// Receive runs callbacks concurrently, up to the NumGoroutines of the
+// ReceiveSettings, and stops pulling messages while the unacked messages it
+// delivered reach MaxOutstandingMessages or MaxOutstandingBytes.
+//
+// If the subscription has EnableMessageOrdering set, a message with an
+// ordering key is not delivered while an earlier message with the same key is
+// outstanding, so messages with the same key are received one at a time, in
+// publish order, including when one is nacked or expires and is redelivered.
+//
+// If the subscription has a DeadLetterPolicy, a message that has been
+// delivered MaxDeliveryAttempts times (5 by default) and is nacked or expires
+// again is published to the dead-letter topic instead, with the
+// DeadLetter*Attribute attributes added, and removed from the subscription.
+// Messages stay in the subscription while the dead-letter topic does not
+// exist.
+//
+// Messages of subscriptions with a PushConfig endpoint, such as the URL of an
+// httptest.Server, are POSTed to it as PushRequests, one at a time. A 102 or
+// 2xx response acks the message; any other response or error nacks it, and
+// it is pushed again after an exponential backoff, within the bounds of the
+// subscription's RetryPolicy if it has one. Push requests carry a token from
+// the WithTokenSigner option, issued at the time of the Broker's clock, if
+// the PushConfig has an OIDCToken authentication method. Call Close to stop
+// pushing.
+//
+// Subscriptions retain unacked messages for their RetentionDuration (7 days
+// by default), and acked messages too if RetainAckedMessages is set, so that
+// SeekToTime can mark them unacked again. A topic with a RetentionDuration
+// retains all its messages for that long: its subscriptions keep unacked
+// messages for at least as long, and SeekToTime on them can bring back
+// messages published before they were created. Snapshots retain the
+// messages that were unacked when they were created and those published
+// afterwards, for 7 days after the publication of the oldest.
+//
+// A subscription is deleted once it has been inactive for its
+// ExpirationPolicy (31 days by default, or never if zero): it is active while
+// Receive or a StreamingPull runs on it, and when messages are pulled or
+// acked. Like ack deadlines, retention and expiration follow the Broker's
+// clock.
+//
+// Time is read from the clock given by the WithClock option, so tests can
+// expire ack deadlines without waiting:
+//
+//    broker := psfake.NewBroker(psfake.WithClock(clock.Now))
+//    ...
+//    clock.Advance(time.Minute) // unacked messages are redelivered
+//
+// A subscription with a Filter only receives the messages whose attributes
+// match it; the filter is checked when the subscription is created, and
+// supports the syntax of the service, such as
+//
+//    attributes.type = "order" AND NOT hasPrefix(attributes.region, "eu-")
+//
+// With the WithManualDelivery option, Receive does not pull messages on its
+// own; instead, a test delivers the waiting messages of a subscription with
+// Client.Deliver, which returns when the callbacks have returned, so no
+// sleeping is needed:
+//
+//    broker := psfake.NewBroker(psfake.WithManualDelivery())
+//    ...
+//    go consumer.Run(ctx) // calls sub.Receive
+//    n, err := client.Deliver(ctx, "my-sub")
+//
+// Client.Pull returns waiting messages without Receive, and Published,
+// Outstanding, Acked and Nacked list the messages of a subscription.
+//
+// Topics and subscriptions can be listed, inspected and updated as with the
+// service. Deleting a topic leaves its subscriptions, whose topic becomes
+// "_deleted-topic_". The IAM handles of topics store policies, checking their
+// etags, and grant every permission tested.
+//
+// Broker.SchemaClient returns a registry of Avro and Protocol Buffer schemas,
+// with revisions. A topic created with SchemaSettings naming a schema rejects
+// published messages that conform to none of the allowed revisions: their
+// PublishResults fail with InvalidArgument. Accepted messages carry the
+// googclient_schema* attributes the service adds. Protocol Buffer definitions
+// must be self-contained, without imports, and options are ignored.
+//
+// Errors are gRPC status errors with the codes the service uses, such as
+// NotFound for a missing topic and AlreadyExists for a duplicate one.
+//
+// Broker.RegisterServer serves the Pub/Sub gRPC API from a Broker, so that a
+// *pubsub.Client can share it with psiface code; the psemulator package runs
+// such a server on a local port for PUBSUB_EMULATOR_HOST.
+//
+// Note: This package is in alpha. Some backwards-incompatible changes may occur.
+package psfake
@@ -0,0 +1,358 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package psfake
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxFilterLength is the maximum length of a subscription filter in bytes.
+const maxFilterLength = 256
+
+// A filterExpr is a parsed subscription filter.
+type filterExpr interface {
+	matches(attrs map[string]string) bool
+}
+
+type (
+	// hasAttribute is attributes:key.
+	hasAttribute struct{ key string }
+
+	// attributeEquals is attributes.key = "value", or != if negated. Both
+	// require the attribute to be present.
+	attributeEquals struct {
+		key, value string
+		negated    bool
+	}
+
+	// attributeHasPrefix is hasPrefix(attributes.key, "prefix").
+	attributeHasPrefix struct{ key, prefix string }
+
+	notExpr struct{ x filterExpr }
+	andExpr []filterExpr
+	orExpr  []filterExpr
+)
+
+func (e hasAttribute) matches(attrs map[string]string) bool {
+	_, ok := attrs[e.key]
+	return ok
+}
+
+func (e attributeEquals) matches(attrs map[string]string) bool {
+	v, ok := attrs[e.key]
+	return ok && (v == e.value) != e.negated
+}
+
+func (e attributeHasPrefix) matches(attrs map[string]string) bool {
+	v, ok := attrs[e.key]
+	return ok && strings.HasPrefix(v, e.prefix)
+}
+
+func (e notExpr) matches(attrs map[string]string) bool {
+	return !e.x.matches(attrs)
+}
+
+func (e andExpr) matches(attrs map[string]string) bool {
+	for _, x := range e {
+		if !x.matches(attrs) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e orExpr) matches(attrs map[string]string) bool {
+	for _, x := range e {
+		if x.matches(attrs) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseFilter parses a subscription filter. It supports the syntax of the
+// service:
+//
+//    attributes:key                       the attribute is present
+//    attributes.key = "value"             the attribute has the value
+//    attributes.key != "value"            the attribute has another value
+//    hasPrefix(attributes.key, "prefix")  the attribute has the prefix
+//    NOT expr, -expr
+//    expr AND expr, expr OR expr
+//    (expr)
+//
+// Keys are identifiers or quoted strings. AND and OR cannot be combined
+// without parentheses.
+func parseFilter(s string) (filterExpr, error) {
+	if len(s) > maxFilterLength {
+		return nil, fmt.Errorf("filter is longer than %d bytes", maxFilterLength)
+	}
+	toks, err := tokenizeFilter(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{toks: toks}
+	e, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, fmt.Errorf("unexpected %s at offset %d", t, t.pos)
+	}
+	return e, nil
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokPunct // one of ( ) , . : - = !=
+)
+
+type token struct {
+	kind tokenKind
+	text string // for strings, the unquoted value
+	pos  int
+}
+
+func (t token) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of filter"
+	case tokString:
+		return strconv.Quote(t.text)
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func tokenizeFilter(s string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '!' && strings.HasPrefix(s[i:], "!="):
+			toks = append(toks, token{tokPunct, "!=", i})
+			i += 2
+		case strings.IndexByte("(),.:-=", c) >= 0:
+			toks = append(toks, token{tokPunct, string(c), i})
+			i++
+		case c == '"' || c == '\'':
+			v, n, err := unquoteFilterString(s[i:])
+			if err != nil {
+				return nil, fmt.Errorf("%v at offset %d", err, i)
+			}
+			toks = append(toks, token{tokString, v, i})
+			i += n
+		case isIdentByte(c):
+			j := i
+			for j < len(s) && isIdentByte(s[j]) {
+				j++
+			}
+			toks = append(toks, token{tokIdent, s[i:j], i})
+			i = j
+		default:
+			r, _ := utf8.DecodeRuneInString(s[i:])
+			return nil, fmt.Errorf("unexpected character %q at offset %d", r, i)
+		}
+	}
+	return append(toks, token{kind: tokEOF, pos: len(s)}), nil
+}
+
+// unquoteFilterString returns the value of the string literal at the start of
+// s, which is quoted with double or single quotes and may contain backslash
+// escapes, and its length.
+func unquoteFilterString(s string) (string, int, error) {
+	q := s[0]
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == q:
+			return b.String(), i + 1, nil
+		case c == '\\' && i+1 < len(s):
+			i++
+			b.WriteByte(s[i])
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+type filterParser struct {
+	toks []token
+	i    int
+}
+
+func (p *filterParser) peek() token {
+	return p.toks[p.i]
+}
+
+func (p *filterParser) next() token {
+	t := p.toks[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *filterParser) isIdent(text string) bool {
+	t := p.peek()
+	return t.kind == tokIdent && t.text == text
+}
+
+func (p *filterParser) isPunct(text string) bool {
+	t := p.peek()
+	return t.kind == tokPunct && t.text == text
+}
+
+func (p *filterParser) expect(kind tokenKind, text string) (token, error) {
+	t := p.next()
+	if t.kind != kind || text != "" && t.text != text {
+		want := text
+		if want == "" {
+			want = "a string"
+		}
+		return t, fmt.Errorf("expected %q, got %s at offset %d", want, t, t.pos)
+	}
+	return t, nil
+}
+
+// expr parses a sequence of terms joined by AND or by OR.
+func (p *filterParser) expr() (filterExpr, error) {
+	x, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	var op string
+	xs := []filterExpr{x}
+	for p.isIdent("AND") || p.isIdent("OR") {
+		t := p.next()
+		if op != "" && t.text != op {
+			return nil, fmt.Errorf("%s and %s must be separated by parentheses at offset %d", op, t.text, t.pos)
+		}
+		op = t.text
+		y, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		xs = append(xs, y)
+	}
+	switch op {
+	case "AND":
+		return andExpr(xs), nil
+	case "OR":
+		return orExpr(xs), nil
+	}
+	return x, nil
+}
+
+func (p *filterParser) term() (filterExpr, error) {
+	switch {
+	case p.isIdent("NOT") || p.isPunct("-"):
+		p.next()
+		x, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{x}, nil
+	case p.isPunct("("):
+		p.next()
+		x, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokPunct, ")"); err != nil {
+			return nil, err
+		}
+		return x, nil
+	case p.isIdent("hasPrefix"):
+		p.next()
+		if _, err := p.expect(tokPunct, "("); err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokIdent, "attributes"); err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokPunct, "."); err != nil {
+			return nil, err
+		}
+		key, err := p.key()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokPunct, ","); err != nil {
+			return nil, err
+		}
+		prefix, err := p.expect(tokString, "")
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokPunct, ")"); err != nil {
+			return nil, err
+		}
+		return attributeHasPrefix{key, prefix.text}, nil
+	}
+	if _, err := p.expect(tokIdent, "attributes"); err != nil {
+		return nil, err
+	}
+	if p.isPunct(":") {
+		p.next()
+		key, err := p.key()
+		if err != nil {
+			return nil, err
+		}
+		return hasAttribute{key}, nil
+	}
+	if _, err := p.expect(tokPunct, "."); err != nil {
+		return nil, err
+	}
+	key, err := p.key()
+	if err != nil {
+		return nil, err
+	}
+	var negated bool
+	switch t := p.next(); {
+	case t.kind == tokPunct && t.text == "=":
+	case t.kind == tokPunct && t.text == "!=":
+		negated = true
+	default:
+		return nil, fmt.Errorf("expected \"=\" or \"!=\", got %s at offset %d", t, t.pos)
+	}
+	value, err := p.expect(tokString, "")
+	if err != nil {
+		return nil, err
+	}
+	return attributeEquals{key, value.text, negated}, nil
+}
+
+// key parses an attribute key, an identifier or a string.
+func (p *filterParser) key() (string, error) {
+	t := p.next()
+	if t.kind != tokIdent && t.kind != tokString {
+		return "", fmt.Errorf("expected an attribute key, got %s at offset %d", t, t.pos)
+	}
+	return t.text, nil
+}
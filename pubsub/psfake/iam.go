@@ -0,0 +1,83 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package psfake
+
+import (
+	"context"
+	"strconv"
+
+	"cloud.google.com/go/iam/apiv1/iampb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// iamClient implements iampb.IAMPolicyClient for the topics of a Broker. It
+// stores policies without interpreting them, and grants every permission.
+type iamClient struct {
+	iampb.IAMPolicyClient
+	b *Broker
+}
+
+func (c *iamClient) GetIamPolicy(ctx context.Context, req *iampb.GetIamPolicyRequest, _ ...grpc.CallOption) (*iampb.Policy, error) {
+	b := c.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, err := b.topicLocked(req.Resource); err != nil {
+		return nil, err
+	}
+	if p := b.policies[req.Resource]; p != nil {
+		return proto.Clone(p).(*iampb.Policy), nil
+	}
+	return &iampb.Policy{Etag: []byte("0")}, nil
+}
+
+// SetIamPolicy replaces the policy of the resource. If the policy has an
+// etag, it must be that of the current policy.
+func (c *iamClient) SetIamPolicy(ctx context.Context, req *iampb.SetIamPolicyRequest, _ ...grpc.CallOption) (*iampb.Policy, error) {
+	b := c.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, err := b.topicLocked(req.Resource); err != nil {
+		return nil, err
+	}
+	etag := []byte("0")
+	if p := b.policies[req.Resource]; p != nil {
+		etag = p.Etag
+	}
+	if len(req.Policy.GetEtag()) > 0 && string(req.Policy.Etag) != string(etag) {
+		return nil, status.Errorf(codes.Aborted, "There were concurrent policy changes. Please retry the whole read-modify-write with exponential backoff.")
+	}
+	b.lastPolicy++
+	p := proto.Clone(req.Policy).(*iampb.Policy)
+	if p == nil {
+		p = &iampb.Policy{}
+	}
+	p.Etag = []byte(strconv.FormatInt(b.lastPolicy, 10))
+	b.policies[req.Resource] = p
+	return proto.Clone(p).(*iampb.Policy), nil
+}
+
+// TestIamPermissions returns all the permissions.
+func (c *iamClient) TestIamPermissions(ctx context.Context, req *iampb.TestIamPermissionsRequest, _ ...grpc.CallOption) (*iampb.TestIamPermissionsResponse, error) {
+	b := c.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, err := b.topicLocked(req.Resource); err != nil {
+		return nil, err
+	}
+	return &iampb.TestIamPermissionsResponse{Permissions: req.Permissions}, nil
+}
@@ -0,0 +1,131 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package psfake
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// A MessageRecord describes a message of a subscription, for inspection by
+// tests.
+type MessageRecord struct {
+	ID          string
+	Data        []byte
+	Attributes  map[string]string
+	OrderingKey string
+	PublishTime time.Time
+
+	// DeliveryAttempt is the number of times the message had been
+	// delivered when it was acked or nacked, or has been delivered if it is
+	// outstanding, or zero in the records returned by Published.
+	DeliveryAttempt int
+}
+
+// event is an ack or nack of a message.
+type event struct {
+	msg      *message
+	attempts int
+}
+
+func newMessageRecord(m *message, attempts int) MessageRecord {
+	r := MessageRecord{
+		ID:              m.id,
+		Data:            append([]byte(nil), m.data...),
+		OrderingKey:     m.orderingKey,
+		PublishTime:     m.publishTime,
+		DeliveryAttempt: attempts,
+	}
+	if m.attributes != nil {
+		r.Attributes = make(map[string]string, len(m.attributes))
+		for k, v := range m.attributes {
+			r.Attributes[k] = v
+		}
+	}
+	return r
+}
+
+// records returns the records of the subscription with the given ID selected
+// by f, or nil if the subscription does not exist.
+func (c *Client) records(subID string, f func(*subscriptionState) []MessageRecord) []MessageRecord {
+	b := c.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.reapLocked()
+	s := b.subs[fmt.Sprintf("projects/%s/subscriptions/%s", c.project, subID)]
+	if s == nil {
+		return nil
+	}
+	return f(s)
+}
+
+// Published returns the messages published to the subscription with the
+// given ID, that is, those published to its topic after it was created that
+// match its filter, in publish order.
+func (c *Client) Published(subID string) []MessageRecord {
+	return c.records(subID, func(s *subscriptionState) []MessageRecord {
+		var rs []MessageRecord
+		for _, m := range s.published {
+			rs = append(rs, newMessageRecord(m, 0))
+		}
+		return rs
+	})
+}
+
+// Outstanding returns the messages of the subscription with the given ID that
+// have been delivered and are not yet acked, nacked or expired, in publish
+// order.
+func (c *Client) Outstanding(subID string) []MessageRecord {
+	return c.records(subID, func(s *subscriptionState) []MessageRecord {
+		c.b.expireLocked(s)
+		var ds []*delivery
+		for _, d := range s.outstanding {
+			ds = append(ds, d)
+		}
+		sort.Slice(ds, func(i, j int) bool { return ds[i].msg.seq < ds[j].msg.seq })
+		var rs []MessageRecord
+		for _, d := range ds {
+			rs = append(rs, newMessageRecord(d.msg, d.attempts))
+		}
+		return rs
+	})
+}
+
+// Acked returns the messages acked in the subscription with the given ID, in
+// the order they were acked. Acks of messages that were no longer
+// outstanding, which have no effect, are not included.
+func (c *Client) Acked(subID string) []MessageRecord {
+	return c.records(subID, func(s *subscriptionState) []MessageRecord {
+		return eventRecords(s.ackLog)
+	})
+}
+
+// Nacked returns the messages nacked in the subscription with the given ID,
+// in the order they were nacked. A message that was nacked several times is
+// included each time. Failed pushes count as nacks.
+func (c *Client) Nacked(subID string) []MessageRecord {
+	return c.records(subID, func(s *subscriptionState) []MessageRecord {
+		return eventRecords(s.nackLog)
+	})
+}
+
+func eventRecords(events []event) []MessageRecord {
+	var rs []MessageRecord
+	for _, e := range events {
+		rs = append(rs, newMessageRecord(e.msg, e.attempts))
+	}
+	return rs
+}
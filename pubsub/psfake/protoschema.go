@@ -0,0 +1,622 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package psfake
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// parseProtoSchema parses the definition of a Protocol Buffer schema, the
+// text of a .proto file without imports, and returns its one top-level
+// message type. Options are ignored.
+func parseProtoSchema(def string) (protoreflect.MessageDescriptor, error) {
+	toks, err := tokenizeProto(def)
+	if err != nil {
+		return nil, err
+	}
+	p := &protoParser{toks: toks, kinds: make(map[string]descriptorpb.FieldDescriptorProto_Type)}
+	fdp, err := p.file()
+	if err != nil {
+		return nil, err
+	}
+	if len(fdp.MessageType) != 1 {
+		return nil, fmt.Errorf("the definition must contain exactly one top-level message type, got %d", len(fdp.MessageType))
+	}
+	for _, ref := range p.refs {
+		if err := p.resolve(ref); err != nil {
+			return nil, err
+		}
+	}
+	fd, err := protodesc.NewFile(fdp, new(protoregistry.Files))
+	if err != nil {
+		return nil, err
+	}
+	return fd.Messages().Get(0), nil
+}
+
+// tokenizeProto splits a .proto file into identifiers, numbers, strings and
+// punctuation, dropping comments.
+func tokenizeProto(s string) ([]string, error) {
+	var toks []string
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case strings.HasPrefix(s[i:], "//"):
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(s[i:], "/*"):
+			end := strings.Index(s[i+2:], "*/")
+			if end < 0 {
+				return nil, errors.New("unterminated comment")
+			}
+			i += end + 4
+		case c == '"' || c == '\'':
+			j := i + 1
+			for j < len(s) && s[j] != c {
+				if s[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(s) {
+				return nil, errors.New("unterminated string")
+			}
+			toks = append(toks, s[i:j+1])
+			i = j + 1
+		case c == '_' || c == '.' || unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c)):
+			j := i + 1
+			for j < len(s) && (s[j] == '_' || s[j] == '.' || unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j]))) {
+				j++
+			}
+			toks = append(toks, s[i:j])
+			i = j
+		default:
+			toks = append(toks, string(c))
+			i++
+		}
+	}
+	return toks, nil
+}
+
+// protoParser builds a FileDescriptorProto from the tokens of a .proto file.
+type protoParser struct {
+	toks   []string
+	pos    int
+	pkg    string
+	proto3 bool
+	kinds  map[string]descriptorpb.FieldDescriptorProto_Type // kinds of the defined types, by full name
+	refs   []typeRef                                         // fields referring to defined types
+}
+
+// typeRef is a field whose type is a message or enum, to resolve once every
+// type is defined.
+type typeRef struct {
+	field *descriptorpb.FieldDescriptorProto
+	scope string // full name of the message declaring the field
+}
+
+var protoScalars = map[string]descriptorpb.FieldDescriptorProto_Type{
+	"double":   descriptorpb.FieldDescriptorProto_TYPE_DOUBLE,
+	"float":    descriptorpb.FieldDescriptorProto_TYPE_FLOAT,
+	"int32":    descriptorpb.FieldDescriptorProto_TYPE_INT32,
+	"int64":    descriptorpb.FieldDescriptorProto_TYPE_INT64,
+	"uint32":   descriptorpb.FieldDescriptorProto_TYPE_UINT32,
+	"uint64":   descriptorpb.FieldDescriptorProto_TYPE_UINT64,
+	"sint32":   descriptorpb.FieldDescriptorProto_TYPE_SINT32,
+	"sint64":   descriptorpb.FieldDescriptorProto_TYPE_SINT64,
+	"fixed32":  descriptorpb.FieldDescriptorProto_TYPE_FIXED32,
+	"fixed64":  descriptorpb.FieldDescriptorProto_TYPE_FIXED64,
+	"sfixed32": descriptorpb.FieldDescriptorProto_TYPE_SFIXED32,
+	"sfixed64": descriptorpb.FieldDescriptorProto_TYPE_SFIXED64,
+	"bool":     descriptorpb.FieldDescriptorProto_TYPE_BOOL,
+	"string":   descriptorpb.FieldDescriptorProto_TYPE_STRING,
+	"bytes":    descriptorpb.FieldDescriptorProto_TYPE_BYTES,
+}
+
+func (p *protoParser) peek() string {
+	if p.pos < len(p.toks) {
+		return p.toks[p.pos]
+	}
+	return ""
+}
+
+func (p *protoParser) next() (string, error) {
+	if p.pos >= len(p.toks) {
+		return "", errors.New("unexpected end of definition")
+	}
+	p.pos++
+	return p.toks[p.pos-1], nil
+}
+
+func (p *protoParser) expect(want string) error {
+	tok, err := p.next()
+	if err == nil && tok != want {
+		err = fmt.Errorf("expected %q, got %q", want, tok)
+	}
+	return err
+}
+
+func (p *protoParser) ident() (string, error) {
+	tok, err := p.next()
+	if err == nil && !isProtoIdent(tok) {
+		err = fmt.Errorf("expected an identifier, got %q", tok)
+	}
+	return tok, err
+}
+
+func isProtoIdent(tok string) bool {
+	return tok != "" && (tok[0] == '_' || tok[0] == '.' || unicode.IsLetter(rune(tok[0])))
+}
+
+// skipStatement skips the tokens up to the next semicolon, for options and
+// reserved ranges.
+func (p *protoParser) skipStatement() error {
+	for {
+		tok, err := p.next()
+		if err != nil {
+			return err
+		}
+		if tok == ";" {
+			return nil
+		}
+	}
+}
+
+// skipOptions skips the bracketed options of a field or enum value, if any.
+func (p *protoParser) skipOptions() error {
+	if p.peek() != "[" {
+		return nil
+	}
+	for {
+		tok, err := p.next()
+		if err != nil {
+			return err
+		}
+		if tok == "]" {
+			return nil
+		}
+	}
+}
+
+func (p *protoParser) number() (int32, error) {
+	tok, err := p.next()
+	if err != nil {
+		return 0, err
+	}
+	neg := tok == "-"
+	if neg {
+		if tok, err = p.next(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := strconv.ParseInt(tok, 0, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", tok)
+	}
+	if neg {
+		n = -n
+	}
+	return int32(n), nil
+}
+
+func (p *protoParser) file() (*descriptorpb.FileDescriptorProto, error) {
+	fdp := &descriptorpb.FileDescriptorProto{Name: proto.String("schema.proto")}
+	if p.peek() == "syntax" {
+		p.pos++
+		if err := p.expect("="); err != nil {
+			return nil, err
+		}
+		syntax, err := p.next()
+		if err != nil {
+			return nil, err
+		}
+		switch strings.Trim(syntax, `"'`) {
+		case "proto2":
+		case "proto3":
+			p.proto3 = true
+			fdp.Syntax = proto.String("proto3")
+		default:
+			return nil, fmt.Errorf("unsupported syntax %s", syntax)
+		}
+		if err := p.expect(";"); err != nil {
+			return nil, err
+		}
+	}
+	for p.pos < len(p.toks) {
+		tok, _ := p.next()
+		switch tok {
+		case ";":
+		case "package":
+			pkg, err := p.ident()
+			if err != nil {
+				return nil, err
+			}
+			p.pkg = pkg
+			fdp.Package = proto.String(pkg)
+			if err := p.expect(";"); err != nil {
+				return nil, err
+			}
+		case "option":
+			if err := p.skipStatement(); err != nil {
+				return nil, err
+			}
+		case "message":
+			m, err := p.message(p.pkg)
+			if err != nil {
+				return nil, err
+			}
+			fdp.MessageType = append(fdp.MessageType, m)
+		case "enum":
+			e, err := p.enum(p.pkg)
+			if err != nil {
+				return nil, err
+			}
+			fdp.EnumType = append(fdp.EnumType, e)
+		case "import":
+			return nil, errors.New("imports are not supported")
+		default:
+			return nil, fmt.Errorf("unexpected %q", tok)
+		}
+	}
+	return fdp, nil
+}
+
+// define records the kind of the type with the given name in scope, and
+// returns its full name.
+func (p *protoParser) define(scope, name string, kind descriptorpb.FieldDescriptorProto_Type) (string, error) {
+	full := name
+	if scope != "" {
+		full = scope + "." + name
+	}
+	if _, ok := p.kinds[full]; ok {
+		return "", fmt.Errorf("%s is already defined", full)
+	}
+	p.kinds[full] = kind
+	return full, nil
+}
+
+func (p *protoParser) message(scope string) (*descriptorpb.DescriptorProto, error) {
+	name, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	full, err := p.define(scope, name, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE)
+	if err != nil {
+		return nil, err
+	}
+	m := &descriptorpb.DescriptorProto{Name: proto.String(name)}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var synthetic []*descriptorpb.FieldDescriptorProto // proto3 optional fields
+	for {
+		tok := p.peek()
+		switch tok {
+		case "}":
+			p.pos++
+			// Synthetic oneofs of proto3 optional fields follow the others.
+			for _, f := range synthetic {
+				f.OneofIndex = proto.Int32(int32(len(m.OneofDecl)))
+				m.OneofDecl = append(m.OneofDecl, &descriptorpb.OneofDescriptorProto{Name: proto.String("_" + f.GetName())})
+			}
+			return m, nil
+		case ";":
+			p.pos++
+		case "option", "reserved", "extensions":
+			if err := p.skipStatement(); err != nil {
+				return nil, err
+			}
+		case "message":
+			p.pos++
+			nested, err := p.message(full)
+			if err != nil {
+				return nil, err
+			}
+			m.NestedType = append(m.NestedType, nested)
+		case "enum":
+			p.pos++
+			e, err := p.enum(full)
+			if err != nil {
+				return nil, err
+			}
+			m.EnumType = append(m.EnumType, e)
+		case "oneof":
+			p.pos++
+			if err := p.oneof(m, full); err != nil {
+				return nil, err
+			}
+		case "map":
+			p.pos++
+			if err := p.mapField(m, full); err != nil {
+				return nil, err
+			}
+		case "extend", "group":
+			return nil, fmt.Errorf("%s is not supported", tok)
+		default:
+			f, err := p.field(full, true)
+			if err != nil {
+				return nil, err
+			}
+			if f.GetProto3Optional() {
+				synthetic = append(synthetic, f)
+			}
+			m.Field = append(m.Field, f)
+		}
+	}
+}
+
+// field parses a field declaration. Labels are not allowed in oneofs.
+func (p *protoParser) field(scope string, labels bool) (*descriptorpb.FieldDescriptorProto, error) {
+	f := &descriptorpb.FieldDescriptorProto{Label: descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum()}
+	tok, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	if labels {
+		switch tok {
+		case "optional":
+			if p.proto3 {
+				f.Proto3Optional = proto.Bool(true)
+			}
+		case "required":
+			if p.proto3 {
+				return nil, errors.New("required fields are not allowed in proto3")
+			}
+			f.Label = descriptorpb.FieldDescriptorProto_LABEL_REQUIRED.Enum()
+		case "repeated":
+			f.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+		default:
+			if !p.proto3 {
+				return nil, fmt.Errorf("field of type %s without a label in proto2", tok)
+			}
+			p.pos--
+		}
+		if tok, err = p.ident(); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.fieldRest(f, scope, tok); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// fieldRest parses the rest of a field declaration after its type, typ.
+func (p *protoParser) fieldRest(f *descriptorpb.FieldDescriptorProto, scope, typ string) error {
+	p.setType(f, scope, typ)
+	name, err := p.ident()
+	if err != nil {
+		return err
+	}
+	f.Name = proto.String(name)
+	if err := p.expect("="); err != nil {
+		return err
+	}
+	n, err := p.number()
+	if err != nil {
+		return err
+	}
+	f.Number = proto.Int32(n)
+	if err := p.skipOptions(); err != nil {
+		return err
+	}
+	return p.expect(";")
+}
+
+func (p *protoParser) setType(f *descriptorpb.FieldDescriptorProto, scope, typ string) {
+	if t, ok := protoScalars[typ]; ok {
+		f.Type = t.Enum()
+		return
+	}
+	f.TypeName = proto.String(typ)
+	p.refs = append(p.refs, typeRef{field: f, scope: scope})
+}
+
+// resolve sets the type of a field referring to a message or enum, searching
+// the enclosing scopes of the field from the innermost, as protoc does.
+func (p *protoParser) resolve(ref typeRef) error {
+	name := ref.field.GetTypeName()
+	candidates := []string{strings.TrimPrefix(name, ".")}
+	if !strings.HasPrefix(name, ".") {
+		candidates = nil
+		for scope := ref.scope; ; {
+			if scope == "" {
+				candidates = append(candidates, name)
+				break
+			}
+			candidates = append(candidates, scope+"."+name)
+			i := strings.LastIndex(scope, ".")
+			if i < 0 {
+				scope = ""
+			} else {
+				scope = scope[:i]
+			}
+		}
+	}
+	for _, c := range candidates {
+		if kind, ok := p.kinds[c]; ok {
+			ref.field.Type = kind.Enum()
+			ref.field.TypeName = proto.String("." + c)
+			return nil
+		}
+	}
+	return fmt.Errorf("field %s: unknown type %s", ref.field.GetName(), name)
+}
+
+func (p *protoParser) oneof(m *descriptorpb.DescriptorProto, scope string) error {
+	name, err := p.ident()
+	if err != nil {
+		return err
+	}
+	index := int32(len(m.OneofDecl))
+	m.OneofDecl = append(m.OneofDecl, &descriptorpb.OneofDescriptorProto{Name: proto.String(name)})
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+	for {
+		switch p.peek() {
+		case "}":
+			p.pos++
+			return nil
+		case ";":
+			p.pos++
+		case "option":
+			if err := p.skipStatement(); err != nil {
+				return err
+			}
+		default:
+			f, err := p.field(scope, false)
+			if err != nil {
+				return err
+			}
+			f.OneofIndex = proto.Int32(index)
+			m.Field = append(m.Field, f)
+		}
+	}
+}
+
+// mapField parses a map field, adding the nested entry message that
+// represents it in descriptors.
+func (p *protoParser) mapField(m *descriptorpb.DescriptorProto, scope string) error {
+	if err := p.expect("<"); err != nil {
+		return err
+	}
+	keyType, err := p.ident()
+	if err != nil {
+		return err
+	}
+	if err := p.expect(","); err != nil {
+		return err
+	}
+	valueType, err := p.ident()
+	if err != nil {
+		return err
+	}
+	if err := p.expect(">"); err != nil {
+		return err
+	}
+	f := &descriptorpb.FieldDescriptorProto{Label: descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()}
+	if err := p.fieldRest(f, scope, "map"); err != nil {
+		return err
+	}
+	// fieldRest recorded "map" as a reference; resolve the entry instead.
+	p.refs = p.refs[:len(p.refs)-1]
+	entryName := mapEntryName(f.GetName())
+	entryFull, err := p.define(scope, entryName, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE)
+	if err != nil {
+		return err
+	}
+	f.Type = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+	f.TypeName = proto.String("." + entryFull)
+	key := &descriptorpb.FieldDescriptorProto{
+		Name:     proto.String("key"),
+		JsonName: proto.String("key"),
+		Number:   proto.Int32(1),
+		Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+	}
+	value := &descriptorpb.FieldDescriptorProto{
+		Name:     proto.String("value"),
+		JsonName: proto.String("value"),
+		Number:   proto.Int32(2),
+		Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+	}
+	p.setType(key, entryFull, keyType)
+	p.setType(value, entryFull, valueType)
+	m.NestedType = append(m.NestedType, &descriptorpb.DescriptorProto{
+		Name:    proto.String(entryName),
+		Field:   []*descriptorpb.FieldDescriptorProto{key, value},
+		Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+	})
+	m.Field = append(m.Field, f)
+	return nil
+}
+
+// mapEntryName returns the name of the entry message of a map field, such as
+// MyMapEntry for my_map.
+func mapEntryName(field string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range field {
+		if r == '_' {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String() + "Entry"
+}
+
+func (p *protoParser) enum(scope string) (*descriptorpb.EnumDescriptorProto, error) {
+	name, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.define(scope, name, descriptorpb.FieldDescriptorProto_TYPE_ENUM); err != nil {
+		return nil, err
+	}
+	e := &descriptorpb.EnumDescriptorProto{Name: proto.String(name)}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	for {
+		switch p.peek() {
+		case "}":
+			p.pos++
+			return e, nil
+		case ";":
+			p.pos++
+		case "option", "reserved":
+			if err := p.skipStatement(); err != nil {
+				return nil, err
+			}
+		default:
+			vname, err := p.ident()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("="); err != nil {
+				return nil, err
+			}
+			n, err := p.number()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.skipOptions(); err != nil {
+				return nil, err
+			}
+			if err := p.expect(";"); err != nil {
+				return nil, err
+			}
+			e.Value = append(e.Value, &descriptorpb.EnumValueDescriptorProto{Name: proto.String(vname), Number: proto.Int32(n)})
+		}
+	}
+}
@@ -0,0 +1,2185 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package psfake
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/iam"
+	"cloud.google.com/go/pubsub"
+	"github.com/googleapis/google-cloud-go-testing/pubsub/psiface"
+	"google.golang.org/api/iterator"
+	"google.golang.org/api/support/bundler"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ psiface.Client = (*Client)(nil)
+
+// fakeClock is a manually advanced clock for tests, safe for concurrent use.
+type fakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{t: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
+
+func newMessage(data string, attrs map[string]string) psiface.Message {
+	return psiface.NewMessage([]byte(data), attrs, "")
+}
+
+// receiveN receives n messages from sub, one at a time, acking each of them,
+// and returns them in the order received.
+func receiveN(t *testing.T, sub psiface.Subscription, n int) []psiface.Message {
+	t.Helper()
+	settings := sub.ReceiveSettings()
+	sub.SetReceiveSettings(pubsub.ReceiveSettings{NumGoroutines: 1})
+	defer sub.SetReceiveSettings(settings)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var (
+		mu   sync.Mutex
+		msgs []psiface.Message
+	)
+	err := sub.Receive(ctx, func(_ context.Context, m psiface.Message) {
+		m.Ack()
+		mu.Lock()
+		defer mu.Unlock()
+		msgs = append(msgs, m)
+		if len(msgs) == n {
+			cancel()
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != n {
+		t.Fatalf("received %d messages, want %d", len(msgs), n)
+	}
+	return msgs
+}
+
+// receiveData receives n messages from sub, acking them, and returns their
+// data.
+func receiveData(t *testing.T, sub psiface.Subscription, n int) []string {
+	t.Helper()
+	var data []string
+	for _, m := range receiveN(t, sub, n) {
+		data = append(data, string(m.Data()))
+	}
+	return data
+}
+
+// expectNone checks that sub has no messages to deliver.
+func expectNone(t *testing.T, sub psiface.Subscription) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*pollInterval)
+	defer cancel()
+	err := sub.Receive(ctx, func(_ context.Context, m psiface.Message) {
+		t.Errorf("%v: unexpected message %q", sub, m.Data())
+		m.Ack()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPublishReceive(t *testing.T) {
+	ctx := context.Background()
+	client := NewBroker().Client("p")
+	topic, err := client.CreateTopic(ctx, "topic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := topic.String(), "projects/p/topics/topic"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if _, err := topic.Publish(ctx, newMessage("early", nil)).Get(ctx); err != nil {
+		t.Fatal(err)
+	}
+	sub1, err := client.CreateSubscription(ctx, "sub1", psiface.SubscriptionConfig{Topic: topic})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub2, err := client.CreateSubscription(ctx, "sub2", psiface.SubscriptionConfig{Topic: client.Topic("topic")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	var ids []string
+	for i := 0; i < 3; i++ {
+		id, err := topic.Publish(ctx, newMessage(fmt.Sprint(i), map[string]string{"n": fmt.Sprint(i)})).Get(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	for _, sub := range []psiface.Subscription{sub1, sub2} {
+		msgs := receiveN(t, sub, 3)
+		for i, m := range msgs {
+			if got, want := string(m.Data()), fmt.Sprint(i); got != want {
+				t.Errorf("%v: message %d: data %q, want %q", sub, i, got, want)
+			}
+			if got, want := m.Attributes()["n"], fmt.Sprint(i); got != want {
+				t.Errorf("%v: message %d: attribute %q, want %q", sub, i, got, want)
+			}
+			if m.ID() != ids[i] {
+				t.Errorf("%v: message %d: ID %q, want %q", sub, i, m.ID(), ids[i])
+			}
+			if m.PublishTime().Before(start) {
+				t.Errorf("%v: message %d: publish time %v is before %v", sub, i, m.PublishTime(), start)
+			}
+		}
+	}
+	// Acked messages are not redelivered.
+	ctx2, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	err = sub1.Receive(ctx2, func(_ context.Context, m psiface.Message) {
+		t.Errorf("unexpected message %q", m.Data())
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPublishBatching(t *testing.T) {
+	ctx := context.Background()
+	clock := newFakeClock()
+	client := NewBroker(WithClock(clock.Now)).Client("p")
+	topic, err := client.CreateTopic(ctx, "topic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.CreateSubscription(ctx, "sub", psiface.SubscriptionConfig{Topic: topic}); err != nil {
+		t.Fatal(err)
+	}
+	ready := func(r psiface.PublishResult) bool {
+		t.Helper()
+		ctx, cancel := context.WithTimeout(ctx, 5*pollInterval)
+		defer cancel()
+		_, err := r.Get(ctx)
+		if err != nil && err != context.DeadlineExceeded {
+			t.Fatal(err)
+		}
+		return err == nil
+	}
+	publish := func(topic psiface.Topic, n int) []psiface.PublishResult {
+		var rs []psiface.PublishResult
+		for i := 0; i < n; i++ {
+			rs = append(rs, topic.Publish(ctx, newMessage(fmt.Sprint(i), nil)))
+		}
+		return rs
+	}
+
+	// New handles publish messages at once, as their settings say, and
+	// setting the same settings again does not change that.
+	if got := topic.PublishSettings().CountThreshold; got != 1 {
+		t.Errorf("CountThreshold of a new handle: got %d, want 1", got)
+	}
+	topic.SetPublishSettings(topic.PublishSettings())
+	for i, r := range publish(topic, 2) {
+		if !ready(r) {
+			t.Errorf("result %d not ready with the default settings", i)
+		}
+	}
+	topic.SetPublishSettings(pubsub.PublishSettings{DelayThreshold: time.Second, CountThreshold: 3})
+	rs := publish(topic, 2)
+	if ready(rs[0]) {
+		t.Error("result ready before the batch was full")
+	}
+	rs = append(rs, publish(topic, 1)...)
+	for i, r := range rs {
+		if !ready(r) {
+			t.Errorf("result %d not ready after CountThreshold messages", i)
+		}
+	}
+	rs = publish(topic, 1)
+	clock.Advance(time.Second - time.Millisecond)
+	if ready(rs[0]) {
+		t.Error("result ready before DelayThreshold")
+	}
+	clock.Advance(time.Millisecond)
+	if !ready(rs[0]) {
+		t.Error("result not ready after DelayThreshold")
+	}
+	rs = publish(topic, 1)
+	topic.Flush()
+	if !ready(rs[0]) {
+		t.Error("result not ready after Flush")
+	}
+	// Flushing the batch cancels its timer.
+	client.b.mu.Lock()
+	if n := len(client.b.timers); n != 0 {
+		t.Errorf("%d timers pending after Flush", n)
+	}
+	client.b.mu.Unlock()
+
+	big := topic.Publish(ctx, psiface.NewMessage(make([]byte, pubsub.MaxPublishRequestBytes), nil, ""))
+	if _, err := big.Get(ctx); err != pubsub.ErrOversizedMessage {
+		t.Errorf("oversized message: got %v, want %v", err, pubsub.ErrOversizedMessage)
+	}
+
+	topic.SetPublishSettings(pubsub.PublishSettings{DelayThreshold: time.Hour, BufferedByteLimit: 150})
+	data := make([]byte, 100)
+	first := topic.Publish(ctx, psiface.NewMessage(data, nil, ""))
+	if _, err := topic.Publish(ctx, psiface.NewMessage(data, nil, "")).Get(ctx); err != bundler.ErrOverflow {
+		t.Errorf("buffer overflow: got %v, want %v", err, bundler.ErrOverflow)
+	}
+	topic.Flush()
+	if _, err := first.Get(ctx); err != nil {
+		t.Errorf("first message: %v", err)
+	}
+
+	topic.SetPublishSettings(pubsub.PublishSettings{
+		DelayThreshold: time.Hour,
+		FlowControlSettings: pubsub.FlowControlSettings{
+			MaxOutstandingMessages: 1,
+			LimitExceededBehavior:  pubsub.FlowControlSignalError,
+		},
+	})
+	rs = publish(topic, 2)
+	if _, err := rs[1].Get(ctx); err != pubsub.ErrFlowControllerMaxOutstandingMessages {
+		t.Errorf("flow control: got %v, want %v", err, pubsub.ErrFlowControllerMaxOutstandingMessages)
+	}
+	topic.Flush()
+	settings := topic.PublishSettings()
+	settings.FlowControlSettings.LimitExceededBehavior = pubsub.FlowControlBlock
+	topic.SetPublishSettings(settings)
+	rs = publish(topic, 1)
+	published := make(chan psiface.PublishResult)
+	go func() { published <- topic.Publish(ctx, newMessage("blocked", nil)) }()
+	select {
+	case <-published:
+		t.Error("Publish did not block at MaxOutstandingMessages")
+	case <-time.After(5 * pollInterval):
+	}
+	topic.Flush()
+	r := <-published
+	topic.Flush()
+	if !ready(rs[0]) || !ready(r) {
+		t.Error("results not ready after Flush")
+	}
+
+	// A batch fails as a whole.
+	missing := client.Topic("missing")
+	rs = publish(missing, 2)
+	missing.Stop()
+	for i, r := range rs {
+		if _, err := r.Get(ctx); status.Code(err) != codes.NotFound {
+			t.Errorf("message %d to missing topic: got %v, want NotFound", i, err)
+		}
+	}
+}
+
+func TestNack(t *testing.T) {
+	ctx := context.Background()
+	client := NewBroker().Client("p")
+	topic, err := client.CreateTopic(ctx, "topic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := client.CreateSubscription(ctx, "sub", psiface.SubscriptionConfig{Topic: topic})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := topic.Publish(ctx, newMessage("m", nil)).Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx2, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	n := 0
+	err = sub.Receive(ctx2, func(_ context.Context, m psiface.Message) {
+		n++
+		if m.ID() != id {
+			t.Errorf("ID = %q, want %q", m.ID(), id)
+		}
+		if n < 3 {
+			m.Nack()
+			return
+		}
+		m.Ack()
+		m.Nack() // no effect
+		cancel()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("received %d times, want 3", n)
+	}
+}
+
+func deliveryAttempt(m psiface.Message) int {
+	return *m.DeliveryAttempt()
+}
+
+func TestAckDeadline(t *testing.T) {
+	ctx := context.Background()
+	clock := newFakeClock()
+	client := NewBroker(WithClock(clock.Now)).Client("p")
+	topic, err := client.CreateTopic(ctx, "topic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.CreateSubscription(ctx, "sub", psiface.SubscriptionConfig{Topic: topic, SubscriptionConfig: pubsub.SubscriptionConfig{AckDeadline: 5 * time.Second}})
+	if got, want := status.Code(err), codes.InvalidArgument; got != want {
+		t.Errorf("short ack deadline: got %v, want %v", got, want)
+	}
+	sub, err := client.CreateSubscription(ctx, "sub", psiface.SubscriptionConfig{Topic: topic, SubscriptionConfig: pubsub.SubscriptionConfig{AckDeadline: 30 * time.Second}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, data := range []string{"a", "b"} {
+		if _, err := topic.Publish(ctx, newMessage(data, nil)).Get(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	type delivery struct {
+		data    string
+		attempt int
+	}
+	deliveries := make(chan delivery, 10)
+	msgs := make(chan psiface.Message, 10)
+	sub.SetReceiveSettings(pubsub.ReceiveSettings{NumGoroutines: 1})
+	rctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- sub.Receive(rctx, func(_ context.Context, m psiface.Message) {
+			if string(m.Data()) == "a" && deliveryAttempt(m) == 1 {
+				// The deadline is extended while the callback runs.
+				clock.Advance(time.Hour)
+			}
+			deliveries <- delivery{string(m.Data()), deliveryAttempt(m)}
+			msgs <- m
+		})
+	}()
+	next := func() delivery {
+		t.Helper()
+		select {
+		case d := <-deliveries:
+			return d
+		case <-time.After(10 * time.Second):
+			t.Fatal("timed out waiting for a delivery")
+			return delivery{}
+		}
+	}
+	if got, want := next(), (delivery{"a", 1}); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := next(), (delivery{"b", 1}); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// Neither message is acked; both are redelivered, in order, after the
+	// deadline.
+	clock.Advance(29 * time.Second)
+	select {
+	case d := <-deliveries:
+		t.Fatalf("redelivered %v before the deadline", d)
+	case <-time.After(5 * pollInterval):
+	}
+	clock.Advance(time.Second)
+	if got, want := next(), (delivery{"a", 2}); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, want := next(), (delivery{"b", 2}); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	// Acks of the first, expired deliveries have no effect.
+	(<-msgs).Ack()
+	(<-msgs).Ack()
+	// Ack a and nack b, which is redelivered immediately.
+	(<-msgs).Ack()
+	(<-msgs).Nack()
+	if got, want := next(), (delivery{"b", 3}); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	(<-msgs).Ack()
+	clock.Advance(time.Hour)
+	select {
+	case d := <-deliveries:
+		t.Fatalf("unexpected redelivery of %v", d)
+	case <-time.After(5 * pollInterval):
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReceiveSettings(t *testing.T) {
+	ctx := context.Background()
+	clock := newFakeClock()
+	client := NewBroker(WithClock(clock.Now)).Client("p")
+	topic, err := client.CreateTopic(ctx, "topic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newSub := func(id string, settings pubsub.ReceiveSettings, n int) psiface.Subscription {
+		t.Helper()
+		sub, err := client.CreateSubscription(ctx, id, psiface.SubscriptionConfig{Topic: topic})
+		if err != nil {
+			t.Fatal(err)
+		}
+		sub.SetReceiveSettings(settings)
+		for i := 0; i < n; i++ {
+			if _, err := topic.Publish(ctx, newMessage("0123456789", nil)).Get(ctx); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return sub
+	}
+	// receive runs Receive in the background, sending the messages to the
+	// returned channel without acking them.
+	receive := func(sub psiface.Subscription, block <-chan struct{}) (<-chan psiface.Message, func()) {
+		msgs := make(chan psiface.Message, 100)
+		rctx, cancel := context.WithCancel(ctx)
+		done := make(chan error, 1)
+		go func() {
+			done <- sub.Receive(rctx, func(_ context.Context, m psiface.Message) {
+				msgs <- m
+				<-block
+			})
+		}()
+		return msgs, func() {
+			cancel()
+			if err := <-done; err != nil {
+				t.Error(err)
+			}
+		}
+	}
+	// count returns the number of messages received while the Receive has
+	// time to receive more.
+	count := func(msgs <-chan psiface.Message) []psiface.Message {
+		var got []psiface.Message
+		timeout := time.After(10 * pollInterval)
+		for {
+			select {
+			case m := <-msgs:
+				got = append(got, m)
+			case <-timeout:
+				return got
+			}
+		}
+	}
+	unblocked := make(chan struct{})
+	close(unblocked)
+
+	// Callbacks run concurrently, up to NumGoroutines.
+	sub := newSub("goroutines", pubsub.ReceiveSettings{NumGoroutines: 3}, 5)
+	block := make(chan struct{})
+	msgs, stop := receive(sub, block)
+	if got := count(msgs); len(got) != 3 {
+		t.Errorf("NumGoroutines 3: %d concurrent callbacks, want 3", len(got))
+	}
+	close(block)
+	if got := count(msgs); len(got) != 2 {
+		t.Errorf("NumGoroutines 3: %d more callbacks, want 2", len(got))
+	}
+	stop()
+	if err := sub.Delete(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Messages count against the limits until they are acked.
+	sub = newSub("messages", pubsub.ReceiveSettings{MaxOutstandingMessages: 2}, 4)
+	msgs, stop = receive(sub, unblocked)
+	got := count(msgs)
+	if len(got) != 2 {
+		t.Errorf("MaxOutstandingMessages 2: received %d messages, want 2", len(got))
+	}
+	got[0].Ack()
+	got[1].Nack()
+	if got := count(msgs); len(got) != 2 {
+		t.Errorf("MaxOutstandingMessages 2: received %d more messages after ack and nack, want 2", len(got))
+	}
+	stop()
+	if err := sub.Delete(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	sub = newSub("bytes", pubsub.ReceiveSettings{MaxOutstandingBytes: 20}, 3)
+	msgs, stop = receive(sub, unblocked)
+	if got := count(msgs); len(got) != 2 {
+		t.Errorf("MaxOutstandingBytes 20: received %d messages of 10 bytes, want 2", len(got))
+	}
+	// Expired messages no longer count.
+	clock.Advance(defaultAckDeadline)
+	if got := count(msgs); len(got) != 2 {
+		t.Errorf("MaxOutstandingBytes 20: received %d messages after expiry, want 2", len(got))
+	}
+	stop()
+	if err := sub.Delete(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// The deadline is extended for up to MaxExtension while the callback
+	// runs.
+	sub = newSub("extension", pubsub.ReceiveSettings{MaxExtension: time.Minute}, 1)
+	block = make(chan struct{})
+	msgs, stop = receive(sub, block)
+	if got := count(msgs); len(got) != 1 {
+		t.Fatalf("MaxExtension: received %d messages, want 1", len(got))
+	}
+	clock.Advance(time.Minute)
+	if got := count(msgs); len(got) != 0 {
+		t.Errorf("MaxExtension: redelivered %d messages within MaxExtension", len(got))
+	}
+	clock.Advance(time.Second)
+	if got := count(msgs); len(got) != 1 || deliveryAttempt(got[0]) != 2 {
+		t.Errorf("MaxExtension: got %d redeliveries after MaxExtension, want 1", len(got))
+	}
+	close(block)
+	stop()
+}
+
+func TestManualDelivery(t *testing.T) {
+	ctx := context.Background()
+	client := NewBroker(WithManualDelivery()).Client("p")
+	topic, err := client.CreateTopic(ctx, "topic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := client.CreateSubscription(ctx, "sub", psiface.SubscriptionConfig{Topic: topic})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub.SetReceiveSettings(pubsub.ReceiveSettings{NumGoroutines: 1})
+	for _, data := range []string{"a", "b", "c"} {
+		if _, err := topic.Publish(ctx, newMessage(data, nil)).Get(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var handled []string // accessed only by the callback and after Deliver
+	rctx, cancel := context.WithCancel(ctx)
+	done := make(chan error, 1)
+	go func() {
+		done <- sub.Receive(rctx, func(_ context.Context, m psiface.Message) {
+			handled = append(handled, string(m.Data()))
+			if string(m.Data()) == "c" && deliveryAttempt(m) == 1 {
+				m.Nack()
+				return
+			}
+			m.Ack()
+		})
+	}()
+	deliver := func(want ...string) {
+		t.Helper()
+		handled = nil
+		n, err := client.Deliver(ctx, "sub")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != len(want) || !reflect.DeepEqual(handled, want) {
+			t.Errorf("Deliver = %d, handled %q; want %d, %q", n, handled, len(want), want)
+		}
+	}
+	deliver("a", "b", "c")
+	deliver("c")
+	deliver()
+
+	records := func(rs []MessageRecord) []string {
+		var got []string
+		for _, r := range rs {
+			got = append(got, fmt.Sprintf("%s/%d", r.Data, r.DeliveryAttempt))
+		}
+		return got
+	}
+	if got, want := records(client.Published("sub")), []string{"a/0", "b/0", "c/0"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Published = %q, want %q", got, want)
+	}
+	if got, want := records(client.Acked("sub")), []string{"a/1", "b/1", "c/2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Acked = %q, want %q", got, want)
+	}
+	if got, want := records(client.Nacked("sub")), []string{"c/1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Nacked = %q, want %q", got, want)
+	}
+	if got := client.Outstanding("sub"); len(got) != 0 {
+		t.Errorf("Outstanding = %q, want none", records(got))
+	}
+	if got := client.Published("missing"); got != nil {
+		t.Errorf("Published of missing subscription = %v, want nil", got)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	// Deliver waits for a call to Receive.
+	dctx, dcancel := context.WithTimeout(ctx, 5*pollInterval)
+	defer dcancel()
+	if _, err := client.Deliver(dctx, "sub"); err != context.DeadlineExceeded {
+		t.Errorf("Deliver without Receive: got %v, want %v", err, context.DeadlineExceeded)
+	}
+	if _, err := NewBroker().Client("p").Deliver(ctx, "sub"); err == nil {
+		t.Error("Deliver without WithManualDelivery succeeded")
+	}
+
+	// Pull returns messages without a call to Receive.
+	for _, data := range []string{"d", "e"} {
+		if _, err := topic.Publish(ctx, newMessage(data, nil)).Get(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	msgs, err := client.Pull("sub", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 || string(msgs[0].Data()) != "d" {
+		t.Fatalf("Pull(1) returned %d messages, want d", len(msgs))
+	}
+	if got, want := records(client.Outstanding("sub")), []string{"d/1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Outstanding = %q, want %q", got, want)
+	}
+	msgs[0].Ack()
+	if msgs, err = client.Pull("sub", 0); err != nil || len(msgs) != 1 || string(msgs[0].Data()) != "e" {
+		t.Errorf("Pull(0) = %d messages, %v; want e", len(msgs), err)
+	}
+	if _, err := client.Pull("missing", 0); status.Code(err) != codes.NotFound {
+		t.Errorf("Pull of missing subscription: got %v, want NotFound", err)
+	}
+}
+
+func TestDeadLetter(t *testing.T) {
+	ctx := context.Background()
+	client := NewBroker().Client("p")
+	topic, err := client.CreateTopic(ctx, "topic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dlt, err := client.CreateTopic(ctx, "dead-letters")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dls, err := client.CreateSubscription(ctx, "dead-letters", psiface.SubscriptionConfig{Topic: dlt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []*pubsub.DeadLetterPolicy{
+		{DeadLetterTopic: "dead-letters"},
+		{DeadLetterTopic: dlt.String(), MaxDeliveryAttempts: 4},
+		{DeadLetterTopic: dlt.String(), MaxDeliveryAttempts: 101},
+	} {
+		_, err := client.CreateSubscription(ctx, "sub", psiface.SubscriptionConfig{Topic: topic, SubscriptionConfig: pubsub.SubscriptionConfig{DeadLetterPolicy: p}})
+		if got, want := status.Code(err), codes.InvalidArgument; got != want {
+			t.Errorf("%+v: got %v, want %v", p, got, want)
+		}
+	}
+	sub, err := client.CreateSubscription(ctx, "sub", psiface.SubscriptionConfig{
+		Topic: topic,
+		SubscriptionConfig: pubsub.SubscriptionConfig{
+			DeadLetterPolicy: &pubsub.DeadLetterPolicy{DeadLetterTopic: dlt.String(), MaxDeliveryAttempts: 6},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := topic.Publish(ctx, newMessage("poison", map[string]string{"a": "b"})).Get(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	rctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	var attempts []int
+	err = sub.Receive(rctx, func(_ context.Context, m psiface.Message) {
+		attempts = append(attempts, deliveryAttempt(m))
+		m.Nack()
+		if len(attempts) == 6 {
+			cancel()
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{1, 2, 3, 4, 5, 6}; !reflect.DeepEqual(attempts, want) {
+		t.Errorf("delivery attempts = %v, want %v", attempts, want)
+	}
+
+	m := receiveN(t, dls, 1)[0]
+	if got, want := string(m.Data()), "poison"; got != want {
+		t.Errorf("dead-lettered data = %q, want %q", got, want)
+	}
+	want := map[string]string{
+		"a":                                    "b",
+		DeadLetterDeliveryCountAttribute:       "6",
+		DeadLetterSubscriptionAttribute:        "sub",
+		DeadLetterSubscriptionProjectAttribute: "p",
+	}
+	got := m.Attributes()
+	if _, err := time.Parse(time.RFC3339Nano, got[DeadLetterTopicPublishTimeAttribute]); err != nil {
+		t.Errorf("publish time attribute: %v", err)
+	}
+	delete(got, DeadLetterTopicPublishTimeAttribute)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("dead-lettered attributes = %v, want %v", got, want)
+	}
+
+	// The message is no longer in the subscription.
+	rctx, cancel = context.WithTimeout(ctx, 5*pollInterval)
+	defer cancel()
+	if err := sub.Receive(rctx, func(_ context.Context, m psiface.Message) {
+		t.Errorf("unexpected redelivery of %q", m.Data())
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOrdering(t *testing.T) {
+	ctx := context.Background()
+	client := NewBroker().Client("p")
+	topic, err := client.CreateTopic(ctx, "topic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := client.CreateSubscription(ctx, "sub", psiface.SubscriptionConfig{
+		Topic:              topic,
+		SubscriptionConfig: pubsub.SubscriptionConfig{EnableMessageOrdering: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = topic.Publish(ctx, psiface.NewMessage([]byte("x"), nil, "k")).Get(ctx)
+	if err != errOrderingNotEnabled {
+		t.Errorf("publish without ordering: got %v, want %v", err, errOrderingNotEnabled)
+	}
+	topic.SetEnableMessageOrdering(true)
+	const perKey = 20
+	keys := []string{"a", "b", "c"}
+	for i := 0; i < perKey; i++ {
+		for _, k := range keys {
+			if _, err := topic.Publish(ctx, psiface.NewMessage([]byte(fmt.Sprint(i)), nil, k)).Get(ctx); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	rctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	var (
+		mu     sync.Mutex
+		got    = make(map[string][]string)
+		nacked = make(map[string]bool)
+		n      int
+		wg     sync.WaitGroup
+	)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := sub.Receive(rctx, func(_ context.Context, m psiface.Message) {
+				mu.Lock()
+				defer mu.Unlock()
+				// Nack every third message once.
+				if id := m.ID(); len(got[m.OrderingKey()])%3 == 1 && !nacked[id] {
+					nacked[id] = true
+					m.Nack()
+					return
+				}
+				got[m.OrderingKey()] = append(got[m.OrderingKey()], string(m.Data()))
+				m.Ack()
+				if n++; n == perKey*len(keys) {
+					cancel()
+				}
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	for _, k := range keys {
+		if len(got[k]) != perKey {
+			t.Fatalf("key %q: received %d messages, want %d", k, len(got[k]), perKey)
+		}
+		for i, data := range got[k] {
+			if data != fmt.Sprint(i) {
+				t.Errorf("key %q: message %d is %q, want %d", k, i, data, i)
+			}
+		}
+	}
+}
+
+func TestResumePublish(t *testing.T) {
+	ctx := context.Background()
+	client := NewBroker().Client("p")
+	topic := client.Topic("topic")
+	topic.SetEnableMessageOrdering(true)
+	msg := psiface.NewMessage([]byte("x"), nil, "k")
+	_, err := topic.Publish(ctx, msg).Get(ctx)
+	if got, want := status.Code(err), codes.NotFound; got != want {
+		t.Fatalf("publish to missing topic: got %v, want %v", err, want)
+	}
+	if _, err := client.CreateTopic(ctx, "topic"); err != nil {
+		t.Fatal(err)
+	}
+	_, err = topic.Publish(ctx, msg).Get(ctx)
+	if want := (pubsub.ErrPublishingPaused{OrderingKey: "k"}); err != want {
+		t.Errorf("publish after failure: got %v, want %v", err, want)
+	}
+	// Other keys are not paused.
+	if _, err := topic.Publish(ctx, psiface.NewMessage([]byte("x"), nil, "other")).Get(ctx); err != nil {
+		t.Errorf("publish with another key: %v", err)
+	}
+	topic.ResumePublish("k")
+	if _, err := topic.Publish(ctx, msg).Get(ctx); err != nil {
+		t.Errorf("publish after ResumePublish: %v", err)
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	attrs := map[string]string{"type": "order", "region": "eu-west", "a b": "c"}
+	for _, test := range []struct {
+		filter string
+		want   bool
+	}{
+		{`attributes:type`, true},
+		{`attributes:missing`, false},
+		{`attributes."a b" = "c"`, true},
+		{`attributes.type = "order"`, true},
+		{`attributes.type='order'`, true},
+		{`attributes.type = "invoice"`, false},
+		{`attributes.type != "invoice"`, true},
+		{`attributes.missing != "invoice"`, false},
+		{`hasPrefix(attributes.region, "eu-")`, true},
+		{`hasPrefix(attributes.region, "us-")`, false},
+		{`hasPrefix(attributes.missing, "")`, false},
+		{`NOT attributes:missing`, true},
+		{`-attributes:type`, false},
+		{`NOT NOT attributes:type`, true},
+		{`attributes:type AND attributes:region AND attributes:missing`, false},
+		{`attributes:missing OR attributes:other OR attributes:type`, true},
+		{`attributes:type AND (attributes:missing OR hasPrefix(attributes.region, "eu"))`, true},
+		{`(attributes:type AND attributes:missing) OR attributes:other`, false},
+		{`attributes.type = "say \"hi\""`, false},
+	} {
+		e, err := parseFilter(test.filter)
+		if err != nil {
+			t.Errorf("%s: %v", test.filter, err)
+			continue
+		}
+		if got := e.matches(attrs); got != test.want {
+			t.Errorf("%s: got %t, want %t", test.filter, got, test.want)
+		}
+	}
+	for _, filter := range []string{
+		`attributes`,
+		`attributes.type`,
+		`attributes.type = order`,
+		`attributes.type == "order"`,
+		`attributes:type AND attributes:region OR attributes:other`,
+		`(attributes:type`,
+		`attributes:type)`,
+		`hasPrefix(attributes.type)`,
+		`data = "x"`,
+		`attributes.type = "order`,
+		`attributes:type && attributes:region`,
+		`attributes:type and attributes:region`,
+		`attributes:` + strings.Repeat("x", maxFilterLength),
+	} {
+		if _, err := parseFilter(filter); err == nil {
+			t.Errorf("%s: got nil error, want error", filter)
+		}
+	}
+}
+
+func TestFilter(t *testing.T) {
+	ctx := context.Background()
+	client := NewBroker().Client("p")
+	topic, err := client.CreateTopic(ctx, "topic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := func(filter string) psiface.SubscriptionConfig {
+		return psiface.SubscriptionConfig{Topic: topic, SubscriptionConfig: pubsub.SubscriptionConfig{Filter: filter}}
+	}
+	_, err = client.CreateSubscription(ctx, "bad", cfg(`attributes.type = `))
+	if got, want := status.Code(err), codes.InvalidArgument; got != want {
+		t.Errorf("invalid filter: got %v, want %v", err, want)
+	}
+	orders, err := client.CreateSubscription(ctx, "orders", cfg(`attributes.type = "order"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	others, err := client.CreateSubscription(ctx, "others", cfg(`NOT attributes.type = "order"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, typ := range []string{"order", "invoice", "order", ""} {
+		attrs := map[string]string{"type": typ}
+		if typ == "" {
+			attrs = nil
+		}
+		if _, err := topic.Publish(ctx, newMessage(fmt.Sprint(i), attrs)).Get(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, test := range []struct {
+		sub  psiface.Subscription
+		want []string
+	}{
+		{orders, []string{"0", "2"}},
+		{others, []string{"1", "3"}},
+	} {
+		var got []string
+		for _, m := range receiveN(t, test.sub, len(test.want)) {
+			got = append(got, string(m.Data()))
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%v: received %v, want %v", test.sub, got, test.want)
+		}
+	}
+}
+
+func TestSeek(t *testing.T) {
+	ctx := context.Background()
+	clock := newFakeClock()
+	client := NewBroker(WithClock(clock.Now)).Client("p")
+	topic, err := client.CreateTopic(ctx, "topic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	retaining, err := client.CreateSubscription(ctx, "retaining", psiface.SubscriptionConfig{
+		Topic:              topic,
+		SubscriptionConfig: pubsub.SubscriptionConfig{RetainAckedMessages: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := client.CreateSubscription(ctx, "plain", psiface.SubscriptionConfig{Topic: topic})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var times []time.Time
+	for _, data := range []string{"0", "1", "2"} {
+		times = append(times, clock.Now())
+		if _, err := topic.Publish(ctx, newMessage(data, nil)).Get(ctx); err != nil {
+			t.Fatal(err)
+		}
+		clock.Advance(time.Minute)
+	}
+	for _, sub := range []psiface.Subscription{retaining, plain} {
+		receiveData(t, sub, 3)
+		if err := sub.SeekToTime(ctx, times[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := receiveData(t, retaining, 2), []string{"1", "2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after seeking back: got %v, want %v", got, want)
+	}
+	expectNone(t, retaining)
+	expectNone(t, plain)
+
+	// Seeking forward acks messages.
+	if _, err := topic.Publish(ctx, newMessage("3", nil)).Get(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := plain.SeekToTime(ctx, clock.Now().Add(time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	expectNone(t, plain)
+
+	if err := client.Subscription("missing").SeekToTime(ctx, times[0]); status.Code(err) != codes.NotFound {
+		t.Errorf("seeking a missing subscription: got %v, want NotFound", err)
+	}
+}
+
+func TestSnapshots(t *testing.T) {
+	ctx := context.Background()
+	clock := newFakeClock()
+	client := NewBroker(WithClock(clock.Now)).Client("p")
+	topic, err := client.CreateTopic(ctx, "topic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := client.CreateSubscription(ctx, "sub", psiface.SubscriptionConfig{Topic: topic})
+	if err != nil {
+		t.Fatal(err)
+	}
+	publish := func(data string) {
+		t.Helper()
+		if _, err := topic.Publish(ctx, newMessage(data, nil)).Get(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	publish("acked")
+	receiveData(t, sub, 1)
+	publish0 := clock.Now()
+	publish("unacked")
+	clock.Advance(time.Minute)
+
+	cfg, err := sub.CreateSnapshot(ctx, "snap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := cfg.Snapshot.ID(), "snap"; got != want {
+		t.Errorf("ID = %q, want %q", got, want)
+	}
+	if got, want := cfg.Topic.String(), topic.String(); got != want {
+		t.Errorf("Topic = %q, want %q", got, want)
+	}
+	if got, want := cfg.Expiration, publish0.Add(7*24*time.Hour); !got.Equal(want) {
+		t.Errorf("Expiration = %v, want %v", got, want)
+	}
+	if _, err := sub.CreateSnapshot(ctx, "snap"); status.Code(err) != codes.AlreadyExists {
+		t.Errorf("duplicate snapshot: got %v, want AlreadyExists", err)
+	}
+	generated, err := sub.CreateSnapshot(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publish("later")
+	if got, want := receiveData(t, sub, 2), []string{"unacked", "later"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if err := sub.SeekToSnapshot(ctx, client.Snapshot("snap")); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := receiveData(t, sub, 2), []string{"unacked", "later"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after seeking to the snapshot: got %v, want %v", got, want)
+	}
+	expectNone(t, sub)
+
+	// A snapshot can be used by another subscription to the topic.
+	other, err := client.CreateSubscription(ctx, "other", psiface.SubscriptionConfig{Topic: topic})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := other.SeekToSnapshot(ctx, cfg.Snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := receiveData(t, other, 2), []string{"unacked", "later"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("other subscription: got %v, want %v", got, want)
+	}
+
+	var names []string
+	it := client.Snapshots(ctx)
+	for {
+		cfg, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, cfg.Snapshot.ID())
+	}
+	if want := []string{"snap", generated.Snapshot.ID()}; !reflect.DeepEqual(names, want) {
+		t.Errorf("Snapshots: got %v, want %v", names, want)
+	}
+	if err := cfg.Snapshot.Delete(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := sub.SeekToSnapshot(ctx, cfg.Snapshot); status.Code(err) != codes.NotFound {
+		t.Errorf("seeking to a deleted snapshot: got %v, want NotFound", err)
+	}
+	if err := cfg.Snapshot.Delete(ctx); status.Code(err) != codes.NotFound {
+		t.Errorf("deleting a deleted snapshot: got %v, want NotFound", err)
+	}
+
+	// Snapshots expire.
+	clock.Advance(7 * 24 * time.Hour)
+	if err := sub.SeekToSnapshot(ctx, generated.Snapshot); status.Code(err) != codes.NotFound {
+		t.Errorf("seeking to an expired snapshot: got %v, want NotFound", err)
+	}
+}
+
+func TestRetention(t *testing.T) {
+	ctx := context.Background()
+	clock := newFakeClock()
+	client := NewBroker(WithClock(clock.Now)).Client("p")
+	topic, err := client.CreateTopic(ctx, "topic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := func(d time.Duration) psiface.SubscriptionConfig {
+		return psiface.SubscriptionConfig{
+			Topic:              topic,
+			SubscriptionConfig: pubsub.SubscriptionConfig{RetainAckedMessages: true, RetentionDuration: d},
+		}
+	}
+	if _, err := client.CreateSubscription(ctx, "sub", cfg(time.Minute)); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("short retention: got %v, want InvalidArgument", err)
+	}
+	sub, err := client.CreateSubscription(ctx, "sub", cfg(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := clock.Now()
+	for _, data := range []string{"a", "b", "c"} {
+		if _, err := topic.Publish(ctx, newMessage(data, nil)).Get(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if data != "c" {
+			receiveData(t, sub, 1)
+		}
+		clock.Advance(30 * time.Minute)
+	}
+	// Now a is 90 minutes old and no longer retained, b is 60 and c, which
+	// is unacked, is 30.
+	if err := sub.SeekToTime(ctx, start); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := receiveData(t, sub, 2), []string{"b", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after seeking: got %v, want %v", got, want)
+	}
+	expectNone(t, sub)
+}
+
+func TestTopicRetention(t *testing.T) {
+	ctx := context.Background()
+	clock := newFakeClock()
+	client := NewBroker(WithClock(clock.Now)).Client("p")
+	if _, err := client.CreateTopicWithConfig(ctx, "short", &pubsub.TopicConfig{RetentionDuration: time.Minute}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("short retention: got %v, want InvalidArgument", err)
+	}
+	topic, err := client.CreateTopicWithConfig(ctx, "topic", &pubsub.TopicConfig{RetentionDuration: 2 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := topic.Update(ctx, pubsub.TopicConfigToUpdate{RetentionDuration: 40 * 24 * time.Hour}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("long retention: got %v, want InvalidArgument", err)
+	}
+	start := clock.Now()
+	if _, err := topic.Publish(ctx, newMessage("a", nil)).Get(ctx); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(10 * time.Minute)
+	sub, err := client.CreateSubscription(ctx, "sub", psiface.SubscriptionConfig{
+		Topic:              topic,
+		SubscriptionConfig: pubsub.SubscriptionConfig{RetentionDuration: 10 * time.Minute},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := topic.Publish(ctx, newMessage("b", nil)).Get(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// b is older than the subscription's retention, but not the topic's, and
+	// seeking brings back a, published before the subscription was created.
+	clock.Advance(30 * time.Minute)
+	if err := sub.SeekToTime(ctx, start); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := receiveData(t, sub, 2), []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after seeking: got %v, want %v", got, want)
+	}
+	expectNone(t, sub)
+
+	clock.Advance(2 * time.Hour)
+	if err := sub.SeekToTime(ctx, start); err != nil {
+		t.Fatal(err)
+	}
+	expectNone(t, sub)
+}
+
+func TestExpiration(t *testing.T) {
+	ctx := context.Background()
+	clock := newFakeClock()
+	client := NewBroker(WithClock(clock.Now)).Client("p")
+	topic, err := client.CreateTopic(ctx, "topic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	create := func(id string, policy interface{}) psiface.Subscription {
+		t.Helper()
+		sub, err := client.CreateSubscription(ctx, id, psiface.SubscriptionConfig{
+			Topic:              topic,
+			SubscriptionConfig: pubsub.SubscriptionConfig{ExpirationPolicy: policy},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sub
+	}
+	exists := func(sub psiface.Subscription) bool {
+		t.Helper()
+		ok, err := sub.Exists(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ok
+	}
+	if _, err := client.CreateSubscription(ctx, "short", psiface.SubscriptionConfig{
+		Topic:              topic,
+		SubscriptionConfig: pubsub.SubscriptionConfig{ExpirationPolicy: time.Hour},
+	}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("short expiration policy: got %v, want InvalidArgument", err)
+	}
+	idle := create("idle", 24*time.Hour)
+	active := create("active", 24*time.Hour)
+	never := create("never", time.Duration(0))
+	def := create("default", nil)
+	cfg, err := def.Config(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := cfg.ExpirationPolicy, interface{}(31*24*time.Hour); got != want {
+		t.Errorf("default expiration policy: got %v, want %v", got, want)
+	}
+
+	clock.Advance(23 * time.Hour)
+	if _, err := client.Pull("active", 0); err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Hour)
+	if exists(idle) {
+		t.Error("idle subscription not deleted")
+	}
+	if _, err := idle.Config(ctx); status.Code(err) != codes.NotFound {
+		t.Errorf("Config of expired subscription: got %v, want NotFound", err)
+	}
+	if !exists(active) {
+		t.Error("active subscription deleted")
+	}
+
+	// A running Receive keeps the subscription alive, however long it waits.
+	if _, err := topic.Publish(ctx, newMessage("a", nil)).Get(ctx); err != nil {
+		t.Fatal(err)
+	}
+	rctx, cancel := context.WithCancel(ctx)
+	err = active.Receive(rctx, func(_ context.Context, m psiface.Message) {
+		clock.Advance(48 * time.Hour)
+		if !exists(active) {
+			t.Error("subscription deleted while receiving")
+		}
+		m.Ack()
+		cancel()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !exists(active) {
+		t.Error("subscription deleted after receiving")
+	}
+	clock.Advance(24 * time.Hour)
+	if exists(active) {
+		t.Error("subscription not deleted after Receive returned")
+	}
+
+	if !exists(def) {
+		t.Error("subscription with default expiration policy deleted")
+	}
+	clock.Advance(31 * 24 * time.Hour)
+	if exists(def) {
+		t.Error("subscription with default expiration policy not deleted")
+	}
+	if !exists(never) {
+		t.Error("subscription that never expires deleted")
+	}
+}
+
+func TestPush(t *testing.T) {
+	key := []byte("secret")
+	type request struct {
+		auth string
+		body []byte
+		req  PushRequest
+	}
+	requests := make(chan request, 10)
+	var failed int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+		}
+		var req PushRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			t.Error(err)
+		}
+		requests <- request{r.Header.Get("Authorization"), body, req}
+		if string(req.Message.Data) == "fail" {
+			if atomic.AddInt32(&failed, 1) == 1 {
+				http.Error(w, "failed", http.StatusInternalServerError)
+				return
+			}
+			// Any 2xx response acks the message.
+			w.WriteHeader(http.StatusPartialContent)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	clock := newFakeClock()
+	b := NewBroker(WithClock(clock.Now), WithTokenSigner(HMACTokenSigner(key)))
+	defer b.Close()
+	client := b.Client("p")
+	topic, err := client.CreateTopic(ctx, "topic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := client.CreateSubscription(ctx, "sub", psiface.SubscriptionConfig{
+		Topic: topic,
+		SubscriptionConfig: pubsub.SubscriptionConfig{
+			PushConfig: pubsub.PushConfig{
+				Endpoint:             srv.URL,
+				AuthenticationMethod: &pubsub.OIDCToken{ServiceAccountEmail: "pusher@p.iam.gserviceaccount.com"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sub.Receive(ctx, func(context.Context, psiface.Message) {}); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("Receive on a push subscription: got %v, want FailedPrecondition", err)
+	}
+
+	next := func() request {
+		t.Helper()
+		select {
+		case r := <-requests:
+			return r
+		case <-time.After(10 * time.Second):
+			t.Fatal("timed out waiting for a push request")
+			return request{}
+		}
+	}
+	id, err := topic.Publish(ctx, newMessage("hello", map[string]string{"a": "b"})).Get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := next()
+	want := PushRequest{
+		Message: PushMessage{
+			Data:        []byte("hello"),
+			Attributes:  map[string]string{"a": "b"},
+			MessageID:   id,
+			PublishTime: clock.Now(),
+		},
+		Subscription:    "projects/p/subscriptions/sub",
+		DeliveryAttempt: 1,
+	}
+	if !reflect.DeepEqual(r.req, want) {
+		t.Errorf("got request %+v, want %+v", r.req, want)
+	}
+	for _, field := range []string{`"message_id"`, `"publish_time"`} {
+		if !strings.Contains(string(r.body), field) {
+			t.Errorf("request body %s does not contain %s", r.body, field)
+		}
+	}
+	parts := strings.Split(strings.TrimPrefix(r.auth, "Bearer "), ".")
+	if len(parts) != 3 {
+		t.Fatalf("Authorization header %q does not have a JWT", r.auth)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if got, want := parts[2], base64.RawURLEncoding.EncodeToString(mac.Sum(nil)); got != want {
+		t.Errorf("token signature %q, want %q", got, want)
+	}
+	claimsJSON, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var claims struct {
+		Aud      string
+		Iat, Exp int64
+	}
+	if err := json.Unmarshal(claimsJSON, &claims); err != nil {
+		t.Fatal(err)
+	}
+	if claims.Aud != srv.URL {
+		t.Errorf("token claims %s do not have the endpoint as audience", claimsJSON)
+	}
+	// The token is issued at the time of the Broker's clock.
+	if now := clock.Now(); claims.Iat != now.Unix() || claims.Exp != now.Add(time.Hour).Unix() {
+		t.Errorf("token claims %s, want issued at %v and expiring an hour later", claimsJSON, now)
+	}
+
+	// A failed push is retried after a backoff.
+	if _, err := topic.Publish(ctx, newMessage("fail", nil)).Get(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if r := next(); r.req.DeliveryAttempt != 1 {
+		t.Errorf("first push has attempt %d", r.req.DeliveryAttempt)
+	}
+	select {
+	case r := <-requests:
+		t.Fatalf("pushed %q again before the backoff", r.req.Message.Data)
+	case <-time.After(5 * pollInterval):
+	}
+	clock.Advance(minPushBackoff)
+	if r := next(); r.req.DeliveryAttempt != 2 || string(r.req.Message.Data) != "fail" {
+		t.Errorf("got %q with attempt %d, want \"fail\" with attempt 2", r.req.Message.Data, r.req.DeliveryAttempt)
+	}
+	select {
+	case r := <-requests:
+		t.Fatalf("acked message %q pushed again", r.req.Message.Data)
+	case <-time.After(5 * pollInterval):
+	}
+}
+
+func TestPushBackoff(t *testing.T) {
+	for _, test := range []struct {
+		policy   *pubsub.RetryPolicy
+		attempts int
+		want     time.Duration
+	}{
+		{nil, 1, 100 * time.Millisecond},
+		{nil, 3, 400 * time.Millisecond},
+		{nil, 100, time.Minute},
+		{&pubsub.RetryPolicy{}, 1, 10 * time.Second},
+		{&pubsub.RetryPolicy{}, 100, 600 * time.Second},
+		{&pubsub.RetryPolicy{MinimumBackoff: time.Second, MaximumBackoff: 3 * time.Second}, 2, 2 * time.Second},
+		{&pubsub.RetryPolicy{MinimumBackoff: time.Second, MaximumBackoff: 3 * time.Second}, 3, 3 * time.Second},
+	} {
+		if got := pushBackoff(test.policy, test.attempts); got != test.want {
+			t.Errorf("pushBackoff(%+v, %d) = %v, want %v", test.policy, test.attempts, got, test.want)
+		}
+	}
+}
+
+func TestAdmin(t *testing.T) {
+	ctx := context.Background()
+	b := NewBroker()
+	client := b.Client("p")
+	topic, err := client.CreateTopic(ctx, "topic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkCode := func(what string, err error, want codes.Code) {
+		t.Helper()
+		if got := status.Code(err); got != want {
+			t.Errorf("%s: got %v (%v), want %v", what, got, err, want)
+		}
+	}
+	_, err = client.CreateTopic(ctx, "topic")
+	checkCode("duplicate topic", err, codes.AlreadyExists)
+	_, err = client.CreateTopic(ctx, "x")
+	checkCode("invalid topic ID", err, codes.InvalidArgument)
+	_, err = client.CreateTopic(ctx, "goog-topic")
+	checkCode("reserved topic ID", err, codes.InvalidArgument)
+	_, err = client.CreateSubscription(ctx, "sub", psiface.SubscriptionConfig{Topic: client.Topic("missing")})
+	checkCode("missing topic", err, codes.NotFound)
+	_, err = client.Topic("missing").Publish(ctx, newMessage("m", nil)).Get(ctx)
+	checkCode("publish to missing topic", err, codes.NotFound)
+
+	sub, err := client.CreateSubscription(ctx, "sub", psiface.SubscriptionConfig{Topic: topic})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.CreateSubscription(ctx, "sub", psiface.SubscriptionConfig{Topic: topic})
+	checkCode("duplicate subscription", err, codes.AlreadyExists)
+
+	// Projects are separate.
+	if _, err := b.Client("q").CreateTopic(ctx, "topic"); err != nil {
+		t.Errorf("topic in another project: %v", err)
+	}
+	if ok, err := b.Client("q").Subscription("sub").Exists(ctx); err != nil || ok {
+		t.Errorf("Exists in another project = %t, %v; want false, nil", ok, err)
+	}
+
+	if ok, err := client.Subscription("sub").Exists(ctx); err != nil || !ok {
+		t.Errorf("Exists = %t, %v; want true, nil", ok, err)
+	}
+	received := make(chan error, 1)
+	go func() {
+		received <- sub.Receive(ctx, func(context.Context, psiface.Message) {})
+	}()
+	if err := sub.Delete(ctx); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-received:
+		checkCode("Receive on deleted subscription", err, codes.NotFound)
+	case <-time.After(10 * time.Second):
+		t.Fatal("Receive did not return after Delete")
+	}
+	if ok, err := sub.Exists(ctx); err != nil || ok {
+		t.Errorf("Exists after Delete = %t, %v; want false, nil", ok, err)
+	}
+	checkCode("second Delete", sub.Delete(ctx), codes.NotFound)
+}
+
+func TestTopicAdmin(t *testing.T) {
+	ctx := context.Background()
+	b := NewBroker()
+	client := b.Client("p")
+	var topics []psiface.Topic
+	for _, id := range []string{"topic-b", "topic-a"} {
+		topic, err := client.CreateTopic(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		topics = append(topics, topic)
+	}
+	if _, err := b.Client("q").CreateTopic(ctx, "topic-c"); err != nil {
+		t.Fatal(err)
+	}
+	topic := topics[0]
+	for _, id := range []string{"sub-2", "sub-1"} {
+		if _, err := client.CreateSubscription(ctx, id, psiface.SubscriptionConfig{Topic: topic}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := client.CreateSubscription(ctx, "sub-3", psiface.SubscriptionConfig{Topic: topics[1]}); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for it := client.Topics(ctx); ; {
+		tp, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, tp.ID())
+	}
+	if want := []string{"topic-a", "topic-b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Topics = %q, want %q", got, want)
+	}
+	subIDs := func(it psiface.SubscriptionIterator) []string {
+		t.Helper()
+		var ids []string
+		for {
+			s, err := it.Next()
+			if err == iterator.Done {
+				return ids
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, s.ID())
+		}
+	}
+	if got, want := subIDs(client.Subscriptions(ctx)), []string{"sub-1", "sub-2", "sub-3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Client.Subscriptions = %q, want %q", got, want)
+	}
+	if got, want := subIDs(topic.Subscriptions(ctx)), []string{"sub-1", "sub-2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Topic.Subscriptions = %q, want %q", got, want)
+	}
+	if _, err := client.Topic("missing").Subscriptions(ctx).Next(); status.Code(err) != codes.NotFound {
+		t.Errorf("Subscriptions of missing topic: got %v, want NotFound", err)
+	}
+
+	if _, err := topic.Update(ctx, pubsub.TopicConfigToUpdate{}); err != errNoTopicUpdate {
+		t.Errorf("empty Update: got %v, want %v", err, errNoTopicUpdate)
+	}
+	cfg, err := topic.Update(ctx, pubsub.TopicConfigToUpdate{
+		Labels:            map[string]string{"env": "test"},
+		RetentionDuration: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg, err = topic.Config(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Labels["env"] != "test" || cfg.RetentionDuration != time.Hour {
+		t.Errorf("Config = %+v, want labels and retention", cfg)
+	}
+	if cfg, err = topic.Update(ctx, pubsub.TopicConfigToUpdate{RetentionDuration: time.Duration(-1)}); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.RetentionDuration != nil || cfg.Labels["env"] != "test" {
+		t.Errorf("after clearing retention, Config = %+v", cfg)
+	}
+
+	if err := topic.Delete(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := topic.Exists(ctx); err != nil || ok {
+		t.Errorf("Exists after Delete = %t, %v; want false, nil", ok, err)
+	}
+	if status.Code(topic.Delete(ctx)) != codes.NotFound {
+		t.Error("second Delete succeeded")
+	}
+	if _, err := topic.Config(ctx); status.Code(err) != codes.NotFound {
+		t.Errorf("Config of deleted topic: got %v, want NotFound", err)
+	}
+	// The subscriptions remain, detached from the topic.
+	scfg, err := client.Subscription("sub-1").Config(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := scfg.Topic.String(); got != deletedTopic {
+		t.Errorf("topic of subscription = %q, want %q", got, deletedTopic)
+	}
+
+	// Stop makes later publishes fail.
+	topic = topics[1]
+	topic.Stop()
+	if _, err := topic.Publish(ctx, newMessage("m", nil)).Get(ctx); err != pubsub.ErrTopicStopped {
+		t.Errorf("Publish after Stop: got %v, want %v", err, pubsub.ErrTopicStopped)
+	}
+}
+
+func TestSubscriptionUpdate(t *testing.T) {
+	ctx := context.Background()
+	client := NewBroker().Client("p")
+	topic, err := client.CreateTopic(ctx, "topic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := client.CreateSubscription(ctx, "sub", psiface.SubscriptionConfig{Topic: topic})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := sub.Config(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Topic.String() != topic.String() || cfg.AckDeadline != defaultAckDeadline || cfg.RetentionDuration != defaultRetentionDuration {
+		t.Errorf("Config = %+v, want defaults", cfg)
+	}
+	if sub.ID() != "sub" {
+		t.Errorf("ID = %q, want %q", sub.ID(), "sub")
+	}
+
+	if _, err := sub.Update(ctx, pubsub.SubscriptionConfigToUpdate{}); err != errNoSubscriptionUpdate {
+		t.Errorf("empty Update: got %v, want %v", err, errNoSubscriptionUpdate)
+	}
+	for _, u := range []pubsub.SubscriptionConfigToUpdate{
+		{AckDeadline: time.Second},
+		{RetentionDuration: time.Minute},
+		{ExpirationPolicy: time.Hour},
+		{DeadLetterPolicy: &pubsub.DeadLetterPolicy{DeadLetterTopic: "bad", MaxDeliveryAttempts: 5}},
+	} {
+		if _, err := sub.Update(ctx, u); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("Update(%+v): got %v, want InvalidArgument", u, err)
+		}
+	}
+	retry := &pubsub.RetryPolicy{MinimumBackoff: time.Second}
+	cfg, err = sub.Update(ctx, pubsub.SubscriptionConfigToUpdate{
+		AckDeadline:         time.Minute,
+		RetainAckedMessages: true,
+		ExpirationPolicy:    48 * time.Hour,
+		DeadLetterPolicy:    &pubsub.DeadLetterPolicy{DeadLetterTopic: topic.String()},
+		Labels:              map[string]string{"env": "test"},
+		RetryPolicy:         retry,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.AckDeadline != time.Minute || !cfg.RetainAckedMessages || cfg.ExpirationPolicy != 48*time.Hour ||
+		cfg.DeadLetterPolicy.MaxDeliveryAttempts != 5 || cfg.Labels["env"] != "test" || cfg.RetryPolicy != retry {
+		t.Errorf("after Update, Config = %+v", cfg)
+	}
+	cfg, err = sub.Update(ctx, pubsub.SubscriptionConfigToUpdate{
+		DeadLetterPolicy: &pubsub.DeadLetterPolicy{},
+		RetryPolicy:      &pubsub.RetryPolicy{},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DeadLetterPolicy != nil || cfg.RetryPolicy != nil || cfg.AckDeadline != time.Minute {
+		t.Errorf("after clearing policies, Config = %+v", cfg)
+	}
+
+	// A pull subscription becomes a push subscription.
+	if _, err := topic.Publish(ctx, newMessage("m", nil)).Get(ctx); err != nil {
+		t.Fatal(err)
+	}
+	pushed := make(chan string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req PushRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Error(err)
+		}
+		pushed <- string(req.Message.Data)
+	}))
+	defer srv.Close()
+	if _, err := sub.Update(ctx, pubsub.SubscriptionConfigToUpdate{PushConfig: &pubsub.PushConfig{Endpoint: srv.URL}}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case data := <-pushed:
+		if data != "m" {
+			t.Errorf("pushed %q, want %q", data, "m")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("message was not pushed after Update")
+	}
+	if _, err := client.Subscription("missing").Update(ctx, pubsub.SubscriptionConfigToUpdate{AckDeadline: time.Minute}); status.Code(err) != codes.NotFound {
+		t.Errorf("Update of missing subscription: got %v, want NotFound", err)
+	}
+}
+
+func TestIAM(t *testing.T) {
+	ctx := context.Background()
+	client := NewBroker().Client("p")
+	topic, err := client.CreateTopic(ctx, "topic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := topic.IAM()
+	p, err := h.Policy(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Add("user:a@example.com", iam.Viewer)
+	if err := h.SetPolicy(ctx, p); err != nil {
+		t.Fatal(err)
+	}
+	got, err := h.Policy(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.HasRole("user:a@example.com", iam.Viewer) {
+		t.Errorf("policy %v lacks the added role", got.InternalProto)
+	}
+	// The old policy has a stale etag.
+	if err := h.SetPolicy(ctx, p); status.Code(err) != codes.Aborted {
+		t.Errorf("SetPolicy with stale etag: got %v, want Aborted", err)
+	}
+	perms := []string{"pubsub.topics.publish", "pubsub.topics.get"}
+	if granted, err := h.TestPermissions(ctx, perms); err != nil || !reflect.DeepEqual(granted, perms) {
+		t.Errorf("TestPermissions = %q, %v; want %q, nil", granted, err, perms)
+	}
+	if _, err := client.Topic("missing").IAM().Policy(ctx); status.Code(err) != codes.NotFound {
+		t.Errorf("Policy of missing topic: got %v, want NotFound", err)
+	}
+}
+
+func TestConcurrency(t *testing.T) {
+	const (
+		publishers   = 4
+		perPublisher = 50
+		receivers    = 3
+	)
+	ctx := context.Background()
+	client := NewBroker().Client("p")
+	topic, err := client.CreateTopic(ctx, "topic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := client.CreateSubscription(ctx, "sub", psiface.SubscriptionConfig{Topic: topic})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	var (
+		mu  sync.Mutex
+		got []string
+		rwg sync.WaitGroup
+	)
+	for i := 0; i < receivers; i++ {
+		rwg.Add(1)
+		go func() {
+			defer rwg.Done()
+			err := sub.Receive(rctx, func(_ context.Context, m psiface.Message) {
+				m.Ack()
+				mu.Lock()
+				defer mu.Unlock()
+				got = append(got, m.ID())
+				if len(got) == publishers*perPublisher {
+					cancel()
+				}
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+
+	var (
+		pmu  sync.Mutex
+		want []string
+		pwg  sync.WaitGroup
+	)
+	for i := 0; i < publishers; i++ {
+		pwg.Add(1)
+		go func(i int) {
+			defer pwg.Done()
+			for j := 0; j < perPublisher; j++ {
+				id, err := topic.Publish(ctx, newMessage(fmt.Sprintf("%d-%d", i, j), nil)).Get(ctx)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				pmu.Lock()
+				want = append(want, id)
+				pmu.Unlock()
+			}
+		}(i)
+	}
+	pwg.Wait()
+	rwg.Wait()
+
+	sort.Strings(got)
+	sort.Strings(want)
+	if len(got) != len(want) {
+		t.Fatalf("received %d messages, want %d", len(got), len(want))
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("received IDs differ from published IDs at %d: %q, want %q", i, got[i], want[i])
+		}
+	}
+}
+
+const (
+	avroOrder = `{
+		"type": "record", "name": "Order", "namespace": "shop",
+		"fields": [
+			{"name": "id", "type": "string"},
+			{"name": "qty", "type": "int"},
+			{"name": "note", "type": ["null", "string"], "default": null},
+			{"name": "status", "type": {"type": "enum", "name": "Status", "symbols": ["NEW", "DONE"]}},
+			{"name": "tags", "type": {"type": "array", "items": "string"}}
+		]
+	}`
+
+	protoOrder = `
+		syntax = "proto3";
+		package shop;
+
+		// An order.
+		message Order {
+			string id = 1;
+			int32 qty = 2;
+			optional string note = 3;
+			enum Status {
+				NEW = 0;
+				DONE = 1;
+			}
+			Status status = 4;
+			repeated Item items = 5 [packed = true];
+			message Item { string sku = 1; }
+			map<string, int64> counts = 6;
+			oneof payment {
+				string card = 7;
+				string cash = 8;
+			}
+		}`
+)
+
+func TestSchemaValidation(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		typ      pubsub.SchemaType
+		def      string
+		encoding pubsub.SchemaEncoding
+		valid    []string
+		invalid  []string
+	}{
+		{
+			name:     "avro JSON",
+			typ:      pubsub.SchemaAvro,
+			def:      avroOrder,
+			encoding: pubsub.EncodingJSON,
+			valid: []string{
+				`{"id": "a", "qty": 2, "status": "NEW", "tags": ["x"]}`,
+				`{"id": "a", "qty": 2, "note": {"string": "hi"}, "status": "DONE", "tags": []}`,
+				`{"id": "a", "qty": 2, "note": null, "status": "DONE", "tags": []}`,
+			},
+			invalid: []string{
+				`{"id": "a", "qty": "2", "status": "NEW", "tags": []}`,
+				`{"id": "a", "qty": 2, "status": "OLD", "tags": []}`,
+				`{"qty": 2, "status": "NEW", "tags": []}`,
+				`{"id": "a", "qty": 2, "status": "NEW", "tags": [], "extra": 1}`,
+				`{"id": "a", "qty": 2, "note": "hi", "status": "NEW", "tags": []}`,
+				`{"id": "a", "qty": 3000000000, "status": "NEW", "tags": []}`,
+				`not JSON`,
+			},
+		},
+		{
+			name:     "avro binary",
+			typ:      pubsub.SchemaAvro,
+			def:      avroOrder,
+			encoding: pubsub.EncodingBinary,
+			valid: []string{
+				"\x02a\x04\x00\x02\x02\x02x\x00",
+				"\x02a\x04\x02\x04hi\x00\x00",
+			},
+			invalid: []string{
+				"\x02a\x04\x00\x02\x02\x02x",         // truncated
+				"\x02a\x04\x00\x02\x02\x02x\x00\x00", // trailing data
+				"\x02a\x04\x00\x0a\x00",              // enum index out of range
+				"\x02a\x04\x06\x02\x00",              // union index out of range
+			},
+		},
+		{
+			name:     "avro binary zero-width items",
+			typ:      pubsub.SchemaAvro,
+			def:      `{"type": "array", "items": "null"}`,
+			encoding: pubsub.EncodingBinary,
+			valid: []string{
+				"\x04\x00",
+				"\x80\x80\x80\x80\x80\x80\x80\x80\x80\x01\x00", // 2^62 items
+			},
+			invalid: []string{
+				"\x80\x80\x80\x80\x80\x80\x80\x80\x80\x01", // truncated
+			},
+		},
+		{
+			name:     "protobuf JSON",
+			typ:      pubsub.SchemaProtocolBuffer,
+			def:      protoOrder,
+			encoding: pubsub.EncodingJSON,
+			valid: []string{
+				`{"id": "a", "qty": 2, "status": "DONE", "items": [{"sku": "s"}], "counts": {"k": "3"}, "card": "c"}`,
+				`{}`,
+			},
+			invalid: []string{
+				`{"id": 1}`,
+				`{"unknown": true}`,
+				`{"status": "OLD"}`,
+				`{"card": "c", "cash": "d"}`,
+			},
+		},
+		{
+			name:     "protobuf binary",
+			typ:      pubsub.SchemaProtocolBuffer,
+			def:      protoOrder,
+			encoding: pubsub.EncodingBinary,
+			valid: []string{
+				"\x0a\x01a\x10\x02",
+				"",
+			},
+			invalid: []string{
+				"\x0a\x05a",    // truncated
+				"\x0a\x01\xff", // invalid UTF-8
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := context.Background()
+			b := NewBroker()
+			sc := b.SchemaClient("P")
+			schema, err := sc.CreateSchema(ctx, "order", pubsub.SchemaConfig{Type: test.typ, Definition: test.def})
+			if err != nil {
+				t.Fatal(err)
+			}
+			client := b.Client("P")
+			topic, err := client.CreateTopicWithConfig(ctx, "topic", &pubsub.TopicConfig{
+				SchemaSettings: &pubsub.SchemaSettings{Schema: schema.Name, Encoding: test.encoding},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, data := range test.valid {
+				if _, err := sc.ValidateMessageWithID(ctx, []byte(data), test.encoding, "order"); err != nil {
+					t.Errorf("ValidateMessageWithID(%q): %v", data, err)
+				}
+				if _, err := topic.Publish(ctx, newMessage(data, nil)).Get(ctx); err != nil {
+					t.Errorf("Publish(%q): %v", data, err)
+				}
+			}
+			for _, data := range test.invalid {
+				if _, err := sc.ValidateMessageWithConfig(ctx, []byte(data), test.encoding, *schema); status.Code(err) != codes.InvalidArgument {
+					t.Errorf("ValidateMessageWithConfig(%q): got %v, want InvalidArgument", data, err)
+				}
+				if _, err := topic.Publish(ctx, newMessage(data, nil)).Get(ctx); status.Code(err) != codes.InvalidArgument {
+					t.Errorf("Publish(%q): got %v, want InvalidArgument", data, err)
+				}
+			}
+		})
+	}
+}
+
+func TestInvalidSchemas(t *testing.T) {
+	ctx := context.Background()
+	sc := NewBroker().SchemaClient("P")
+	for _, cfg := range []pubsub.SchemaConfig{
+		{Type: pubsub.SchemaAvro, Definition: `{"type": "record", "name": "R"}`},
+		{Type: pubsub.SchemaAvro, Definition: `{"type": "record", "name": "R", "fields": [{"name": "f", "type": "Unknown"}]}`},
+		{Type: pubsub.SchemaAvro, Definition: `{"type": "enum", "name": "E", "symbols": []}`},
+		{Type: pubsub.SchemaAvro, Definition: `["int", "int"]`},
+		{Type: pubsub.SchemaAvro, Definition: `{`},
+		{Type: pubsub.SchemaProtocolBuffer, Definition: `syntax = "proto3"; message A {} message B {}`},
+		{Type: pubsub.SchemaProtocolBuffer, Definition: `syntax = "proto3"; message A { Unknown u = 1; }`},
+		{Type: pubsub.SchemaProtocolBuffer, Definition: `syntax = "proto3"; message A { string s = 1; string t = 1; }`},
+		{Type: pubsub.SchemaProtocolBuffer, Definition: `syntax = "proto3"; import "other.proto"; message A {}`},
+		{Type: pubsub.SchemaProtocolBuffer, Definition: `message A { string s = 1; }`},
+		{Definition: `"int"`},
+	} {
+		if _, err := sc.ValidateSchema(ctx, cfg); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("ValidateSchema(%s): got %v, want InvalidArgument", cfg.Definition, err)
+		}
+		if _, err := sc.CreateSchema(ctx, "schema", cfg); status.Code(err) != codes.InvalidArgument {
+			t.Errorf("CreateSchema(%s): got %v, want InvalidArgument", cfg.Definition, err)
+		}
+	}
+	// Recursive types refer to themselves.
+	_, err := sc.ValidateSchema(ctx, pubsub.SchemaConfig{
+		Type:       pubsub.SchemaAvro,
+		Definition: `{"type": "record", "name": "Node", "fields": [{"name": "next", "type": ["null", "Node"]}]}`,
+	})
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTopicSchema(t *testing.T) {
+	ctx := context.Background()
+	b := NewBroker()
+	sc := b.SchemaClient("P")
+	client := b.Client("P")
+	const v1 = `{"type": "record", "name": "R", "fields": [{"name": "a", "type": "int"}]}`
+	const v2 = `{"type": "record", "name": "R", "fields": [{"name": "a", "type": "int"}, {"name": "b", "type": "string"}]}`
+	first, err := sc.CreateSchema(ctx, "schema", pubsub.SchemaConfig{Type: pubsub.SchemaAvro, Definition: v1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Name != "projects/P/schemas/schema" || first.RevisionID == "" {
+		t.Errorf("got %+v", first)
+	}
+
+	_, err = client.CreateTopicWithConfig(ctx, "missing", &pubsub.TopicConfig{
+		SchemaSettings: &pubsub.SchemaSettings{Schema: "projects/P/schemas/nope", Encoding: pubsub.EncodingJSON},
+	})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("got %v, want NotFound", err)
+	}
+	_, err = client.CreateTopicWithConfig(ctx, "noencoding", &pubsub.TopicConfig{
+		SchemaSettings: &pubsub.SchemaSettings{Schema: first.Name},
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("got %v, want InvalidArgument", err)
+	}
+
+	second, err := sc.CommitSchema(ctx, "schema", pubsub.SchemaConfig{Type: pubsub.SchemaAvro, Definition: v2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sc.CommitSchema(ctx, "schema", pubsub.SchemaConfig{Type: pubsub.SchemaProtocolBuffer, Definition: "message A {}"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("changing the type: got %v, want InvalidArgument", err)
+	}
+	var revs []string
+	it := sc.ListSchemaRevisions(ctx, "schema", pubsub.SchemaViewBasic)
+	for {
+		cfg, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Definition != "" {
+			t.Errorf("basic view has a definition")
+		}
+		revs = append(revs, cfg.RevisionID)
+	}
+	if want := []string{second.RevisionID, first.RevisionID}; !reflect.DeepEqual(revs, want) {
+		t.Errorf("got revisions %v, want %v", revs, want)
+	}
+
+	// The topic only accepts the first revision.
+	topic, err := client.CreateTopicWithConfig(ctx, "topic", &pubsub.TopicConfig{
+		SchemaSettings: &pubsub.SchemaSettings{
+			Schema:         first.Name,
+			Encoding:       pubsub.EncodingJSON,
+			LastRevisionID: first.RevisionID,
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sub, err := client.CreateSubscription(ctx, "sub", psiface.SubscriptionConfig{Topic: topic})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := topic.Publish(ctx, newMessage(`{"a": 1, "b": "x"}`, nil)).Get(ctx); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("got %v, want InvalidArgument", err)
+	}
+	if _, err := topic.Publish(ctx, newMessage(`{"a": 1}`, map[string]string{"k": "v"})).Get(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Then every revision.
+	_, err = topic.Update(ctx, pubsub.TopicConfigToUpdate{
+		SchemaSettings: &pubsub.SchemaSettings{Schema: first.Name, Encoding: pubsub.EncodingJSON},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := topic.Publish(ctx, newMessage(`{"a": 1, "b": "x"}`, nil)).Get(ctx); err != nil {
+		t.Fatal(err)
+	}
+	msgs := receiveN(t, sub, 2)
+	for i, wantRev := range []string{first.RevisionID, second.RevisionID} {
+		want := map[string]string{
+			"googclient_schemaname":       first.Name,
+			"googclient_schemaencoding":   "JSON",
+			"googclient_schemarevisionid": wantRev,
+		}
+		if i == 0 {
+			want["k"] = "v"
+		}
+		if got := msgs[i].Attributes(); !reflect.DeepEqual(got, want) {
+			t.Errorf("message %d: got attributes %v, want %v", i, got, want)
+		}
+	}
+
+	if _, err := sc.DeleteSchemaRevision(ctx, "schema", first.RevisionID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sc.DeleteSchemaRevision(ctx, "schema", second.RevisionID); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("deleting the last revision: got %v, want FailedPrecondition", err)
+	}
+	third, err := sc.RollbackSchema(ctx, "schema", second.RevisionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third.Definition != v2 || third.RevisionID == second.RevisionID {
+		t.Errorf("rollback: got %+v", third)
+	}
+
+	if err := sc.DeleteSchema(ctx, "schema"); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := topic.Config(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.SchemaSettings.Schema != "_deleted-schema_" {
+		t.Errorf("got schema %q after deletion", cfg.SchemaSettings.Schema)
+	}
+	if _, err := topic.Publish(ctx, newMessage(`{"a": 1}`, nil)).Get(ctx); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("got %v, want FailedPrecondition", err)
+	}
+	if _, err := sc.Schema(ctx, "schema", pubsub.SchemaViewFull); status.Code(err) != codes.NotFound {
+		t.Errorf("got %v, want NotFound", err)
+	}
+}
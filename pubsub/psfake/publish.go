@@ -0,0 +1,294 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package psfake
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/pubsub/apiv1/pubsubpb"
+	"github.com/googleapis/google-cloud-go-testing/pubsub/psiface"
+	"google.golang.org/api/support/bundler"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+// pendingMessage is a message waiting in a batch.
+type pendingMessage struct {
+	data        []byte
+	attributes  map[string]string
+	orderingKey string
+	size        int
+	result      *publishResult
+}
+
+// batch is the messages published with a topic handle that are waiting to be
+// sent to the Broker together.
+type batch struct {
+	msgs []*pendingMessage
+	size int
+	stop func() // cancels publishing the batch after DelayThreshold
+}
+
+// defaultPublishSettings are the PublishSettings of new topic handles: those
+// of the pubsub package, except that each message is published at once.
+var defaultPublishSettings = func() pubsub.PublishSettings {
+	s := pubsub.DefaultPublishSettings
+	s.CountThreshold = 1
+	return s
+}()
+
+// publishSettings are the effective pubsub.PublishSettings of a topic handle.
+type publishSettings struct {
+	delay         time.Duration
+	count         int
+	bytes         int
+	bufferedBytes int
+	maxMessages   int // of flow control, or 0 for no limit
+	maxBytes      int // of flow control, or 0 for no limit
+	behavior      pubsub.LimitExceededBehavior
+}
+
+// settingsLocked returns the PublishSettings of t, with the defaults of the
+// pubsub package in place of zero values. t.mu must be held.
+func (t *topic) settingsLocked() publishSettings {
+	ps := t.settings
+	def := pubsub.DefaultPublishSettings
+	s := publishSettings{
+		delay:         ps.DelayThreshold,
+		count:         ps.CountThreshold,
+		bytes:         ps.ByteThreshold,
+		bufferedBytes: ps.BufferedByteLimit,
+		maxMessages:   ps.FlowControlSettings.MaxOutstandingMessages,
+		maxBytes:      ps.FlowControlSettings.MaxOutstandingBytes,
+		behavior:      ps.FlowControlSettings.LimitExceededBehavior,
+	}
+	if s.delay <= 0 {
+		s.delay = def.DelayThreshold
+	}
+	if s.count <= 0 {
+		s.count = def.CountThreshold
+	}
+	if s.count > pubsub.MaxPublishRequestCount {
+		s.count = pubsub.MaxPublishRequestCount
+	}
+	if s.bytes <= 0 {
+		s.bytes = def.ByteThreshold
+	}
+	if s.bufferedBytes <= 0 {
+		s.bufferedBytes = def.BufferedByteLimit
+	}
+	if s.maxMessages <= 0 {
+		s.maxMessages = def.FlowControlSettings.MaxOutstandingMessages
+	}
+	if s.maxBytes > 0 {
+		// As with the pubsub package, flow control supersedes the
+		// BufferedByteLimit.
+		s.bufferedBytes = math.MaxInt
+	} else {
+		s.maxBytes = 0
+	}
+	return s
+}
+
+// maxBatchBytes returns the maximum size of the messages of a publish
+// request to t, which is also the maximum size of a message.
+func (t *topic) maxBatchBytes() int {
+	// The request also holds the topic name, and the tags and lengths of the
+	// messages field.
+	return pubsub.MaxPublishRequestBytes - 1 - protowire.SizeBytes(len(t.name)) - 5
+}
+
+// PublishSettings returns the settings of Publish for this handle. Those of a
+// new handle are pubsub.DefaultPublishSettings with a CountThreshold of 1, so
+// that each message is published at once.
+func (t *topic) PublishSettings() pubsub.PublishSettings {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.settings
+}
+
+// SetPublishSettings sets the settings of later calls to Publish on this
+// handle, as the PublishSettings field of a pubsub.Topic does. Zero values
+// mean the values of pubsub.DefaultPublishSettings.
+func (t *topic) SetPublishSettings(settings pubsub.PublishSettings) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.settings = settings
+}
+
+// Publish adds the data, attributes and ordering key of msg to the batch of
+// messages waiting to be published with this handle. As with the pubsub
+// package, the batch is published, and the results of its messages become
+// ready, when it has CountThreshold messages or ByteThreshold bytes, when
+// the Broker's clock passes DelayThreshold after its first message was
+// added, or when Flush or Stop is called. Since the CountThreshold of a new
+// handle is 1, messages are published at once until SetPublishSettings sets
+// a larger one. A batch that fails to publish, for example because the topic
+// does not exist, fails for all its messages.
+//
+// Publish fails with pubsub.ErrOversizedMessage for a message larger than a
+// publish request allows (about 10MB), and with bundler.ErrOverflow when
+// the unpublished messages would exceed BufferedByteLimit. If
+// FlowControlSettings has LimitExceededBehavior FlowControlBlock or
+// FlowControlSignalError, Publish blocks or fails while the handle has
+// MaxOutstandingMessages or MaxOutstandingBytes of unpublished messages; a
+// message larger than MaxOutstandingBytes is accepted when there are none.
+//
+// As with the pubsub package, messages with an ordering key can only be
+// published after SetEnableMessageOrdering(true), and a failure to publish a
+// message pauses publishing for its ordering key: later messages with the key
+// fail with pubsub.ErrPublishingPaused until ResumePublish is called.
+func (t *topic) Publish(ctx context.Context, msg psiface.Message) psiface.PublishResult {
+	key := msg.OrderingKey()
+	m := &pendingMessage{
+		data:        msg.Data(),
+		attributes:  msg.Attributes(),
+		orderingKey: key,
+		result:      &publishResult{b: t.c.b, ready: make(chan struct{})},
+	}
+	m.size = proto.Size(&pubsubpb.PubsubMessage{Data: m.data, Attributes: m.attributes, OrderingKey: key})
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for {
+		if t.stopped {
+			return newPublishResult("", pubsub.ErrTopicStopped)
+		}
+		if key != "" {
+			if !t.ordering {
+				return newPublishResult("", errOrderingNotEnabled)
+			}
+			if t.paused[key] {
+				return newPublishResult("", pubsub.ErrPublishingPaused{OrderingKey: key})
+			}
+		}
+		if m.size > t.maxBatchBytes() {
+			return newPublishResult("", pubsub.ErrOversizedMessage)
+		}
+		s := t.settingsLocked()
+		err := t.checkFlowControlLocked(s, m.size)
+		if err == nil {
+			break
+		}
+		if s.behavior != pubsub.FlowControlBlock {
+			return newPublishResult("", err)
+		}
+		flushed := t.flushed
+		t.mu.Unlock()
+		select {
+		case <-flushed:
+		case <-ctx.Done():
+			t.mu.Lock()
+			return newPublishResult("", ctx.Err())
+		}
+		t.mu.Lock()
+	}
+
+	s := t.settingsLocked()
+	if t.batch != nil && t.batch.size+m.size > t.maxBatchBytes() {
+		t.flushLocked()
+	}
+	if t.batch == nil {
+		t.batch = &batch{}
+	}
+	bt := t.batch
+	bt.msgs = append(bt.msgs, m)
+	bt.size += m.size
+	t.unpublished++
+	t.unpublishedBytes += m.size
+	switch {
+	case len(bt.msgs) >= s.count || bt.size >= s.bytes:
+		t.flushLocked()
+	case len(bt.msgs) == 1:
+		bt.stop = t.c.b.afterFunc(s.delay, func() { t.flushBatch(bt) })
+	}
+	return m.result
+}
+
+// checkFlowControlLocked returns the error for a message of the given size
+// that cannot be accepted while the messages of t are unpublished. t.mu must
+// be held.
+func (t *topic) checkFlowControlLocked(s publishSettings, size int) error {
+	n, buffered := t.unpublished, t.unpublishedBytes
+	if buffered+size > s.bufferedBytes {
+		return bundler.ErrOverflow
+	}
+	if s.behavior == pubsub.FlowControlIgnore {
+		return nil
+	}
+	if n+1 > s.maxMessages {
+		return pubsub.ErrFlowControllerMaxOutstandingMessages
+	}
+	if s.maxBytes > 0 && n > 0 && buffered+size > s.maxBytes {
+		return pubsub.ErrFlowControllerMaxOutstandingBytes
+	}
+	return nil
+}
+
+// flushBatch publishes the batch, unless it was published before.
+func (t *topic) flushBatch(bt *batch) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.batch == bt {
+		t.flushLocked()
+	}
+}
+
+// flushLocked publishes the batch, if any, and makes the results of its
+// messages ready. t.mu must be held.
+func (t *topic) flushLocked() {
+	bt := t.batch
+	if bt == nil {
+		return
+	}
+	t.batch = nil
+	if bt.stop != nil {
+		bt.stop()
+	}
+	ids, err := t.c.b.publish(t.name, bt.msgs)
+	t.unpublished -= len(bt.msgs)
+	t.unpublishedBytes -= bt.size
+	for i, m := range bt.msgs {
+		if err != nil {
+			if m.orderingKey != "" {
+				t.paused[m.orderingKey] = true
+			}
+			m.result.set("", err)
+			continue
+		}
+		m.result.set(ids[i], nil)
+	}
+	close(t.flushed)
+	t.flushed = make(chan struct{})
+}
+
+// Flush publishes the messages waiting to be published with this handle.
+func (t *topic) Flush() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.flushLocked()
+}
+
+// Stop publishes the messages waiting to be published with this handle, and
+// makes later calls to Publish fail with pubsub.ErrTopicStopped.
+func (t *topic) Stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.flushLocked()
+	t.stopped = true
+}
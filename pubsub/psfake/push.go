@@ -0,0 +1,267 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package psfake
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/googleapis/google-cloud-go-testing/pubsub/psiface"
+)
+
+// A TokenSigner returns a token, such as an OIDC ID token, that asserts the
+// identity of the service account to the audience, issued at the given time
+// of the Broker's clock. The Broker sends it in the Authorization header of
+// push requests for subscriptions whose PushConfig has an OIDCToken
+// authentication method.
+type TokenSigner func(audience, serviceAccountEmail string, issuedAt time.Time) (string, error)
+
+// WithTokenSigner returns an Option that sets the TokenSigner for push
+// requests. Without one, push requests are not authenticated.
+func WithTokenSigner(s TokenSigner) Option {
+	return func(b *Broker) {
+		b.signer = s
+	}
+}
+
+// HMACTokenSigner returns a TokenSigner that issues JWTs shaped like the ID
+// tokens of Google service accounts, valid for an hour from their issue time,
+// but signed with HS256 and the given key, so that test handlers can verify
+// them.
+func HMACTokenSigner(key []byte) TokenSigner {
+	return func(audience, email string, now time.Time) (string, error) {
+		header, err := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT"})
+		if err != nil {
+			return "", err
+		}
+		claims, err := json.Marshal(map[string]interface{}{
+			"iss":            "https://accounts.google.com",
+			"aud":            audience,
+			"sub":            email,
+			"email":          email,
+			"email_verified": true,
+			"iat":            now.Unix(),
+			"exp":            now.Add(time.Hour).Unix(),
+		})
+		if err != nil {
+			return "", err
+		}
+		enc := base64.RawURLEncoding
+		s := enc.EncodeToString(header) + "." + enc.EncodeToString(claims)
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(s))
+		return s + "." + enc.EncodeToString(mac.Sum(nil)), nil
+	}
+}
+
+// PushRequest is the JSON body of a push request.
+type PushRequest struct {
+	Message         PushMessage `json:"message"`
+	Subscription    string      `json:"subscription"` // full name
+	DeliveryAttempt int         `json:"deliveryAttempt,omitempty"`
+}
+
+// PushMessage is the message in a PushRequest.
+type PushMessage struct {
+	Data        []byte            `json:"data,omitempty"` // base64-encoded
+	Attributes  map[string]string `json:"attributes,omitempty"`
+	MessageID   string            `json:"messageId"`
+	PublishTime time.Time         `json:"publishTime"`
+	OrderingKey string            `json:"orderingKey,omitempty"`
+}
+
+// MarshalJSON encodes m. Like the service, it writes the ID and publish time
+// in snake case too.
+func (m PushMessage) MarshalJSON() ([]byte, error) {
+	type plain PushMessage
+	return json.Marshal(struct {
+		plain
+		MessageID   string    `json:"message_id"`
+		PublishTime time.Time `json:"publish_time"`
+	}{plain(m), m.MessageID, m.PublishTime})
+}
+
+const (
+	// Push backoff without a RetryPolicy.
+	minPushBackoff = 100 * time.Millisecond
+	maxPushBackoff = 60 * time.Second
+
+	// Backoff with a RetryPolicy that does not set a bound.
+	defaultMinRetryBackoff = 10 * time.Second
+	defaultMaxRetryBackoff = 600 * time.Second
+)
+
+// Close stops pushing messages to the endpoints of push subscriptions, and
+// waits for requests in progress to finish. It always returns nil.
+func (b *Broker) Close() error {
+	b.mu.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.done)
+	}
+	b.mu.Unlock()
+	b.pushers.Wait()
+	return nil
+}
+
+// startPusherLocked starts pushing the messages of the push subscription, if
+// that is not already happening. b.mu must be held.
+func (b *Broker) startPusherLocked(s *subscriptionState) {
+	if b.closed || s.pushing {
+		return
+	}
+	s.pushing = true
+	b.pushers.Add(1)
+	go b.pushLoop(s.name)
+}
+
+// pushLoop pushes the messages of the subscription, one at a time, until it
+// is deleted or is no longer a push subscription, or the Broker is closed.
+func (b *Broker) pushLoop(sub string) {
+	defer b.pushers.Done()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-b.done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for ctx.Err() == nil {
+		d, wait, err := b.next(sub, true, 0)
+		if err != nil {
+			return
+		}
+		if d == nil {
+			select {
+			case <-ctx.Done():
+			case <-wait:
+			case <-ticker.C:
+			}
+			continue
+		}
+		cfg, ok := b.subscriptionConfig(sub)
+		if !ok {
+			return
+		}
+		switch err := b.pushOnce(ctx, sub, cfg, d); {
+		case err == nil:
+			b.ack(sub, d.ackID)
+		case ctx.Err() != nil:
+			b.nack(sub, d.ackID)
+		default:
+			b.nackWithDelay(sub, d.ackID, pushBackoff(cfg.RetryPolicy, d.attempts))
+		}
+	}
+}
+
+// subscriptionConfig returns the configuration of the subscription.
+func (b *Broker) subscriptionConfig(sub string) (psiface.SubscriptionConfig, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.reapLocked()
+	s := b.subs[sub]
+	if s == nil {
+		return psiface.SubscriptionConfig{}, false
+	}
+	return s.cfg, true
+}
+
+// pushOnce sends a push request for d to the endpoint of the subscription. It
+// returns an error if the endpoint does not acknowledge the message.
+func (b *Broker) pushOnce(ctx context.Context, sub string, cfg psiface.SubscriptionConfig, d *delivery) error {
+	m := d.msg
+	body, err := json.Marshal(PushRequest{
+		Message: PushMessage{
+			Data:        m.data,
+			Attributes:  m.attributes,
+			MessageID:   m.id,
+			PublishTime: m.publishTime,
+			OrderingKey: m.orderingKey,
+		},
+		Subscription:    sub,
+		DeliveryAttempt: d.attempts,
+	})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, cfg.AckDeadline)
+	defer cancel()
+	endpoint := cfg.PushConfig.Endpoint
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	if oidc, ok := cfg.PushConfig.AuthenticationMethod.(*pubsub.OIDCToken); ok && b.signer != nil {
+		audience := oidc.Audience
+		if audience == "" {
+			audience = endpoint
+		}
+		token, err := b.signer(audience, oidc.ServiceAccountEmail, b.now())
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusProcessing || resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+	return fmt.Errorf("push endpoint returned %s", resp.Status)
+}
+
+// pushBackoff returns the delay before pushing a message again after the
+// given number of failed attempts: exponential, between the bounds of the
+// retry policy if there is one.
+func pushBackoff(p *pubsub.RetryPolicy, attempts int) time.Duration {
+	lo, hi := minPushBackoff, maxPushBackoff
+	if p != nil {
+		lo, hi = defaultMinRetryBackoff, defaultMaxRetryBackoff
+		if d, ok := p.MinimumBackoff.(time.Duration); ok {
+			lo = d
+		}
+		if d, ok := p.MaximumBackoff.(time.Duration); ok {
+			hi = d
+		}
+	}
+	d := lo
+	for i := 1; i < attempts && d < hi; i++ {
+		d *= 2
+	}
+	if d > hi {
+		d = hi
+	}
+	return d
+}
@@ -0,0 +1,133 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package psfake
+
+import (
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/googleapis/google-cloud-go-testing/pubsub/psiface"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// defaultExpirationPolicy is how long a subscription may be inactive
+	// before it is deleted, if its ExpirationPolicy is not set.
+	defaultExpirationPolicy = 31 * 24 * time.Hour
+	// minExpirationPolicy is the shortest expiration policy of a
+	// subscription.
+	minExpirationPolicy = 24 * time.Hour
+
+	minTopicRetention = 10 * time.Minute
+	maxTopicRetention = 31 * 24 * time.Hour
+)
+
+// topicRetention returns the message retention duration of a topic, or zero
+// if it retains no messages.
+func topicRetention(cfg pubsub.TopicConfig) time.Duration {
+	d, _ := cfg.RetentionDuration.(time.Duration)
+	return d
+}
+
+// checkTopicRetention reports an error if the retention duration of cfg is
+// invalid.
+func checkTopicRetention(cfg pubsub.TopicConfig) error {
+	if cfg.RetentionDuration == nil {
+		return nil
+	}
+	d, ok := cfg.RetentionDuration.(time.Duration)
+	if !ok || d < minTopicRetention || d > maxTopicRetention {
+		return status.Errorf(codes.InvalidArgument, "The message retention duration of a topic must be between %v and %v", minTopicRetention, maxTopicRetention)
+	}
+	return nil
+}
+
+// pruneTopicLocked drops the messages retained by t that are older than its
+// retention duration. b.mu must be held.
+func (b *Broker) pruneTopicLocked(t *topicState) {
+	d := topicRetention(t.cfg)
+	if d == 0 {
+		t.retained = nil
+		return
+	}
+	cutoff := b.now().Add(-d)
+	i := 0
+	for i < len(t.retained) && t.retained[i].publishTime.Before(cutoff) {
+		i++
+	}
+	t.retained = t.retained[i:]
+}
+
+// retentionLocked returns how long the subscription retains messages: its
+// RetentionDuration, or the retention duration of its topic if that is
+// longer. b.mu must be held.
+func (b *Broker) retentionLocked(s *subscriptionState) time.Duration {
+	d := s.cfg.RetentionDuration
+	if t := b.topics[s.topic]; t != nil && topicRetention(t.cfg) > d {
+		d = topicRetention(t.cfg)
+	}
+	return d
+}
+
+// checkExpirationPolicy validates the expiration policy of cfg, setting the
+// default if it is not set.
+func checkExpirationPolicy(cfg *psiface.SubscriptionConfig) error {
+	if cfg.ExpirationPolicy == nil {
+		cfg.ExpirationPolicy = defaultExpirationPolicy
+		return nil
+	}
+	d, ok := cfg.ExpirationPolicy.(time.Duration)
+	if !ok || d != 0 && d < minExpirationPolicy {
+		return status.Errorf(codes.InvalidArgument, "invalid expiration policy %v", cfg.ExpirationPolicy)
+	}
+	return nil
+}
+
+// connect records that a receiver is connected to the subscription, which
+// keeps it from expiring, until the returned function is called.
+func (b *Broker) connect(sub string) (disconnect func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.subs[sub]
+	if s == nil {
+		return func() {}
+	}
+	s.connected++
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		s.connected--
+		s.lastActive = b.now()
+	}
+}
+
+// reapLocked deletes the subscriptions that have been inactive for longer
+// than their expiration policies. A subscription is active while receivers
+// are connected to it, and when messages are pulled or acked. b.mu must be
+// held.
+func (b *Broker) reapLocked() {
+	now := b.now()
+	for _, s := range b.subs {
+		ttl, _ := s.cfg.ExpirationPolicy.(time.Duration)
+		if s.connected > 0 {
+			s.lastActive = now
+			continue
+		}
+		if ttl > 0 && !now.Before(s.lastActive.Add(ttl)) {
+			b.deleteSubscriptionLocked(s)
+		}
+	}
+}
@@ -0,0 +1,518 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package psfake
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/googleapis/google-cloud-go-testing/pubsub/psiface"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+// deletedSchema is the schema of topics whose schema was deleted.
+const deletedSchema = "_deleted-schema_"
+
+// The attributes the service adds to messages validated against a schema.
+const (
+	schemaNameAttr     = "googclient_schemaname"
+	schemaEncodingAttr = "googclient_schemaencoding"
+	schemaRevisionAttr = "googclient_schemarevisionid"
+)
+
+type schemaState struct {
+	name      string
+	revisions []*schemaRevision // oldest first
+}
+
+type schemaRevision struct {
+	cfg      pubsub.SchemaConfig
+	validate func(data []byte, enc pubsub.SchemaEncoding) error
+}
+
+// compileSchema parses the definition of cfg, returning a function that
+// validates messages against it.
+func compileSchema(cfg pubsub.SchemaConfig) (func([]byte, pubsub.SchemaEncoding) error, error) {
+	var (
+		binary, json func([]byte) error
+	)
+	switch cfg.Type {
+	case pubsub.SchemaAvro:
+		t, err := parseAvroSchema(cfg.Definition)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "Invalid schema definition: %v", err)
+		}
+		binary = func(data []byte) error { return validateAvroBinary(t, data) }
+		json = func(data []byte) error { return validateAvroJSON(t, data) }
+	case pubsub.SchemaProtocolBuffer:
+		md, err := parseProtoSchema(cfg.Definition)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "Invalid schema definition: %v", err)
+		}
+		binary = func(data []byte) error { return proto.Unmarshal(data, dynamicpb.NewMessage(md)) }
+		json = func(data []byte) error { return protojson.Unmarshal(data, dynamicpb.NewMessage(md)) }
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "The schema type must be AVRO or PROTOCOL_BUFFER.")
+	}
+	return func(data []byte, enc pubsub.SchemaEncoding) error {
+		var err error
+		switch enc {
+		case pubsub.EncodingBinary:
+			err = binary(data)
+		case pubsub.EncodingJSON:
+			err = json(data)
+		default:
+			return status.Errorf(codes.InvalidArgument, "The encoding must be JSON or BINARY.")
+		}
+		if err != nil {
+			return status.Errorf(codes.InvalidArgument, "Invalid data in message: Message failed schema validation: %v", err)
+		}
+		return nil
+	}, nil
+}
+
+// splitRevision splits a schema name of the form name@revision.
+func splitRevision(name string) (schema, revision string) {
+	if i := strings.LastIndex(name, "@"); i >= 0 {
+		return name[:i], name[i+1:]
+	}
+	return name, ""
+}
+
+func (b *Broker) schemaLocked(name string) (*schemaState, error) {
+	s := b.schemas[name]
+	if s == nil {
+		return nil, status.Errorf(codes.NotFound, "Resource not found (resource=%s).", resourceID(name))
+	}
+	return s, nil
+}
+
+// revision returns the index of the revision of s with the given ID, or of
+// the latest if id is empty.
+func (s *schemaState) revision(id string) (int, error) {
+	if id == "" {
+		return len(s.revisions) - 1, nil
+	}
+	for i, r := range s.revisions {
+		if r.cfg.RevisionID == id {
+			return i, nil
+		}
+	}
+	return 0, status.Errorf(codes.NotFound, "Resource not found (resource=%s@%s).", resourceID(s.name), id)
+}
+
+// newRevisionLocked adds a revision with cfg's type and definition to s.
+// b.mu must be held.
+func (b *Broker) newRevisionLocked(s *schemaState, cfg pubsub.SchemaConfig) (pubsub.SchemaConfig, error) {
+	validate, err := compileSchema(cfg)
+	if err != nil {
+		return pubsub.SchemaConfig{}, err
+	}
+	b.lastRevision++
+	r := &schemaRevision{
+		cfg: pubsub.SchemaConfig{
+			Name:               s.name,
+			Type:               cfg.Type,
+			Definition:         cfg.Definition,
+			RevisionID:         fmt.Sprintf("%08x", b.lastRevision),
+			RevisionCreateTime: b.now(),
+		},
+		validate: validate,
+	}
+	s.revisions = append(s.revisions, r)
+	return r.cfg, nil
+}
+
+func (b *Broker) createSchema(name string, cfg pubsub.SchemaConfig) (pubsub.SchemaConfig, error) {
+	if err := checkID(resourceID(name)); err != nil {
+		return pubsub.SchemaConfig{}, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.schemas[name] != nil {
+		return pubsub.SchemaConfig{}, status.Errorf(codes.AlreadyExists, "Schema already exists")
+	}
+	s := &schemaState{name: name}
+	rc, err := b.newRevisionLocked(s, cfg)
+	if err != nil {
+		return pubsub.SchemaConfig{}, err
+	}
+	b.schemas[name] = s
+	return rc, nil
+}
+
+// schemaView returns cfg as seen with view, which omits the definition if it
+// is SchemaViewBasic.
+func schemaView(cfg pubsub.SchemaConfig, view pubsub.SchemaView) pubsub.SchemaConfig {
+	if view == pubsub.SchemaViewBasic {
+		cfg.Definition = ""
+	}
+	return cfg
+}
+
+// schema returns a revision of a schema, whose name may end with @revision.
+func (b *Broker) schema(name string, view pubsub.SchemaView) (pubsub.SchemaConfig, error) {
+	name, rev := splitRevision(name)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s, err := b.schemaLocked(name)
+	if err != nil {
+		return pubsub.SchemaConfig{}, err
+	}
+	i, err := s.revision(rev)
+	if err != nil {
+		return pubsub.SchemaConfig{}, err
+	}
+	return schemaView(s.revisions[i].cfg, view), nil
+}
+
+// listSchemas returns the latest revisions of the schemas of the project,
+// sorted by name.
+func (b *Broker) listSchemas(project string, view pubsub.SchemaView) []pubsub.SchemaConfig {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var cfgs []pubsub.SchemaConfig
+	for name, s := range b.schemas {
+		if p, _, _ := parseName(name, "schemas"); p == project {
+			cfgs = append(cfgs, schemaView(s.revisions[len(s.revisions)-1].cfg, view))
+		}
+	}
+	sort.Slice(cfgs, func(i, j int) bool { return cfgs[i].Name < cfgs[j].Name })
+	return cfgs
+}
+
+// listSchemaRevisions returns the revisions of a schema, newest first.
+func (b *Broker) listSchemaRevisions(name string, view pubsub.SchemaView) ([]pubsub.SchemaConfig, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s, err := b.schemaLocked(name)
+	if err != nil {
+		return nil, err
+	}
+	cfgs := make([]pubsub.SchemaConfig, len(s.revisions))
+	for i, r := range s.revisions {
+		cfgs[len(cfgs)-1-i] = schemaView(r.cfg, view)
+	}
+	return cfgs, nil
+}
+
+// commitSchema adds a revision to a schema. Its type cannot change.
+func (b *Broker) commitSchema(name string, cfg pubsub.SchemaConfig) (pubsub.SchemaConfig, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s, err := b.schemaLocked(name)
+	if err != nil {
+		return pubsub.SchemaConfig{}, err
+	}
+	if cfg.Type != s.revisions[0].cfg.Type {
+		return pubsub.SchemaConfig{}, status.Errorf(codes.InvalidArgument, "The type of a schema cannot be changed.")
+	}
+	return b.newRevisionLocked(s, cfg)
+}
+
+// rollbackSchema adds a revision to a schema that is a copy of an earlier
+// one.
+func (b *Broker) rollbackSchema(name, revisionID string) (pubsub.SchemaConfig, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s, err := b.schemaLocked(name)
+	if err != nil {
+		return pubsub.SchemaConfig{}, err
+	}
+	if revisionID == "" {
+		return pubsub.SchemaConfig{}, status.Errorf(codes.InvalidArgument, "The revision ID must be set.")
+	}
+	i, err := s.revision(revisionID)
+	if err != nil {
+		return pubsub.SchemaConfig{}, err
+	}
+	return b.newRevisionLocked(s, s.revisions[i].cfg)
+}
+
+// deleteSchemaRevision deletes the revision named by name@revision, which
+// must not be the only one, and returns it.
+func (b *Broker) deleteSchemaRevision(name string) (pubsub.SchemaConfig, error) {
+	name, rev := splitRevision(name)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s, err := b.schemaLocked(name)
+	if err != nil {
+		return pubsub.SchemaConfig{}, err
+	}
+	if rev == "" {
+		return pubsub.SchemaConfig{}, status.Errorf(codes.InvalidArgument, "The revision ID must be set.")
+	}
+	i, err := s.revision(rev)
+	if err != nil {
+		return pubsub.SchemaConfig{}, err
+	}
+	if len(s.revisions) == 1 {
+		return pubsub.SchemaConfig{}, status.Errorf(codes.FailedPrecondition, "The only revision of a schema cannot be deleted.")
+	}
+	cfg := s.revisions[i].cfg
+	s.revisions = append(s.revisions[:i], s.revisions[i+1:]...)
+	return cfg, nil
+}
+
+// deleteSchema deletes a schema. Topics that use it remain, but publishing
+// to them fails.
+func (b *Broker) deleteSchema(name string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, err := b.schemaLocked(name); err != nil {
+		return err
+	}
+	delete(b.schemas, name)
+	for _, t := range b.topics {
+		if ss := t.cfg.SchemaSettings; ss != nil && ss.Schema == name {
+			ss.Schema = deletedSchema
+		}
+	}
+	return nil
+}
+
+// checkSchemaSettingsLocked reports an error if ss does not name an existing
+// schema and a valid range of its revisions. b.mu must be held.
+func (b *Broker) checkSchemaSettingsLocked(ss *pubsub.SchemaSettings) error {
+	if ss == nil {
+		return nil
+	}
+	s, err := b.schemaLocked(ss.Schema)
+	if err != nil {
+		return err
+	}
+	if ss.Encoding != pubsub.EncodingJSON && ss.Encoding != pubsub.EncodingBinary {
+		return status.Errorf(codes.InvalidArgument, "The schema encoding must be JSON or BINARY.")
+	}
+	first, err := s.revision(ss.FirstRevisionID)
+	if err != nil {
+		return err
+	}
+	if ss.FirstRevisionID == "" {
+		first = 0
+	}
+	last, err := s.revision(ss.LastRevisionID)
+	if err != nil {
+		return err
+	}
+	if first > last {
+		return status.Errorf(codes.InvalidArgument, "The first revision must not be newer than the last revision.")
+	}
+	return nil
+}
+
+// validateLocked validates the data of a message published to t against the
+// topic's schema, if it has one, and returns the attributes to add to the
+// message. The message is valid if it conforms to any revision in the range
+// of the schema settings. b.mu must be held.
+func (b *Broker) validateLocked(t *topicState, data []byte) (map[string]string, error) {
+	ss := t.cfg.SchemaSettings
+	if ss == nil {
+		return nil, nil
+	}
+	s := b.schemas[ss.Schema]
+	if s == nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "The schema of the topic has been deleted.")
+	}
+	first, last := 0, len(s.revisions)-1
+	if i, err := s.revision(ss.FirstRevisionID); err == nil && ss.FirstRevisionID != "" {
+		first = i
+	}
+	if i, err := s.revision(ss.LastRevisionID); err == nil {
+		last = i
+	}
+	var firstErr error
+	for i := last; i >= first; i-- {
+		r := s.revisions[i]
+		err := r.validate(data, ss.Encoding)
+		if err == nil {
+			enc := "JSON"
+			if ss.Encoding == pubsub.EncodingBinary {
+				enc = "BINARY"
+			}
+			return map[string]string{
+				schemaNameAttr:     s.name,
+				schemaEncodingAttr: enc,
+				schemaRevisionAttr: r.cfg.RevisionID,
+			}, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return nil, firstErr
+}
+
+// SchemaClient implements psiface.SchemaClient for the schemas of a project
+// in a Broker. Topics of the project's Client can be bound to its schemas
+// with pubsub.SchemaSettings, naming them in full.
+type SchemaClient struct {
+	psiface.SchemaClient
+	b       *Broker
+	project string
+}
+
+// SchemaClient returns a schema client for the project with the given ID.
+func (b *Broker) SchemaClient(projectID string) *SchemaClient {
+	return &SchemaClient{b: b, project: projectID}
+}
+
+func (c *SchemaClient) name(schemaID string) string {
+	return fmt.Sprintf("projects/%s/schemas/%s", c.project, schemaID)
+}
+
+// Close does nothing.
+func (c *SchemaClient) Close() error {
+	return nil
+}
+
+// CreateSchema creates a schema, validating its definition.
+func (c *SchemaClient) CreateSchema(ctx context.Context, schemaID string, s pubsub.SchemaConfig) (*pubsub.SchemaConfig, error) {
+	cfg, err := c.b.createSchema(c.name(schemaID), s)
+	if err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// Schema returns the latest revision of a schema.
+func (c *SchemaClient) Schema(ctx context.Context, schemaID string, view pubsub.SchemaView) (*pubsub.SchemaConfig, error) {
+	cfg, err := c.b.schema(c.name(schemaID), view)
+	if err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// Schemas lists the latest revisions of the project's schemas.
+func (c *SchemaClient) Schemas(ctx context.Context, view pubsub.SchemaView) psiface.SchemaIterator {
+	return &schemaIterator{cfgs: c.b.listSchemas(c.project, view)}
+}
+
+// ListSchemaRevisions lists the revisions of a schema, newest first.
+func (c *SchemaClient) ListSchemaRevisions(ctx context.Context, schemaID string, view pubsub.SchemaView) psiface.SchemaIterator {
+	cfgs, err := c.b.listSchemaRevisions(c.name(schemaID), view)
+	return &schemaIterator{cfgs: cfgs, err: err}
+}
+
+// CommitSchema adds a revision to a schema.
+func (c *SchemaClient) CommitSchema(ctx context.Context, schemaID string, s pubsub.SchemaConfig) (*pubsub.SchemaConfig, error) {
+	cfg, err := c.b.commitSchema(c.name(schemaID), s)
+	if err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// RollbackSchema adds a revision to a schema that is a copy of the given
+// revision.
+func (c *SchemaClient) RollbackSchema(ctx context.Context, schemaID, revisionID string) (*pubsub.SchemaConfig, error) {
+	cfg, err := c.b.rollbackSchema(c.name(schemaID), revisionID)
+	if err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// DeleteSchemaRevision deletes a revision of a schema, and returns it.
+func (c *SchemaClient) DeleteSchemaRevision(ctx context.Context, schemaID, revisionID string) (*pubsub.SchemaConfig, error) {
+	cfg, err := c.b.deleteSchemaRevision(c.name(schemaID) + "@" + revisionID)
+	if err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// DeleteSchema deletes a schema.
+func (c *SchemaClient) DeleteSchema(ctx context.Context, schemaID string) error {
+	return c.b.deleteSchema(c.name(schemaID))
+}
+
+// ValidateSchema reports an error if the definition of schema is invalid.
+func (c *SchemaClient) ValidateSchema(ctx context.Context, schema pubsub.SchemaConfig) (*pubsub.ValidateSchemaResult, error) {
+	if _, err := compileSchema(schema); err != nil {
+		return nil, err
+	}
+	return &pubsub.ValidateSchemaResult{}, nil
+}
+
+// ValidateMessageWithConfig reports an error if msg does not conform to
+// config.
+func (c *SchemaClient) ValidateMessageWithConfig(ctx context.Context, msg []byte, encoding pubsub.SchemaEncoding, config pubsub.SchemaConfig) (*pubsub.ValidateMessageResult, error) {
+	validate, err := compileSchema(config)
+	if err != nil {
+		return nil, err
+	}
+	if err := validate(msg, encoding); err != nil {
+		return nil, err
+	}
+	return &pubsub.ValidateMessageResult{}, nil
+}
+
+// ValidateMessageWithID reports an error if msg does not conform to the
+// latest revision of a schema.
+func (c *SchemaClient) ValidateMessageWithID(ctx context.Context, msg []byte, encoding pubsub.SchemaEncoding, schemaID string) (*pubsub.ValidateMessageResult, error) {
+	return c.b.validateMessage(c.name(schemaID), msg, encoding)
+}
+
+// validateMessage validates msg against a revision of a schema, whose name
+// may end with @revision.
+func (b *Broker) validateMessage(name string, msg []byte, encoding pubsub.SchemaEncoding) (*pubsub.ValidateMessageResult, error) {
+	name, rev := splitRevision(name)
+	b.mu.Lock()
+	s, err := b.schemaLocked(name)
+	var r *schemaRevision
+	if err == nil {
+		var i int
+		if i, err = s.revision(rev); err == nil {
+			r = s.revisions[i]
+		}
+	}
+	b.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.validate(msg, encoding); err != nil {
+		return nil, err
+	}
+	return &pubsub.ValidateMessageResult{}, nil
+}
+
+// schemaIterator implements psiface.SchemaIterator.
+type schemaIterator struct {
+	psiface.SchemaIterator
+	cfgs []pubsub.SchemaConfig
+	err  error
+}
+
+func (it *schemaIterator) Next() (*pubsub.SchemaConfig, error) {
+	if it.err != nil {
+		return nil, it.err
+	}
+	if len(it.cfgs) == 0 {
+		return nil, iterator.Done
+	}
+	cfg := it.cfgs[0]
+	it.cfgs = it.cfgs[1:]
+	return &cfg, nil
+}
@@ -0,0 +1,166 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package psfake
+
+import (
+	"context"
+
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/pubsub/apiv1/pubsubpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// schemaServer implements pubsubpb.SchemaServiceServer.
+type schemaServer struct {
+	pubsubpb.UnimplementedSchemaServiceServer
+	b *Broker
+}
+
+func schemaConfigFromProto(p *pubsubpb.Schema) pubsub.SchemaConfig {
+	return pubsub.SchemaConfig{
+		Name:       p.GetName(),
+		Type:       pubsub.SchemaType(p.GetType()),
+		Definition: p.GetDefinition(),
+	}
+}
+
+func schemaToProto(cfg pubsub.SchemaConfig) *pubsubpb.Schema {
+	return &pubsubpb.Schema{
+		Name:               cfg.Name,
+		Type:               pubsubpb.Schema_Type(cfg.Type),
+		Definition:         cfg.Definition,
+		RevisionId:         cfg.RevisionID,
+		RevisionCreateTime: timestamppb.New(cfg.RevisionCreateTime),
+	}
+}
+
+func (s *schemaServer) CreateSchema(ctx context.Context, req *pubsubpb.CreateSchemaRequest) (*pubsubpb.Schema, error) {
+	name := req.Parent + "/schemas/" + req.SchemaId
+	if err := checkName(name, "schemas"); err != nil {
+		return nil, err
+	}
+	cfg, err := s.b.createSchema(name, schemaConfigFromProto(req.Schema))
+	if err != nil {
+		return nil, err
+	}
+	return schemaToProto(cfg), nil
+}
+
+func (s *schemaServer) GetSchema(ctx context.Context, req *pubsubpb.GetSchemaRequest) (*pubsubpb.Schema, error) {
+	cfg, err := s.b.schema(req.Name, pubsub.SchemaView(req.View))
+	if err != nil {
+		return nil, err
+	}
+	return schemaToProto(cfg), nil
+}
+
+func (s *schemaServer) ListSchemas(ctx context.Context, req *pubsubpb.ListSchemasRequest) (*pubsubpb.ListSchemasResponse, error) {
+	project, err := checkProject(req.Parent)
+	if err != nil {
+		return nil, err
+	}
+	cfgs := s.b.listSchemas(project, pubsub.SchemaView(req.View))
+	names := make([]string, len(cfgs))
+	byName := make(map[string]pubsub.SchemaConfig)
+	for i, cfg := range cfgs {
+		names[i] = cfg.Name
+		byName[cfg.Name] = cfg
+	}
+	names, token := page(names, req.PageSize, req.PageToken)
+	resp := &pubsubpb.ListSchemasResponse{NextPageToken: token}
+	for _, name := range names {
+		resp.Schemas = append(resp.Schemas, schemaToProto(byName[name]))
+	}
+	return resp, nil
+}
+
+// ListSchemaRevisions returns every revision of a schema in one page.
+func (s *schemaServer) ListSchemaRevisions(ctx context.Context, req *pubsubpb.ListSchemaRevisionsRequest) (*pubsubpb.ListSchemaRevisionsResponse, error) {
+	cfgs, err := s.b.listSchemaRevisions(req.Name, pubsub.SchemaView(req.View))
+	if err != nil {
+		return nil, err
+	}
+	resp := &pubsubpb.ListSchemaRevisionsResponse{}
+	for _, cfg := range cfgs {
+		resp.Schemas = append(resp.Schemas, schemaToProto(cfg))
+	}
+	return resp, nil
+}
+
+func (s *schemaServer) CommitSchema(ctx context.Context, req *pubsubpb.CommitSchemaRequest) (*pubsubpb.Schema, error) {
+	cfg, err := s.b.commitSchema(req.Name, schemaConfigFromProto(req.Schema))
+	if err != nil {
+		return nil, err
+	}
+	return schemaToProto(cfg), nil
+}
+
+func (s *schemaServer) RollbackSchema(ctx context.Context, req *pubsubpb.RollbackSchemaRequest) (*pubsubpb.Schema, error) {
+	cfg, err := s.b.rollbackSchema(req.Name, req.RevisionId)
+	if err != nil {
+		return nil, err
+	}
+	return schemaToProto(cfg), nil
+}
+
+func (s *schemaServer) DeleteSchemaRevision(ctx context.Context, req *pubsubpb.DeleteSchemaRevisionRequest) (*pubsubpb.Schema, error) {
+	name := req.Name
+	if _, rev := splitRevision(name); rev == "" && req.RevisionId != "" {
+		name += "@" + req.RevisionId
+	}
+	cfg, err := s.b.deleteSchemaRevision(name)
+	if err != nil {
+		return nil, err
+	}
+	return schemaToProto(cfg), nil
+}
+
+func (s *schemaServer) DeleteSchema(ctx context.Context, req *pubsubpb.DeleteSchemaRequest) (*emptypb.Empty, error) {
+	if err := s.b.deleteSchema(req.Name); err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *schemaServer) ValidateSchema(ctx context.Context, req *pubsubpb.ValidateSchemaRequest) (*pubsubpb.ValidateSchemaResponse, error) {
+	if _, err := compileSchema(schemaConfigFromProto(req.Schema)); err != nil {
+		return nil, err
+	}
+	return &pubsubpb.ValidateSchemaResponse{}, nil
+}
+
+func (s *schemaServer) ValidateMessage(ctx context.Context, req *pubsubpb.ValidateMessageRequest) (*pubsubpb.ValidateMessageResponse, error) {
+	enc := pubsub.SchemaEncoding(req.Encoding)
+	switch spec := req.SchemaSpec.(type) {
+	case *pubsubpb.ValidateMessageRequest_Name:
+		if _, err := s.b.validateMessage(spec.Name, req.Message, enc); err != nil {
+			return nil, err
+		}
+	case *pubsubpb.ValidateMessageRequest_Schema:
+		validate, err := compileSchema(schemaConfigFromProto(spec.Schema))
+		if err != nil {
+			return nil, err
+		}
+		if err := validate(req.Message, enc); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "The schema name or schema must be set.")
+	}
+	return &pubsubpb.ValidateMessageResponse{}, nil
+}
@@ -0,0 +1,256 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package psfake
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultRetentionDuration = 7 * 24 * time.Hour
+	minRetentionDuration     = 10 * time.Minute
+	maxRetentionDuration     = 7 * 24 * time.Hour
+
+	// snapshotLifetime is how long a snapshot lasts after the publication of
+	// the oldest message it retains.
+	snapshotLifetime = 7 * 24 * time.Hour
+)
+
+// snapshotState is a snapshot of a subscription. It retains the messages that
+// were unacked in the subscription when it was created, and the messages
+// published to the topic since.
+type snapshotState struct {
+	name       string
+	topic      string // full name of the topic
+	msgs       []*message
+	expiration time.Time
+}
+
+// pruneLocked drops the messages of s that are older than its retention
+// duration, or that of its topic if longer, except those being processed by a
+// receiver. b.mu must be held.
+func (b *Broker) pruneLocked(s *subscriptionState) {
+	cutoff := b.now().Add(-b.retentionLocked(s))
+	queue := s.queue[:0]
+	for _, d := range s.queue {
+		if !d.msg.publishTime.Before(cutoff) {
+			queue = append(queue, d)
+		}
+	}
+	s.queue = queue
+	acked := s.acked[:0]
+	for _, m := range s.acked {
+		if !m.publishTime.Before(cutoff) {
+			acked = append(acked, m)
+		}
+	}
+	s.acked = acked
+	for ackID, d := range s.outstanding {
+		if !d.leased && d.msg.publishTime.Before(cutoff) {
+			delete(s.outstanding, ackID)
+			delete(s.busyKeys, d.msg.orderingKey)
+		}
+	}
+}
+
+// resetLocked marks the messages retained by s and the extra messages as
+// unacked if unacked returns true for them, and as acked otherwise. Messages
+// that are being processed by receivers can no longer be acked. b.mu must be
+// held.
+func (b *Broker) resetLocked(s *subscriptionState, extra []*message, unacked func(*message) bool) {
+	attempts := make(map[*message]int)
+	for _, d := range s.queue {
+		attempts[d.msg] = d.attempts
+	}
+	for _, d := range s.outstanding {
+		attempts[d.msg] = d.attempts
+	}
+	all := make([]*message, 0, len(attempts)+len(s.acked)+len(extra))
+	for m := range attempts {
+		all = append(all, m)
+	}
+	all = append(all, s.acked...)
+	for _, m := range extra {
+		if s.filter == nil || s.filter.matches(m.attributes) {
+			all = append(all, m)
+		}
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].seq < all[j].seq })
+
+	s.queue, s.acked = nil, nil
+	s.outstanding = make(map[string]*delivery)
+	s.busyKeys = make(map[string]bool)
+	for i, m := range all {
+		if i > 0 && m == all[i-1] {
+			continue
+		}
+		if unacked(m) {
+			s.queue = append(s.queue, &delivery{msg: m, attempts: attempts[m]})
+		} else if s.cfg.RetainAckedMessages {
+			s.acked = append(s.acked, m)
+		}
+	}
+	b.pruneLocked(s)
+	b.notifyLocked()
+}
+
+// subscriptionLocked returns the subscription with the given name, after
+// deleting the subscriptions that have expired. b.mu must be held.
+func (b *Broker) subscriptionLocked(name string) (*subscriptionState, error) {
+	b.reapLocked()
+	s := b.subs[name]
+	if s == nil {
+		return nil, status.Errorf(codes.NotFound, "Resource not found (resource=%s).", resourceID(name))
+	}
+	return s, nil
+}
+
+// seekToTime marks the messages retained by the subscription or its topic
+// that were published before t as acked, and the others as unacked.
+func (b *Broker) seekToTime(sub string, t time.Time) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s, err := b.subscriptionLocked(sub)
+	if err != nil {
+		return err
+	}
+	var retained []*message
+	if topic := b.topics[s.topic]; topic != nil {
+		b.pruneTopicLocked(topic)
+		retained = topic.retained
+	}
+	b.resetLocked(s, retained, func(m *message) bool { return !m.publishTime.Before(t) })
+	return nil
+}
+
+// snapshotLocked returns the snapshot with the given name, deleting it if it
+// has expired. b.mu must be held.
+func (b *Broker) snapshotLocked(name string) (*snapshotState, error) {
+	sn := b.snapshots[name]
+	if sn != nil && !b.now().Before(sn.expiration) {
+		b.deleteSnapshotLocked(sn)
+		sn = nil
+	}
+	if sn == nil {
+		return nil, status.Errorf(codes.NotFound, "Resource not found (resource=%s).", resourceID(name))
+	}
+	return sn, nil
+}
+
+func (b *Broker) deleteSnapshotLocked(sn *snapshotState) {
+	delete(b.snapshots, sn.name)
+	if t := b.topics[sn.topic]; t != nil {
+		delete(t.snapshots, sn.name)
+	}
+}
+
+// createSnapshot creates a snapshot of the subscription. If name is the
+// collection of snapshots, such as "projects/p/snapshots/", a unique name is
+// assigned.
+func (b *Broker) createSnapshot(name, sub string) (snapshotState, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s, err := b.subscriptionLocked(sub)
+	if err != nil {
+		return snapshotState{}, err
+	}
+	if resourceID(name) == "" {
+		b.lastSnap++
+		name = fmt.Sprintf("%ssnapshot-%d", name, b.lastSnap)
+	} else if err := checkID(resourceID(name)); err != nil {
+		return snapshotState{}, err
+	}
+	if _, err := b.snapshotLocked(name); err == nil {
+		return snapshotState{}, status.Errorf(codes.AlreadyExists, "Snapshot already exists")
+	}
+	t := b.topics[s.topic]
+	if t == nil {
+		return snapshotState{}, status.Errorf(codes.FailedPrecondition, "The subscription's topic has been deleted")
+	}
+	b.pruneLocked(s)
+	sn := &snapshotState{name: name, topic: s.topic}
+	for _, d := range s.queue {
+		sn.msgs = append(sn.msgs, d.msg)
+	}
+	for _, d := range s.outstanding {
+		sn.msgs = append(sn.msgs, d.msg)
+	}
+	sort.Slice(sn.msgs, func(i, j int) bool { return sn.msgs[i].seq < sn.msgs[j].seq })
+	oldest := b.now()
+	if len(sn.msgs) > 0 {
+		oldest = sn.msgs[0].publishTime
+	}
+	sn.expiration = oldest.Add(snapshotLifetime)
+	b.snapshots[name] = sn
+	t.snapshots[name] = sn
+	return *sn, nil
+}
+
+// seekToSnapshot marks the messages retained by the snapshot as unacked in
+// the subscription, and all others as acked.
+func (b *Broker) seekToSnapshot(sub, snap string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s, err := b.subscriptionLocked(sub)
+	if err != nil {
+		return err
+	}
+	sn, err := b.snapshotLocked(snap)
+	if err != nil {
+		return err
+	}
+	if sn.topic != s.topic {
+		return status.Errorf(codes.FailedPrecondition, "The snapshot's topic %s is not the subscription's topic %s", sn.topic, s.topic)
+	}
+	inSnapshot := make(map[*message]bool, len(sn.msgs))
+	for _, m := range sn.msgs {
+		inSnapshot[m] = true
+	}
+	b.resetLocked(s, sn.msgs, func(m *message) bool { return inSnapshot[m] })
+	return nil
+}
+
+func (b *Broker) deleteSnapshot(name string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	sn, err := b.snapshotLocked(name)
+	if err != nil {
+		return err
+	}
+	b.deleteSnapshotLocked(sn)
+	return nil
+}
+
+// listSnapshots returns the snapshots of the project, ordered by name.
+func (b *Broker) listSnapshots(project string) []snapshotState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var snaps []snapshotState
+	for name := range b.snapshots {
+		if p, _, _ := parseName(name, "snapshots"); p != project {
+			continue
+		}
+		if sn, err := b.snapshotLocked(name); err == nil {
+			snaps = append(snaps, *sn)
+		}
+	}
+	sort.Slice(snaps, func(i, j int) bool { return snaps[i].name < snaps[j].name })
+	return snaps
+}
@@ -0,0 +1,289 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package psfake
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/iam/apiv1/iampb"
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/pubsub/apiv1/pubsubpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// RegisterServer registers the Publisher, Subscriber, SchemaService and
+// IAMPolicy gRPC services of Pub/Sub with s, backed by the Broker, so that
+// clients of the service, such as a pubsub.Client, can use the Broker through
+// a network connection. The psemulator package serves them on a local port.
+//
+// The services behave like the methods of the Broker's Clients, with these
+// differences: received messages have a delivery attempt only if their
+// subscription has a dead-letter policy, as with the service; messages are
+// delivered to StreamingPull and Pull requests even with
+// WithManualDelivery; and DetachSubscription and UpdateSnapshot are not
+// implemented.
+func (b *Broker) RegisterServer(s *grpc.Server) {
+	pubsubpb.RegisterPublisherServer(s, &publisherServer{b: b})
+	pubsubpb.RegisterSubscriberServer(s, &subscriberServer{b: b})
+	pubsubpb.RegisterSchemaServiceServer(s, &schemaServer{b: b})
+	iampb.RegisterIAMPolicyServer(s, &iamServer{c: &iamClient{b: b}})
+}
+
+// publisherServer implements pubsubpb.PublisherServer.
+type publisherServer struct {
+	pubsubpb.UnimplementedPublisherServer
+	b *Broker
+}
+
+// checkName returns an error with code InvalidArgument if name is not the
+// full name of a resource in the collection.
+func checkName(name, collection string) error {
+	if _, _, ok := parseName(name, collection); !ok {
+		return status.Errorf(codes.InvalidArgument, "Invalid resource name given (name=%s).", name)
+	}
+	return nil
+}
+
+// checkProject returns an error with code InvalidArgument if project is not
+// the name of a project, and otherwise its ID.
+func checkProject(project string) (string, error) {
+	if len(project) <= len("projects/") || project[:len("projects/")] != "projects/" {
+		return "", status.Errorf(codes.InvalidArgument, "Invalid project name given (name=%s).", project)
+	}
+	return project[len("projects/"):], nil
+}
+
+// page returns the page of the sorted names that starts after token, and the
+// token of the next page, or "" if it is the last.
+func page(names []string, size int32, token string) ([]string, string) {
+	if token != "" {
+		i := sort.SearchStrings(names, token)
+		if i < len(names) && names[i] == token {
+			i++
+		}
+		names = names[i:]
+	}
+	if size <= 0 || int(size) >= len(names) {
+		return names, ""
+	}
+	return names[:size], names[size-1]
+}
+
+func durationFromProto(d *durationpb.Duration) time.Duration {
+	if d == nil {
+		return 0
+	}
+	return d.AsDuration()
+}
+
+func topicConfigFromProto(t *pubsubpb.Topic) pubsub.TopicConfig {
+	cfg := pubsub.TopicConfig{
+		Labels:     t.Labels,
+		KMSKeyName: t.KmsKeyName,
+	}
+	if p := t.MessageStoragePolicy; p != nil {
+		cfg.MessageStoragePolicy.AllowedPersistenceRegions = p.AllowedPersistenceRegions
+	}
+	if t.MessageRetentionDuration != nil {
+		cfg.RetentionDuration = t.MessageRetentionDuration.AsDuration()
+	}
+	cfg.SchemaSettings = schemaSettingsFromProto(t.SchemaSettings)
+	return cfg
+}
+
+func schemaSettingsFromProto(p *pubsubpb.SchemaSettings) *pubsub.SchemaSettings {
+	if p == nil {
+		return nil
+	}
+	return &pubsub.SchemaSettings{
+		Schema:          p.Schema,
+		Encoding:        pubsub.SchemaEncoding(p.Encoding),
+		FirstRevisionID: p.FirstRevisionId,
+		LastRevisionID:  p.LastRevisionId,
+	}
+}
+
+func topicToProto(name string, cfg pubsub.TopicConfig) *pubsubpb.Topic {
+	t := &pubsubpb.Topic{
+		Name:       name,
+		Labels:     cfg.Labels,
+		KmsKeyName: cfg.KMSKeyName,
+		State:      pubsubpb.Topic_ACTIVE,
+	}
+	if regions := cfg.MessageStoragePolicy.AllowedPersistenceRegions; len(regions) > 0 {
+		t.MessageStoragePolicy = &pubsubpb.MessageStoragePolicy{AllowedPersistenceRegions: regions}
+	}
+	if d, ok := cfg.RetentionDuration.(time.Duration); ok {
+		t.MessageRetentionDuration = durationpb.New(d)
+	}
+	if ss := cfg.SchemaSettings; ss != nil {
+		t.SchemaSettings = &pubsubpb.SchemaSettings{
+			Schema:          ss.Schema,
+			Encoding:        pubsubpb.Encoding(ss.Encoding),
+			FirstRevisionId: ss.FirstRevisionID,
+			LastRevisionId:  ss.LastRevisionID,
+		}
+	}
+	return t
+}
+
+func (s *publisherServer) CreateTopic(ctx context.Context, t *pubsubpb.Topic) (*pubsubpb.Topic, error) {
+	if err := checkName(t.Name, "topics"); err != nil {
+		return nil, err
+	}
+	if err := s.b.createTopic(t.Name, topicConfigFromProto(t)); err != nil {
+		return nil, err
+	}
+	return s.GetTopic(ctx, &pubsubpb.GetTopicRequest{Topic: t.Name})
+}
+
+func (s *publisherServer) GetTopic(ctx context.Context, req *pubsubpb.GetTopicRequest) (*pubsubpb.Topic, error) {
+	cfg, err := s.b.topicConfig(req.Topic)
+	if err != nil {
+		return nil, err
+	}
+	return topicToProto(req.Topic, cfg), nil
+}
+
+func (s *publisherServer) UpdateTopic(ctx context.Context, req *pubsubpb.UpdateTopicRequest) (*pubsubpb.Topic, error) {
+	t := req.GetTopic()
+	if len(req.GetUpdateMask().GetPaths()) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "The update_mask in the UpdateTopicRequest must be set.")
+	}
+	var u pubsub.TopicConfigToUpdate
+	for _, path := range req.UpdateMask.Paths {
+		switch path {
+		case "labels":
+			u.Labels = t.Labels
+			if u.Labels == nil {
+				u.Labels = map[string]string{}
+			}
+		case "message_storage_policy":
+			u.MessageStoragePolicy = &pubsub.MessageStoragePolicy{
+				AllowedPersistenceRegions: t.GetMessageStoragePolicy().GetAllowedPersistenceRegions(),
+			}
+		case "message_retention_duration":
+			u.RetentionDuration = time.Duration(-1)
+			if t.MessageRetentionDuration != nil {
+				u.RetentionDuration = t.MessageRetentionDuration.AsDuration()
+			}
+		case "schema_settings":
+			u.SchemaSettings = &pubsub.SchemaSettings{}
+			if ss := schemaSettingsFromProto(t.SchemaSettings); ss != nil {
+				u.SchemaSettings = ss
+			}
+		default:
+			return nil, status.Errorf(codes.InvalidArgument, "Invalid update_mask provided in the UpdateTopicRequest: the field %q cannot be updated.", path)
+		}
+	}
+	cfg, err := s.b.updateTopic(t.GetName(), u)
+	if err != nil {
+		return nil, err
+	}
+	return topicToProto(t.Name, cfg), nil
+}
+
+func (s *publisherServer) Publish(ctx context.Context, req *pubsubpb.PublishRequest) (*pubsubpb.PublishResponse, error) {
+	if len(req.Messages) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "At least one message must be provided.")
+	}
+	msgs := make([]*pendingMessage, len(req.Messages))
+	for i, m := range req.Messages {
+		msgs[i] = &pendingMessage{data: m.Data, attributes: m.Attributes, orderingKey: m.OrderingKey}
+	}
+	ids, err := s.b.publish(req.Topic, msgs)
+	if err != nil {
+		return nil, err
+	}
+	return &pubsubpb.PublishResponse{MessageIds: ids}, nil
+}
+
+func (s *publisherServer) ListTopics(ctx context.Context, req *pubsubpb.ListTopicsRequest) (*pubsubpb.ListTopicsResponse, error) {
+	project, err := checkProject(req.Project)
+	if err != nil {
+		return nil, err
+	}
+	names, token := page(s.b.listTopics(project), req.PageSize, req.PageToken)
+	resp := &pubsubpb.ListTopicsResponse{NextPageToken: token}
+	for _, name := range names {
+		t, err := s.GetTopic(ctx, &pubsubpb.GetTopicRequest{Topic: name})
+		if err != nil {
+			// Deleted meanwhile.
+			continue
+		}
+		resp.Topics = append(resp.Topics, t)
+	}
+	return resp, nil
+}
+
+func (s *publisherServer) ListTopicSubscriptions(ctx context.Context, req *pubsubpb.ListTopicSubscriptionsRequest) (*pubsubpb.ListTopicSubscriptionsResponse, error) {
+	names, err := s.b.listSubscriptions("", req.Topic)
+	if err != nil {
+		return nil, err
+	}
+	names, token := page(names, req.PageSize, req.PageToken)
+	return &pubsubpb.ListTopicSubscriptionsResponse{Subscriptions: names, NextPageToken: token}, nil
+}
+
+func (s *publisherServer) ListTopicSnapshots(ctx context.Context, req *pubsubpb.ListTopicSnapshotsRequest) (*pubsubpb.ListTopicSnapshotsResponse, error) {
+	b := s.b
+	b.mu.Lock()
+	t, err := b.topicLocked(req.Topic)
+	if err != nil {
+		b.mu.Unlock()
+		return nil, err
+	}
+	var names []string
+	for name := range t.snapshots {
+		if _, err := b.snapshotLocked(name); err == nil {
+			names = append(names, name)
+		}
+	}
+	b.mu.Unlock()
+	sort.Strings(names)
+	names, token := page(names, req.PageSize, req.PageToken)
+	return &pubsubpb.ListTopicSnapshotsResponse{Snapshots: names, NextPageToken: token}, nil
+}
+
+func (s *publisherServer) DeleteTopic(ctx context.Context, req *pubsubpb.DeleteTopicRequest) (*emptypb.Empty, error) {
+	if err := s.b.deleteTopic(req.Topic); err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// iamServer implements iampb.IAMPolicyServer with an iamClient.
+type iamServer struct {
+	iampb.UnimplementedIAMPolicyServer
+	c *iamClient
+}
+
+func (s *iamServer) GetIamPolicy(ctx context.Context, req *iampb.GetIamPolicyRequest) (*iampb.Policy, error) {
+	return s.c.GetIamPolicy(ctx, req)
+}
+
+func (s *iamServer) SetIamPolicy(ctx context.Context, req *iampb.SetIamPolicyRequest) (*iampb.Policy, error) {
+	return s.c.SetIamPolicy(ctx, req)
+}
+
+func (s *iamServer) TestIamPermissions(ctx context.Context, req *iampb.TestIamPermissionsRequest) (*iampb.TestIamPermissionsResponse, error) {
+	return s.c.TestIamPermissions(ctx, req)
+}
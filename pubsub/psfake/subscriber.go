@@ -0,0 +1,516 @@
+// Copyright 2026 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package psfake
+
+import (
+	"context"
+	"io"
+	"sort"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/pubsub/apiv1/pubsubpb"
+	"github.com/googleapis/google-cloud-go-testing/pubsub/psiface"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// subscriberServer implements pubsubpb.SubscriberServer.
+type subscriberServer struct {
+	pubsubpb.UnimplementedSubscriberServer
+	b *Broker
+}
+
+func pushConfigFromProto(p *pubsubpb.PushConfig) pubsub.PushConfig {
+	cfg := pubsub.PushConfig{
+		Endpoint:   p.GetPushEndpoint(),
+		Attributes: p.GetAttributes(),
+	}
+	if t := p.GetOidcToken(); t != nil {
+		cfg.AuthenticationMethod = &pubsub.OIDCToken{Audience: t.Audience, ServiceAccountEmail: t.ServiceAccountEmail}
+	}
+	return cfg
+}
+
+func pushConfigToProto(cfg pubsub.PushConfig) *pubsubpb.PushConfig {
+	p := &pubsubpb.PushConfig{PushEndpoint: cfg.Endpoint, Attributes: cfg.Attributes}
+	if t, ok := cfg.AuthenticationMethod.(*pubsub.OIDCToken); ok {
+		p.AuthenticationMethod = &pubsubpb.PushConfig_OidcToken_{
+			OidcToken: &pubsubpb.PushConfig_OidcToken{Audience: t.Audience, ServiceAccountEmail: t.ServiceAccountEmail},
+		}
+	}
+	return p
+}
+
+func deadLetterPolicyFromProto(p *pubsubpb.DeadLetterPolicy) *pubsub.DeadLetterPolicy {
+	if p == nil {
+		return nil
+	}
+	return &pubsub.DeadLetterPolicy{DeadLetterTopic: p.DeadLetterTopic, MaxDeliveryAttempts: int(p.MaxDeliveryAttempts)}
+}
+
+func retryPolicyFromProto(p *pubsubpb.RetryPolicy) *pubsub.RetryPolicy {
+	if p == nil {
+		return nil
+	}
+	r := &pubsub.RetryPolicy{}
+	if p.MinimumBackoff != nil {
+		r.MinimumBackoff = p.MinimumBackoff.AsDuration()
+	}
+	if p.MaximumBackoff != nil {
+		r.MaximumBackoff = p.MaximumBackoff.AsDuration()
+	}
+	return r
+}
+
+func subscriptionConfigFromProto(p *pubsubpb.Subscription) psiface.SubscriptionConfig {
+	cfg := psiface.SubscriptionConfig{SubscriptionConfig: pubsub.SubscriptionConfig{
+		PushConfig:                pushConfigFromProto(p.PushConfig),
+		AckDeadline:               time.Duration(p.AckDeadlineSeconds) * time.Second,
+		RetainAckedMessages:       p.RetainAckedMessages,
+		RetentionDuration:         durationFromProto(p.MessageRetentionDuration),
+		Labels:                    p.Labels,
+		EnableMessageOrdering:     p.EnableMessageOrdering,
+		Filter:                    p.Filter,
+		DeadLetterPolicy:          deadLetterPolicyFromProto(p.DeadLetterPolicy),
+		RetryPolicy:               retryPolicyFromProto(p.RetryPolicy),
+		EnableExactlyOnceDelivery: p.EnableExactlyOnceDelivery,
+	}}
+	if p.ExpirationPolicy != nil {
+		cfg.ExpirationPolicy = durationFromProto(p.ExpirationPolicy.Ttl)
+	}
+	return cfg
+}
+
+func subscriptionToProto(name string, cfg psiface.SubscriptionConfig) *pubsubpb.Subscription {
+	p := &pubsubpb.Subscription{
+		Name:                      name,
+		Topic:                     cfg.Topic.String(),
+		PushConfig:                pushConfigToProto(cfg.PushConfig),
+		AckDeadlineSeconds:        int32(cfg.AckDeadline / time.Second),
+		RetainAckedMessages:       cfg.RetainAckedMessages,
+		MessageRetentionDuration:  durationpb.New(cfg.RetentionDuration),
+		Labels:                    cfg.Labels,
+		EnableMessageOrdering:     cfg.EnableMessageOrdering,
+		Filter:                    cfg.Filter,
+		EnableExactlyOnceDelivery: cfg.EnableExactlyOnceDelivery,
+		State:                     pubsubpb.Subscription_ACTIVE,
+	}
+	if d, ok := cfg.ExpirationPolicy.(time.Duration); ok {
+		p.ExpirationPolicy = &pubsubpb.ExpirationPolicy{}
+		if d > 0 {
+			p.ExpirationPolicy.Ttl = durationpb.New(d)
+		}
+	}
+	if dl := cfg.DeadLetterPolicy; dl != nil {
+		p.DeadLetterPolicy = &pubsubpb.DeadLetterPolicy{DeadLetterTopic: dl.DeadLetterTopic, MaxDeliveryAttempts: int32(dl.MaxDeliveryAttempts)}
+	}
+	if r := cfg.RetryPolicy; r != nil {
+		p.RetryPolicy = &pubsubpb.RetryPolicy{}
+		if d, ok := r.MinimumBackoff.(time.Duration); ok {
+			p.RetryPolicy.MinimumBackoff = durationpb.New(d)
+		}
+		if d, ok := r.MaximumBackoff.(time.Duration); ok {
+			p.RetryPolicy.MaximumBackoff = durationpb.New(d)
+		}
+	}
+	return p
+}
+
+func (s *subscriberServer) CreateSubscription(ctx context.Context, p *pubsubpb.Subscription) (*pubsubpb.Subscription, error) {
+	if err := checkName(p.Name, "subscriptions"); err != nil {
+		return nil, err
+	}
+	if err := s.b.createSubscription(p.Name, p.Topic, subscriptionConfigFromProto(p)); err != nil {
+		return nil, err
+	}
+	return s.GetSubscription(ctx, &pubsubpb.GetSubscriptionRequest{Subscription: p.Name})
+}
+
+func (s *subscriberServer) GetSubscription(ctx context.Context, req *pubsubpb.GetSubscriptionRequest) (*pubsubpb.Subscription, error) {
+	b := s.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	st, err := b.subscriptionLocked(req.Subscription)
+	if err != nil {
+		return nil, err
+	}
+	return subscriptionToProto(st.name, b.subscriptionConfigLocked(st)), nil
+}
+
+func (s *subscriberServer) UpdateSubscription(ctx context.Context, req *pubsubpb.UpdateSubscriptionRequest) (*pubsubpb.Subscription, error) {
+	p := req.GetSubscription()
+	if len(req.GetUpdateMask().GetPaths()) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "The update_mask in the UpdateSubscriptionRequest must be set.")
+	}
+	var u pubsub.SubscriptionConfigToUpdate
+	for _, path := range req.UpdateMask.Paths {
+		switch path {
+		case "push_config":
+			cfg := pushConfigFromProto(p.PushConfig)
+			u.PushConfig = &cfg
+		case "ack_deadline_seconds":
+			u.AckDeadline = time.Duration(p.AckDeadlineSeconds) * time.Second
+		case "retain_acked_messages":
+			u.RetainAckedMessages = p.RetainAckedMessages
+		case "message_retention_duration":
+			u.RetentionDuration = durationFromProto(p.MessageRetentionDuration)
+		case "labels":
+			u.Labels = p.Labels
+			if u.Labels == nil {
+				u.Labels = map[string]string{}
+			}
+		case "expiration_policy":
+			u.ExpirationPolicy = durationFromProto(p.GetExpirationPolicy().GetTtl())
+		case "dead_letter_policy":
+			u.DeadLetterPolicy = &pubsub.DeadLetterPolicy{}
+			if dl := deadLetterPolicyFromProto(p.DeadLetterPolicy); dl != nil {
+				u.DeadLetterPolicy = dl
+			}
+		case "retry_policy":
+			u.RetryPolicy = &pubsub.RetryPolicy{}
+			if r := retryPolicyFromProto(p.RetryPolicy); r != nil {
+				u.RetryPolicy = r
+			}
+		case "enable_exactly_once_delivery":
+			u.EnableExactlyOnceDelivery = p.EnableExactlyOnceDelivery
+		default:
+			return nil, status.Errorf(codes.InvalidArgument, "Invalid update_mask provided in the UpdateSubscriptionRequest: the field %q cannot be updated.", path)
+		}
+	}
+	cfg, err := s.b.updateSubscription(p.GetName(), u)
+	if err != nil {
+		return nil, err
+	}
+	return subscriptionToProto(p.Name, cfg), nil
+}
+
+func (s *subscriberServer) ListSubscriptions(ctx context.Context, req *pubsubpb.ListSubscriptionsRequest) (*pubsubpb.ListSubscriptionsResponse, error) {
+	project, err := checkProject(req.Project)
+	if err != nil {
+		return nil, err
+	}
+	names, _ := s.b.listSubscriptions(project, "")
+	names, token := page(names, req.PageSize, req.PageToken)
+	resp := &pubsubpb.ListSubscriptionsResponse{NextPageToken: token}
+	for _, name := range names {
+		p, err := s.GetSubscription(ctx, &pubsubpb.GetSubscriptionRequest{Subscription: name})
+		if err != nil {
+			// Deleted meanwhile.
+			continue
+		}
+		resp.Subscriptions = append(resp.Subscriptions, p)
+	}
+	return resp, nil
+}
+
+func (s *subscriberServer) DeleteSubscription(ctx context.Context, req *pubsubpb.DeleteSubscriptionRequest) (*emptypb.Empty, error) {
+	if err := s.b.deleteSubscription(req.Subscription); err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *subscriberServer) ModifyPushConfig(ctx context.Context, req *pubsubpb.ModifyPushConfigRequest) (*emptypb.Empty, error) {
+	cfg := pushConfigFromProto(req.PushConfig)
+	if _, err := s.b.updateSubscription(req.Subscription, pubsub.SubscriptionConfigToUpdate{PushConfig: &cfg}); err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// checkAckDeadline returns an error with code InvalidArgument if secs is not
+// a valid ack deadline extension, which may be zero.
+func checkAckDeadline(secs int32) error {
+	if secs < 0 || time.Duration(secs)*time.Second > maxAckDeadline {
+		return status.Errorf(codes.InvalidArgument, "Invalid ack deadline given: %d. The ack deadline must be between 0 and %d seconds.", secs, maxAckDeadline/time.Second)
+	}
+	return nil
+}
+
+func (s *subscriberServer) ModifyAckDeadline(ctx context.Context, req *pubsubpb.ModifyAckDeadlineRequest) (*emptypb.Empty, error) {
+	if err := checkAckDeadline(req.AckDeadlineSeconds); err != nil {
+		return nil, err
+	}
+	if err := s.b.modifyAckDeadline(req.Subscription, req.AckIds, time.Duration(req.AckDeadlineSeconds)*time.Second); err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *subscriberServer) Acknowledge(ctx context.Context, req *pubsubpb.AcknowledgeRequest) (*emptypb.Empty, error) {
+	if !s.b.subscriptionExists(req.Subscription) {
+		return nil, status.Errorf(codes.NotFound, "Resource not found (resource=%s).", resourceID(req.Subscription))
+	}
+	for _, ackID := range req.AckIds {
+		s.b.ack(req.Subscription, ackID)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+// receivedMessageToProto returns the message of a delivery from next.
+func (s *subscriberServer) receivedMessageToProto(sub string, d *delivery) *pubsubpb.ReceivedMessage {
+	m := &pubsubpb.ReceivedMessage{
+		AckId: d.ackID,
+		Message: &pubsubpb.PubsubMessage{
+			Data:        d.msg.data,
+			Attributes:  d.msg.attributes,
+			MessageId:   d.msg.id,
+			PublishTime: timestamppb.New(d.msg.publishTime),
+			OrderingKey: d.msg.orderingKey,
+		},
+	}
+	if cfg, ok := s.b.subscriptionConfig(sub); ok && cfg.DeadLetterPolicy != nil {
+		m.DeliveryAttempt = int32(d.attempts)
+	}
+	return m
+}
+
+// pull returns up to max waiting messages of the subscription, with their
+// ack deadlines set to deadline, or the subscription's AckDeadline if it is
+// zero. If there is no message, it returns a channel that is closed when
+// that may have changed.
+func (s *subscriberServer) pull(sub string, max int, deadline time.Duration) ([]*pubsubpb.ReceivedMessage, <-chan struct{}, error) {
+	var (
+		msgs   []*pubsubpb.ReceivedMessage
+		ackIDs []string
+	)
+	for max <= 0 || len(msgs) < max {
+		d, wait, err := s.b.next(sub, false, -1)
+		if err != nil {
+			return nil, nil, err
+		}
+		if d == nil {
+			if len(msgs) == 0 {
+				return nil, wait, nil
+			}
+			break
+		}
+		msgs = append(msgs, s.receivedMessageToProto(sub, d))
+		ackIDs = append(ackIDs, d.ackID)
+	}
+	if deadline > 0 {
+		if err := s.b.modifyAckDeadline(sub, ackIDs, deadline); err != nil {
+			return nil, nil, err
+		}
+	}
+	return msgs, nil, nil
+}
+
+// Pull returns the waiting messages, waiting for one unless
+// ReturnImmediately is set.
+func (s *subscriberServer) Pull(ctx context.Context, req *pubsubpb.PullRequest) (*pubsubpb.PullResponse, error) {
+	if req.MaxMessages <= 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "max_messages must be positive.")
+	}
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		msgs, wait, err := s.pull(req.Subscription, int(req.MaxMessages), 0)
+		if err != nil {
+			return nil, err
+		}
+		if len(msgs) > 0 || req.ReturnImmediately {
+			return &pubsubpb.PullResponse{ReceivedMessages: msgs}, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, status.FromContextError(ctx.Err()).Err()
+		case <-wait:
+		case <-ticker.C:
+		}
+	}
+}
+
+// StreamingPull sends the messages of the subscription on the stream, within
+// the flow control limits of the first request, until the client closes it.
+// Acks and ack deadline modifications may be sent on the stream or with the
+// unary methods.
+func (s *subscriberServer) StreamingPull(stream pubsubpb.Subscriber_StreamingPullServer) error {
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	sub := req.Subscription
+	if sub == "" {
+		return status.Errorf(codes.InvalidArgument, "The subscription must be set in the first StreamingPullRequest.")
+	}
+	if secs := req.StreamAckDeadlineSeconds; time.Duration(secs)*time.Second < minAckDeadline || time.Duration(secs)*time.Second > maxAckDeadline {
+		return status.Errorf(codes.InvalidArgument, "Invalid stream ack deadline given: %d. The stream ack deadline must be between %d and %d seconds.", secs, minAckDeadline/time.Second, maxAckDeadline/time.Second)
+	}
+	cfg, ok := s.b.subscriptionConfig(sub)
+	if !ok {
+		return status.Errorf(codes.NotFound, "Resource not found (resource=%s).", resourceID(sub))
+	}
+	defer s.b.connect(sub)()
+	deadline := time.Duration(req.StreamAckDeadlineSeconds) * time.Second
+	maxMessages, maxBytes := int(req.MaxOutstandingMessages), int(req.MaxOutstandingBytes)
+	props := &pubsubpb.StreamingPullResponse_SubscriptionProperties{
+		ExactlyOnceDeliveryEnabled: cfg.EnableExactlyOnceDelivery,
+		MessageOrderingEnabled:     cfg.EnableMessageOrdering,
+	}
+
+	ctx := stream.Context()
+	recvErr := make(chan error, 1)
+	if err := s.applyStreamingPullRequest(sub, req); err != nil {
+		return err
+	}
+	go func() {
+		for {
+			req, err := stream.Recv()
+			if err == nil {
+				err = s.applyStreamingPullRequest(sub, req)
+			}
+			if err != nil {
+				recvErr <- err
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	held := make(map[string]int) // data sizes of the outstanding messages sent, by ack ID
+	for {
+		var wait <-chan struct{}
+		n, size, changed := s.b.held(sub, held)
+		if maxMessages > 0 && n >= maxMessages || maxBytes > 0 && size >= maxBytes {
+			wait = changed
+		} else {
+			max := 0
+			if maxMessages > 0 {
+				max = maxMessages - n
+			}
+			var msgs []*pubsubpb.ReceivedMessage
+			msgs, wait, err = s.pull(sub, max, deadline)
+			if err != nil {
+				return err
+			}
+			if len(msgs) > 0 {
+				for _, m := range msgs {
+					held[m.AckId] = len(m.Message.Data)
+				}
+				resp := &pubsubpb.StreamingPullResponse{ReceivedMessages: msgs, SubscriptionProperties: props}
+				if err := stream.Send(resp); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		case err := <-recvErr:
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		case <-wait:
+		case <-ticker.C:
+		}
+	}
+}
+
+// applyStreamingPullRequest applies the acks and ack deadline modifications
+// of a StreamingPullRequest on the stream of sub.
+func (s *subscriberServer) applyStreamingPullRequest(sub string, req *pubsubpb.StreamingPullRequest) error {
+	for _, ackID := range req.AckIds {
+		s.b.ack(sub, ackID)
+	}
+	if len(req.ModifyDeadlineSeconds) != len(req.ModifyDeadlineAckIds) {
+		return status.Errorf(codes.InvalidArgument, "modify_deadline_seconds and modify_deadline_ack_ids must have the same length.")
+	}
+	for i, ackID := range req.ModifyDeadlineAckIds {
+		secs := req.ModifyDeadlineSeconds[i]
+		if err := checkAckDeadline(secs); err != nil {
+			return err
+		}
+		s.b.modifyAckDeadline(sub, []string{ackID}, time.Duration(secs)*time.Second)
+	}
+	return nil
+}
+
+func (s *subscriberServer) GetSnapshot(ctx context.Context, req *pubsubpb.GetSnapshotRequest) (*pubsubpb.Snapshot, error) {
+	b := s.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	sn, err := b.snapshotLocked(req.Snapshot)
+	if err != nil {
+		return nil, err
+	}
+	return snapshotToProto(*sn), nil
+}
+
+func snapshotToProto(sn snapshotState) *pubsubpb.Snapshot {
+	return &pubsubpb.Snapshot{Name: sn.name, Topic: sn.topic, ExpireTime: timestamppb.New(sn.expiration)}
+}
+
+func (s *subscriberServer) ListSnapshots(ctx context.Context, req *pubsubpb.ListSnapshotsRequest) (*pubsubpb.ListSnapshotsResponse, error) {
+	project, err := checkProject(req.Project)
+	if err != nil {
+		return nil, err
+	}
+	snaps := s.b.listSnapshots(project)
+	names := make([]string, len(snaps))
+	byName := make(map[string]snapshotState)
+	for i, sn := range snaps {
+		names[i] = sn.name
+		byName[sn.name] = sn
+	}
+	sort.Strings(names)
+	names, token := page(names, req.PageSize, req.PageToken)
+	resp := &pubsubpb.ListSnapshotsResponse{NextPageToken: token}
+	for _, name := range names {
+		resp.Snapshots = append(resp.Snapshots, snapshotToProto(byName[name]))
+	}
+	return resp, nil
+}
+
+func (s *subscriberServer) CreateSnapshot(ctx context.Context, req *pubsubpb.CreateSnapshotRequest) (*pubsubpb.Snapshot, error) {
+	if err := checkName(req.Name, "snapshots"); err != nil {
+		return nil, err
+	}
+	sn, err := s.b.createSnapshot(req.Name, req.Subscription)
+	if err != nil {
+		return nil, err
+	}
+	return snapshotToProto(sn), nil
+}
+
+func (s *subscriberServer) DeleteSnapshot(ctx context.Context, req *pubsubpb.DeleteSnapshotRequest) (*emptypb.Empty, error) {
+	if err := s.b.deleteSnapshot(req.Snapshot); err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *subscriberServer) Seek(ctx context.Context, req *pubsubpb.SeekRequest) (*pubsubpb.SeekResponse, error) {
+	var err error
+	switch t := req.Target.(type) {
+	case *pubsubpb.SeekRequest_Time:
+		err = s.b.seekToTime(req.Subscription, t.Time.AsTime())
+	case *pubsubpb.SeekRequest_Snapshot:
+		err = s.b.seekToSnapshot(req.Subscription, t.Snapshot)
+	default:
+		err = status.Errorf(codes.InvalidArgument, "The seek target must be set.")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &pubsubpb.SeekResponse{}, nil
+}
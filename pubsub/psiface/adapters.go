@@ -16,8 +16,10 @@ package psiface
 
 import (
 	"context"
+	"fmt"
 	"time"
 
+	"cloud.google.com/go/iam"
 	"cloud.google.com/go/pubsub"
 )
 
@@ -27,25 +29,49 @@ func AdaptClient(c *pubsub.Client) Client {
 	return client{c}
 }
 
+// AdaptSchemaClient adapts a pubsub.SchemaClient so that it satisfies the
+// SchemaClient interface.
+func AdaptSchemaClient(c *pubsub.SchemaClient) SchemaClient {
+	return schemaClient{c}
+}
+
 // AdaptMessage adapts a pubsub.Message so that it satisfies the Message
 // interface.
 func AdaptMessage(msg *pubsub.Message) Message {
 	return message{msg}
 }
 
+// NewMessage returns a Message with the given data, attributes and ordering
+// key, for publishing with Topic.Publish. The ordering key may be empty.
+func NewMessage(data []byte, attributes map[string]string, orderingKey string) Message {
+	return message{&pubsub.Message{Data: data, Attributes: attributes, OrderingKey: orderingKey}}
+}
+
 type (
-	client        struct{ *pubsub.Client }
-	topic         struct{ *pubsub.Topic }
-	subscription  struct{ *pubsub.Subscription }
-	message       struct{ *pubsub.Message }
-	publishResult struct{ *pubsub.PublishResult }
+	client                 struct{ *pubsub.Client }
+	topic                  struct{ *pubsub.Topic }
+	topicIterator          struct{ *pubsub.TopicIterator }
+	subscription           struct{ *pubsub.Subscription }
+	subscriptionIterator   struct{ *pubsub.SubscriptionIterator }
+	snapshot               struct{ *pubsub.Snapshot }
+	snapshotConfigIterator struct{ *pubsub.SnapshotConfigIterator }
+	message                struct{ *pubsub.Message }
+	publishResult          struct{ *pubsub.PublishResult }
+	schemaClient           struct{ *pubsub.SchemaClient }
+	schemaIterator         struct{ *pubsub.SchemaIterator }
 )
 
-func (client) embedToIncludeNewMethods()        {}
-func (topic) embedToIncludeNewMethods()         {}
-func (subscription) embedToIncludeNewMethods()  {}
-func (message) embedToIncludeNewMethods()       {}
-func (publishResult) embedToIncludeNewMethods() {}
+func (client) embedToIncludeNewMethods()                 {}
+func (topic) embedToIncludeNewMethods()                  {}
+func (topicIterator) embedToIncludeNewMethods()          {}
+func (subscription) embedToIncludeNewMethods()           {}
+func (subscriptionIterator) embedToIncludeNewMethods()   {}
+func (snapshot) embedToIncludeNewMethods()               {}
+func (snapshotConfigIterator) embedToIncludeNewMethods() {}
+func (message) embedToIncludeNewMethods()                {}
+func (publishResult) embedToIncludeNewMethods()          {}
+func (schemaClient) embedToIncludeNewMethods()           {}
+func (schemaIterator) embedToIncludeNewMethods()         {}
 
 func (c client) CreateTopic(ctx context.Context, topicID string) (Topic, error) {
 	t, err := c.Client.CreateTopic(ctx, topicID)
@@ -55,6 +81,14 @@ func (c client) CreateTopic(ctx context.Context, topicID string) (Topic, error)
 	return topic{t}, nil
 }
 
+func (c client) CreateTopicWithConfig(ctx context.Context, topicID string, tc *pubsub.TopicConfig) (Topic, error) {
+	t, err := c.Client.CreateTopicWithConfig(ctx, topicID, tc)
+	if err != nil {
+		return nil, err
+	}
+	return topic{t}, nil
+}
+
 func (c client) Topic(id string) Topic {
 	return topic{c.Client.Topic(id)}
 }
@@ -71,28 +105,201 @@ func (c client) Subscription(id string) Subscription {
 	return subscription{c.Client.Subscription(id)}
 }
 
+func (c client) Topics(ctx context.Context) TopicIterator {
+	return topicIterator{c.Client.Topics(ctx)}
+}
+
+func (c client) Subscriptions(ctx context.Context) SubscriptionIterator {
+	return subscriptionIterator{c.Client.Subscriptions(ctx)}
+}
+
+func (c client) Snapshot(id string) Snapshot {
+	return snapshot{c.Client.Snapshot(id)}
+}
+
+func (c client) Snapshots(ctx context.Context) SnapshotConfigIterator {
+	return snapshotConfigIterator{c.Client.Snapshots(ctx)}
+}
+
 func (t topic) String() string {
 	return t.Topic.String()
 }
 
+func (t topic) ID() string {
+	return t.Topic.ID()
+}
+
+func (t topic) Exists(ctx context.Context) (bool, error) {
+	return t.Topic.Exists(ctx)
+}
+
+func (t topic) Delete(ctx context.Context) error {
+	return t.Topic.Delete(ctx)
+}
+
+func (t topic) Config(ctx context.Context) (pubsub.TopicConfig, error) {
+	return t.Topic.Config(ctx)
+}
+
+func (t topic) Update(ctx context.Context, cfg pubsub.TopicConfigToUpdate) (pubsub.TopicConfig, error) {
+	return t.Topic.Update(ctx, cfg)
+}
+
+func (t topic) Stop() {
+	t.Topic.Stop()
+}
+
+func (t topic) Flush() {
+	t.Topic.Flush()
+}
+
+func (t topic) Subscriptions(ctx context.Context) SubscriptionIterator {
+	return subscriptionIterator{t.Topic.Subscriptions(ctx)}
+}
+
+func (t topic) IAM() *iam.Handle {
+	return t.Topic.IAM()
+}
+
+func (it topicIterator) Next() (Topic, error) {
+	t, err := it.TopicIterator.Next()
+	if err != nil {
+		return nil, err
+	}
+	return topic{t}, nil
+}
+
 func (t topic) Publish(ctx context.Context, msg Message) PublishResult {
-	return publishResult{t.Topic.Publish(ctx, msg.(message).Message)}
+	return publishResult{t.Topic.Publish(ctx, toPSMessage(msg))}
+}
+
+func (t topic) SetEnableMessageOrdering(b bool) {
+	t.Topic.EnableMessageOrdering = b
+}
+
+func (t topic) PublishSettings() pubsub.PublishSettings {
+	return t.Topic.PublishSettings
+}
+
+func (t topic) SetPublishSettings(settings pubsub.PublishSettings) {
+	t.Topic.PublishSettings = settings
+}
+
+func (t topic) ResumePublish(orderingKey string) {
+	t.Topic.ResumePublish(orderingKey)
+}
+
+// toPSMessage returns the pubsub.Message to publish for msg. Messages that
+// were not created by AdaptMessage or NewMessage are copied from their data,
+// attributes and ordering key.
+func toPSMessage(msg Message) *pubsub.Message {
+	if m, ok := msg.(message); ok {
+		return m.Message
+	}
+	return &pubsub.Message{Data: msg.Data(), Attributes: msg.Attributes(), OrderingKey: msg.OrderingKey()}
+}
+
+func (s subscription) String() string {
+	return s.Subscription.String()
+}
+
+func (s subscription) ID() string {
+	return s.Subscription.ID()
 }
 
 func (s subscription) Exists(ctx context.Context) (bool, error) {
 	return s.Subscription.Exists(ctx)
 }
 
+func (s subscription) Config(ctx context.Context) (SubscriptionConfig, error) {
+	cfg, err := s.Subscription.Config(ctx)
+	if err != nil {
+		return SubscriptionConfig{}, err
+	}
+	return fromPSSubscriptionConfig(cfg), nil
+}
+
+func (s subscription) Update(ctx context.Context, cfg pubsub.SubscriptionConfigToUpdate) (SubscriptionConfig, error) {
+	c, err := s.Subscription.Update(ctx, cfg)
+	if err != nil {
+		return SubscriptionConfig{}, err
+	}
+	return fromPSSubscriptionConfig(c), nil
+}
+
+func (it subscriptionIterator) Next() (Subscription, error) {
+	s, err := it.SubscriptionIterator.Next()
+	if err != nil {
+		return nil, err
+	}
+	return subscription{s}, nil
+}
+
 func (s subscription) Receive(ctx context.Context, f func(ctx context.Context, msg Message)) error {
 	return s.Subscription.Receive(ctx, func(ctx context.Context, msg *pubsub.Message) {
 		f(ctx, AdaptMessage(msg))
 	})
 }
 
+func (s subscription) ReceiveSettings() pubsub.ReceiveSettings {
+	return s.Subscription.ReceiveSettings
+}
+
+func (s subscription) SetReceiveSettings(settings pubsub.ReceiveSettings) {
+	s.Subscription.ReceiveSettings = settings
+}
+
 func (s subscription) Delete(ctx context.Context) error {
 	return s.Subscription.Delete(ctx)
 }
 
+func (s subscription) SeekToTime(ctx context.Context, t time.Time) error {
+	return s.Subscription.SeekToTime(ctx, t)
+}
+
+func (s subscription) CreateSnapshot(ctx context.Context, name string) (*SnapshotConfig, error) {
+	cfg, err := s.Subscription.CreateSnapshot(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return fromPSSnapshotConfig(cfg), nil
+}
+
+// SeekToSnapshot seeks to a snapshot, which must have been returned by this
+// package's adapters, since a pubsub.Snapshot can only be obtained from a
+// pubsub.Client.
+func (s subscription) SeekToSnapshot(ctx context.Context, snap Snapshot) error {
+	ps, ok := snap.(snapshot)
+	if !ok {
+		return fmt.Errorf("psiface: snapshot %q was not created by an adapted client", snap.ID())
+	}
+	return s.Subscription.SeekToSnapshot(ctx, ps.Snapshot)
+}
+
+func (s snapshot) ID() string {
+	return s.Snapshot.ID()
+}
+
+func (s snapshot) Delete(ctx context.Context) error {
+	return s.Snapshot.Delete(ctx)
+}
+
+func (it snapshotConfigIterator) Next() (*SnapshotConfig, error) {
+	cfg, err := it.SnapshotConfigIterator.Next()
+	if err != nil {
+		return nil, err
+	}
+	return fromPSSnapshotConfig(cfg), nil
+}
+
+func fromPSSnapshotConfig(cfg *pubsub.SnapshotConfig) *SnapshotConfig {
+	return &SnapshotConfig{
+		SnapshotConfig: *cfg,
+		Snapshot:       snapshot{cfg.Snapshot},
+		Topic:          topic{cfg.Topic},
+	}
+}
+
 func (m message) ID() string {
 	return m.Message.ID
 }
@@ -109,17 +316,86 @@ func (m message) PublishTime() time.Time {
 	return m.Message.PublishTime
 }
 
+func (m message) DeliveryAttempt() *int {
+	return m.Message.DeliveryAttempt
+}
+
+func (m message) OrderingKey() string {
+	return m.Message.OrderingKey
+}
+
 func (r publishResult) Get(ctx context.Context) (serverID string, err error) {
 	return r.PublishResult.Get(ctx)
 }
 
+func fromPSSubscriptionConfig(cfg pubsub.SubscriptionConfig) SubscriptionConfig {
+	return SubscriptionConfig{SubscriptionConfig: cfg, Topic: topic{cfg.Topic}}
+}
+
 func (cfg SubscriptionConfig) toPS() pubsub.SubscriptionConfig {
 	return pubsub.SubscriptionConfig{
-		Topic:               cfg.Topic.(topic).Topic,
-		PushConfig:          cfg.PushConfig,
-		AckDeadline:         cfg.AckDeadline,
-		RetainAckedMessages: cfg.RetainAckedMessages,
-		RetentionDuration:   cfg.RetentionDuration,
-		Labels:              cfg.Labels,
+		Topic:                 cfg.Topic.(topic).Topic,
+		PushConfig:            cfg.PushConfig,
+		AckDeadline:           cfg.AckDeadline,
+		RetainAckedMessages:   cfg.RetainAckedMessages,
+		RetentionDuration:     cfg.RetentionDuration,
+		ExpirationPolicy:      cfg.ExpirationPolicy,
+		Labels:                cfg.Labels,
+		DeadLetterPolicy:      cfg.DeadLetterPolicy,
+		EnableMessageOrdering: cfg.EnableMessageOrdering,
+		Filter:                cfg.Filter,
+		RetryPolicy:           cfg.RetryPolicy,
 	}
 }
+
+func (c schemaClient) Close() error {
+	return c.SchemaClient.Close()
+}
+
+func (c schemaClient) CreateSchema(ctx context.Context, schemaID string, s pubsub.SchemaConfig) (*pubsub.SchemaConfig, error) {
+	return c.SchemaClient.CreateSchema(ctx, schemaID, s)
+}
+
+func (c schemaClient) Schema(ctx context.Context, schemaID string, view pubsub.SchemaView) (*pubsub.SchemaConfig, error) {
+	return c.SchemaClient.Schema(ctx, schemaID, view)
+}
+
+func (c schemaClient) Schemas(ctx context.Context, view pubsub.SchemaView) SchemaIterator {
+	return schemaIterator{c.SchemaClient.Schemas(ctx, view)}
+}
+
+func (c schemaClient) ListSchemaRevisions(ctx context.Context, schemaID string, view pubsub.SchemaView) SchemaIterator {
+	return schemaIterator{c.SchemaClient.ListSchemaRevisions(ctx, schemaID, view)}
+}
+
+func (c schemaClient) CommitSchema(ctx context.Context, schemaID string, s pubsub.SchemaConfig) (*pubsub.SchemaConfig, error) {
+	return c.SchemaClient.CommitSchema(ctx, schemaID, s)
+}
+
+func (c schemaClient) RollbackSchema(ctx context.Context, schemaID, revisionID string) (*pubsub.SchemaConfig, error) {
+	return c.SchemaClient.RollbackSchema(ctx, schemaID, revisionID)
+}
+
+func (c schemaClient) DeleteSchemaRevision(ctx context.Context, schemaID, revisionID string) (*pubsub.SchemaConfig, error) {
+	return c.SchemaClient.DeleteSchemaRevision(ctx, schemaID, revisionID)
+}
+
+func (c schemaClient) DeleteSchema(ctx context.Context, schemaID string) error {
+	return c.SchemaClient.DeleteSchema(ctx, schemaID)
+}
+
+func (c schemaClient) ValidateSchema(ctx context.Context, schema pubsub.SchemaConfig) (*pubsub.ValidateSchemaResult, error) {
+	return c.SchemaClient.ValidateSchema(ctx, schema)
+}
+
+func (c schemaClient) ValidateMessageWithConfig(ctx context.Context, msg []byte, encoding pubsub.SchemaEncoding, config pubsub.SchemaConfig) (*pubsub.ValidateMessageResult, error) {
+	return c.SchemaClient.ValidateMessageWithConfig(ctx, msg, encoding, config)
+}
+
+func (c schemaClient) ValidateMessageWithID(ctx context.Context, msg []byte, encoding pubsub.SchemaEncoding, schemaID string) (*pubsub.ValidateMessageResult, error) {
+	return c.SchemaClient.ValidateMessageWithID(ctx, msg, encoding, schemaID)
+}
+
+func (it schemaIterator) Next() (*pubsub.SchemaConfig, error) {
+	return it.SchemaIterator.Next()
+}
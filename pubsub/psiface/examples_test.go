@@ -28,7 +28,7 @@ func ExampleAdaptClient() {
 		// TODO: Handle error.
 	}
 	client := psiface.AdaptClient(c)
-	msg := psiface.AdaptMessage(&pubsub.Message{})
+	msg := psiface.NewMessage([]byte("hello"), nil, "")
 	_, err = client.Topic("my-topic").Publish(ctx, msg).Get(ctx)
 	if err != nil {
 		// TODO: Handle error.
@@ -17,37 +17,94 @@ package psiface
 import (
 	"context"
 	"time"
+
+	"cloud.google.com/go/iam"
+	"cloud.google.com/go/pubsub"
 )
 
 type Client interface {
 	CreateTopic(ctx context.Context, topicID string) (Topic, error)
+	CreateTopicWithConfig(ctx context.Context, topicID string, tc *pubsub.TopicConfig) (Topic, error)
 	Topic(id string) Topic
 	CreateSubscription(ctx context.Context, id string, cfg SubscriptionConfig) (Subscription, error)
 	Subscription(id string) Subscription
+	Topics(ctx context.Context) TopicIterator
+	Subscriptions(ctx context.Context) SubscriptionIterator
+	Snapshot(id string) Snapshot
+	Snapshots(ctx context.Context) SnapshotConfigIterator
 
 	embedToIncludeNewMethods()
 }
 
 type Topic interface {
 	String() string
+	ID() string
+	Exists(ctx context.Context) (bool, error)
+	Delete(ctx context.Context) error
+	Config(ctx context.Context) (pubsub.TopicConfig, error)
+	Update(ctx context.Context, cfg pubsub.TopicConfigToUpdate) (pubsub.TopicConfig, error)
 	Publish(ctx context.Context, msg Message) PublishResult
+	SetEnableMessageOrdering(bool)
+	PublishSettings() pubsub.PublishSettings
+	SetPublishSettings(pubsub.PublishSettings)
+	ResumePublish(orderingKey string)
+	Stop()
+	Flush()
+	Subscriptions(ctx context.Context) SubscriptionIterator
+	IAM() *iam.Handle
+
+	embedToIncludeNewMethods()
+}
+
+type TopicIterator interface {
+	Next() (Topic, error)
 
 	embedToIncludeNewMethods()
 }
 
 type Subscription interface {
+	String() string
+	ID() string
 	Exists(ctx context.Context) (bool, error)
+	Config(ctx context.Context) (SubscriptionConfig, error)
+	Update(ctx context.Context, cfg pubsub.SubscriptionConfigToUpdate) (SubscriptionConfig, error)
 	Receive(ctx context.Context, f func(context.Context, Message)) error
+	ReceiveSettings() pubsub.ReceiveSettings
+	SetReceiveSettings(pubsub.ReceiveSettings)
+	Delete(ctx context.Context) error
+	SeekToTime(ctx context.Context, t time.Time) error
+	CreateSnapshot(ctx context.Context, name string) (*SnapshotConfig, error)
+	SeekToSnapshot(ctx context.Context, snap Snapshot) error
+
+	embedToIncludeNewMethods()
+}
+
+type SubscriptionIterator interface {
+	Next() (Subscription, error)
+
+	embedToIncludeNewMethods()
+}
+
+type Snapshot interface {
+	ID() string
 	Delete(ctx context.Context) error
 
 	embedToIncludeNewMethods()
 }
 
+type SnapshotConfigIterator interface {
+	Next() (*SnapshotConfig, error)
+
+	embedToIncludeNewMethods()
+}
+
 type Message interface {
 	ID() string
 	Data() []byte
 	Attributes() map[string]string
 	PublishTime() time.Time
+	DeliveryAttempt() *int
+	OrderingKey() string
 	Ack()
 	Nack()
 
@@ -59,3 +116,26 @@ type PublishResult interface {
 
 	embedToIncludeNewMethods()
 }
+
+type SchemaClient interface {
+	Close() error
+	CreateSchema(ctx context.Context, schemaID string, s pubsub.SchemaConfig) (*pubsub.SchemaConfig, error)
+	Schema(ctx context.Context, schemaID string, view pubsub.SchemaView) (*pubsub.SchemaConfig, error)
+	Schemas(ctx context.Context, view pubsub.SchemaView) SchemaIterator
+	ListSchemaRevisions(ctx context.Context, schemaID string, view pubsub.SchemaView) SchemaIterator
+	CommitSchema(ctx context.Context, schemaID string, s pubsub.SchemaConfig) (*pubsub.SchemaConfig, error)
+	RollbackSchema(ctx context.Context, schemaID, revisionID string) (*pubsub.SchemaConfig, error)
+	DeleteSchemaRevision(ctx context.Context, schemaID, revisionID string) (*pubsub.SchemaConfig, error)
+	DeleteSchema(ctx context.Context, schemaID string) error
+	ValidateSchema(ctx context.Context, schema pubsub.SchemaConfig) (*pubsub.ValidateSchemaResult, error)
+	ValidateMessageWithConfig(ctx context.Context, msg []byte, encoding pubsub.SchemaEncoding, config pubsub.SchemaConfig) (*pubsub.ValidateMessageResult, error)
+	ValidateMessageWithID(ctx context.Context, msg []byte, encoding pubsub.SchemaEncoding, schemaID string) (*pubsub.ValidateMessageResult, error)
+
+	embedToIncludeNewMethods()
+}
+
+type SchemaIterator interface {
+	Next() (*pubsub.SchemaConfig, error)
+
+	embedToIncludeNewMethods()
+}
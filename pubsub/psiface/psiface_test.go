@@ -19,6 +19,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"reflect"
 	"strings"
 	"sync"
 	"testing"
@@ -117,6 +118,52 @@ func TestFake(t *testing.T) {
 	basicTests(t, msg, "my-topic", "my-subscription", client)
 }
 
+func TestToPSMessage(t *testing.T) {
+	attrs := map[string]string{"a": "b"}
+	for _, test := range []struct {
+		msg  Message
+		want *pubsub.Message
+	}{
+		{
+			NewMessage([]byte("x"), attrs, "k"),
+			&pubsub.Message{Data: []byte("x"), Attributes: attrs, OrderingKey: "k"},
+		},
+		{
+			AdaptMessage(&pubsub.Message{Data: []byte("x")}),
+			&pubsub.Message{Data: []byte("x")},
+		},
+		{
+			// Messages from other implementations are converted.
+			newFakeMessage("id", []byte("x"), attrs, time.Now()),
+			&pubsub.Message{Data: []byte("x"), Attributes: attrs},
+		},
+	} {
+		got := toPSMessage(test.msg)
+		if string(got.Data) != string(test.want.Data) || !reflect.DeepEqual(got.Attributes, test.want.Attributes) || got.OrderingKey != test.want.OrderingKey {
+			t.Errorf("toPSMessage(%v) = %+v, want %+v", test.msg, got, test.want)
+		}
+	}
+}
+
+func TestToPS(t *testing.T) {
+	p := &pubsub.DeadLetterPolicy{DeadLetterTopic: "projects/p/topics/t", MaxDeliveryAttempts: 10}
+	cfg := SubscriptionConfig{Topic: topic{}, SubscriptionConfig: pubsub.SubscriptionConfig{
+		DeadLetterPolicy:      p,
+		EnableMessageOrdering: true,
+		Filter:                `attributes:k`,
+	}}
+	got := cfg.toPS()
+	if got.DeadLetterPolicy != p {
+		t.Errorf("DeadLetterPolicy = %+v, want %+v", got.DeadLetterPolicy, p)
+	}
+	if !got.EnableMessageOrdering {
+		t.Error("EnableMessageOrdering not set")
+	}
+	if got.Filter != cfg.Filter {
+		t.Errorf("Filter = %q, want %q", got.Filter, cfg.Filter)
+	}
+}
+
 type fakeClient struct {
 	Client
 	topics sync.Map
@@ -253,6 +300,10 @@ func (m *fakeMessage) PublishTime() time.Time {
 	return m.publishTime
 }
 
+func (m *fakeMessage) OrderingKey() string {
+	return ""
+}
+
 func (m *fakeMessage) Ack() {}
 
 func (m *fakeMessage) Nack() {}
@@ -22,3 +22,9 @@ type SubscriptionConfig struct {
 	pubsub.SubscriptionConfig
 	Topic Topic // shadows pubsub.SubscriptionConfig's field
 }
+
+type SnapshotConfig struct {
+	pubsub.SnapshotConfig
+	Snapshot Snapshot // shadows pubsub.SnapshotConfig's embedded field
+	Topic    Topic    // shadows pubsub.SnapshotConfig's field
+}